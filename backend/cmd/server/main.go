@@ -1,21 +1,65 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/probemaster2/internal/config"
 	"github.com/probemaster2/internal/httpapi"
+	"github.com/probemaster2/internal/logging"
 )
 
 func main() {
+	logging.Init()
 	cfg := config.Load()
 
-	mux := httpapi.NewRouter(cfg)
+	api := httpapi.NewRouter(cfg)
+	// Timeouts stop slow or stalled clients from holding connections open indefinitely
+	// ReadTimeout and WriteTimeout would also cut off /ws and /api/stream, so those handlers
+	// clear both deadlines and bound their own reads and writes (see httpapi.clearDeadlines)
+	srv := &http.Server{
+		Addr:         cfg.ServerAddr,
+		Handler:      api,
+		ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+	}
+	// Shutdown doesn't wait for hijacked WebSockets but does wait for open event streams,
+	// so end both as soon as it starts
+	srv.RegisterOnShutdown(api.Stop)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", cfg.ServerAddr)
+		slog.Info("server version", "version", cfg.Version)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped", "error", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	}
 
-	log.Printf("server listening on %s", cfg.ServerAddr)
-	log.Printf("Version: %s", cfg.Version)
-	if err := http.ListenAndServe(cfg.ServerAddr, mux); err != nil {
-		log.Fatal(err)
+	// Drain in-flight requests, then flush the stores
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown incomplete", "error", err)
 	}
+	api.Shutdown()
+	slog.Info("server stopped")
 }
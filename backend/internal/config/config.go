@@ -1,13 +1,97 @@
 package config
 
 import (
+	"log/slog"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 )
 
+// Config is the server configuration loaded from the environment
+// GET /api/config serves only the fields listed in httpapi's configResponse
 type Config struct {
 	ServerAddr string
 
 	Version string
+
+	AccessKey    string   // Required in X-Access-Key for mutating endpoints (open if empty and AccessKeys is empty)
+	AccessKeys   []string // label:key pairs, each accepted like AccessKey and logged under its label
+	ProtectReads bool     // Also require the access key on read endpoints; health checks and probe endpoints stay open
+
+	AllowedOrigins []string // CORS origins allowed to access the API (any origin if empty)
+
+	ShutdownTimeoutSeconds int // Time allowed for in-flight requests to drain on shutdown
+
+	ReadTimeoutSeconds  int // Time allowed to read a whole request, headers and body
+	WriteTimeoutSeconds int // Time allowed to write a response; WebSocket and SSE streams are exempt
+	IdleTimeoutSeconds  int // Time a keep-alive connection may sit idle between requests
+
+	CompressMinBytes int // Smallest response body gzip-compressed for clients that accept it
+
+	BroadcastBuffer       int // Frames queued for WebSocket clients before new ones are dropped
+	WSPingIntervalSeconds int // Interval between WebSocket pings; clients missing two are dropped
+	WSMaxMessageBytes     int // Largest frame a WebSocket client may send; larger ones close the connection
+	WSRetryAfterSeconds   int // Reconnect delay suggested to WebSocket clients in the shutdown close frame
+
+	MessageStoreSize         int    // Maximum number of probe messages kept in memory
+	MessageLogPath           string // JSON-lines file messages are persisted to (disabled if empty)
+	MessageIDScheme          string // "counter" for <unix nanos>-<seq> message IDs or "uuidv7" for time-ordered UUIDs
+	CompactDuplicateMessages bool   // Count a message identical to its probe's previous one as a repeat instead of storing it
+	MessageMaxLength         int    // Longest probe data, in bytes, stored as a message (no limit if 0)
+	MessageOversize          string // "truncate" to store longer probe data cut to MessageMaxLength, or "reject" to refuse it
+	HistorySize              int    // Maximum number of points kept per probe metric
+	HistoryMaxMetrics        int    // Most distinct metrics kept per probe; further ones are skipped
+
+	AnomalyWindow     int     // Most recent history points a reading's z-score is computed against
+	AnomalyMinPoints  int     // History points a metric needs before its readings can be flagged
+	AnomalyZThreshold float64 // Readings whose |z-score| exceeds this are flagged as anomalous (disabled if 0)
+
+	AgeRetentionSeconds     int // Messages older than this are swept from the store (disabled if 0)
+	CommandTTLSeconds       int // Queued commands not pulled by a probe within this long expire
+	CommandRetentionSeconds int // Delivered, acked, and expired commands are forgotten this long afterwards
+	RetentionSweepSeconds   int // Interval between age retention sweeps
+
+	PollDefaultLength  int // Messages returned by a poll that doesn't specify a length
+	PollMaxLength      int // Largest length a poll may request; larger requests are clamped
+	PollMaxWaitSeconds int // Longest a poll may block waiting for new messages via wait; longer waits are clamped
+
+	ProbeStaleSeconds            int      // Seconds without a report before a probe is considered stale
+	ProbeRefreshDefault          int      // Refresh interval GET /api/probeconfig serves until one is set at runtime
+	ActivityMaxWindowSeconds     int      // Longest window GET /api/probes/active can count messages over
+	ProbeStatusCheckSeconds      int      // Interval between checks for probes going stale or coming back
+	ProbeStatusHysteresisSeconds int      // How long a probe must stay online/offline before the change is broadcast
+	ProbeAssignmentsPath         string   // JSON file of probe assignments merged over the built-in map
+	ProbeIDRulesPath             string   // JSON file of extra probe ID patterns, tried before the built-in ones
+	SeverityMapPath              string   // JSON file overriding the label and color of each threshold band
+	AreaStorePath                string   // JSON file area assignments are persisted to (disabled if empty)
+	PredefinedAreas              []string // Areas the area store always starts with, even before any probe is assigned
+	AreaAliases                  []string // alias=area pairs mapping other spellings onto a canonical area name
+	LocationAliases              []string // alias=location pairs mapping other spellings onto a canonical location name
+	AssignmentLogSize            int      // Maximum number of probe assignment changes kept for history
+	AssignmentLogPath            string   // JSON-lines file assignment changes are persisted to (disabled if empty)
+
+	MaxBodyBytes             int64   // Maximum size of any request body as sent; larger bodies get 413
+	MaxDecompressedBytes     int64   // Maximum size of a gzip-decompressed probe data body
+	MaxProbeIDLength         int     // Longest probe ID token accepted at the start of probe data
+	MinFirmwareVersion       string  // Probes reporting an older fw= version are flagged as outdated (disabled if empty)
+	LowBatteryThreshold      float64 // Probes reporting a bat= level below this are flagged and alerted on (disabled if 0)
+	StrictProbeIDs           bool    // Reject probe data whose probe ID doesn't resolve to an area
+	StrictProbeData          bool    // Reject probe data with tokens that aren't name=number pairs
+	TrustProbeTimestamps     bool    // Use a leading ts= token in probe data as the message timestamp
+	StripNonPrintable        bool    // Also drop non-printable Unicode from probe data, not just control characters
+	KeepRawProbeData         bool    // Store the payload as received alongside probe data that sanitizing changed
+	IdempotencyWindowSeconds int     // How long an Idempotency-Key suppresses duplicate probe data
+	StrictPixelAreas         bool    // Drop pixel counts for areas the area store doesn't know instead of just flagging them
+	PixelMax                 int     // Largest pixel count a display may report
+
+	IngestRateLimit   int      // Probe data requests per second allowed per source IP (disabled if 0)
+	IngestRateBurst   int      // Requests a source IP may send at once before being limited
+	IngestTrustedCIDR []string // Source networks exempt from the ingest rate limit
+
+	EnableSimulator bool // Expose /api/simulate for generating synthetic probe data; keep off in production
+
+	TraceSpans bool // Log the start and end of each probe data handling step with the request ID
 }
 
 func Load() Config {
@@ -17,11 +101,171 @@ func Load() Config {
 		}
 		return d
 	}
+	// getPositiveInt falls back to the default for missing, malformed, or non-positive values
+	getPositiveInt := func(k string, d int) int {
+		v := os.Getenv(k)
+		if v == "" {
+			return d
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			slog.Warn("config: invalid value, using default", "key", k, "value", v, "default", d)
+			return d
+		}
+		return n
+	}
+	// getNonNegativeInt is getPositiveInt for settings where 0 turns the feature off
+	getNonNegativeInt := func(k string, d int) int {
+		v := os.Getenv(k)
+		if v == "" {
+			return d
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Warn("config: invalid value, using default", "key", k, "value", v, "default", d)
+			return d
+		}
+		return n
+	}
+
+	// getNonNegativeFloat falls back to the default for missing, malformed, or negative values
+	getNonNegativeFloat := func(k string, d float64) float64 {
+		v := os.Getenv(k)
+		if v == "" {
+			return d
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+			slog.Warn("config: invalid value, using default", "key", k, "value", v, "default", d)
+			return d
+		}
+		return f
+	}
+
+	// getBool falls back to the default for missing or malformed values
+	getBool := func(k string, d bool) bool {
+		v := os.Getenv(k)
+		if v == "" {
+			return d
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			slog.Warn("config: invalid value, using default", "key", k, "value", v, "default", d)
+			return d
+		}
+		return b
+	}
+	// getChoice falls back to the default for values not among choices, ignoring case
+	getChoice := func(k, d string, choices ...string) string {
+		v := os.Getenv(k)
+		if v == "" {
+			return d
+		}
+		for _, choice := range choices {
+			if strings.EqualFold(v, choice) {
+				return choice
+			}
+		}
+		slog.Warn("config: invalid value, using default", "key", k, "value", v, "default", d)
+		return d
+	}
+	// getList splits a comma-separated value, dropping empty entries
+	// It falls back to the default when the value is missing or has no entries
+	getList := func(k string, d []string) []string {
+		var list []string
+		for _, item := range strings.Split(os.Getenv(k), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		if len(list) == 0 {
+			return d
+		}
+		return list
+	}
 
 	cfg := Config{
 		ServerAddr: get("SERVER_ADDR", ":8080"),
 
 		Version: get("VERSION", "1.0"),
+
+		AccessKey:    get("ACCESS_KEY", ""),
+		AccessKeys:   getList("ACCESS_KEYS", nil),
+		ProtectReads: getBool("PROTECT_READS", false),
+
+		AllowedOrigins: getList("CORS_ORIGINS", nil),
+
+		ShutdownTimeoutSeconds: getPositiveInt("SHUTDOWN_TIMEOUT_SECONDS", 10),
+
+		ReadTimeoutSeconds:  getPositiveInt("READ_TIMEOUT_SECONDS", 15),
+		WriteTimeoutSeconds: getPositiveInt("WRITE_TIMEOUT_SECONDS", 30),
+		IdleTimeoutSeconds:  getPositiveInt("IDLE_TIMEOUT_SECONDS", 120),
+
+		CompressMinBytes: getPositiveInt("COMPRESS_MIN_BYTES", 1024),
+
+		BroadcastBuffer:       getPositiveInt("BROADCAST_BUFFER", 256),
+		WSPingIntervalSeconds: getPositiveInt("WS_PING_INTERVAL_SECONDS", 30),
+		WSMaxMessageBytes:     getPositiveInt("WS_MAX_MESSAGE_BYTES", 4096),
+		WSRetryAfterSeconds:   getPositiveInt("WS_RETRY_AFTER_SECONDS", 5),
+
+		MessageStoreSize:         getPositiveInt("MESSAGE_STORE_SIZE", 5000),
+		MessageLogPath:           get("MESSAGE_LOG_PATH", ""),
+		MessageIDScheme:          getChoice("MESSAGE_ID_SCHEME", "counter", "counter", "uuidv7"),
+		CompactDuplicateMessages: getBool("COMPACT_DUPLICATE_MESSAGES", false),
+		MessageMaxLength:         getNonNegativeInt("MESSAGE_MAX_LENGTH", 0),
+		MessageOversize:          getChoice("MESSAGE_OVERSIZE", "truncate", "truncate", "reject"),
+		HistorySize:              getPositiveInt("HISTORY_SIZE", 500),
+		HistoryMaxMetrics:        getPositiveInt("HISTORY_MAX_METRICS", 32),
+
+		AnomalyWindow:     getPositiveInt("ANOMALY_WINDOW", 60),
+		AnomalyMinPoints:  getPositiveInt("ANOMALY_MIN_POINTS", 20),
+		AnomalyZThreshold: getNonNegativeFloat("ANOMALY_Z_THRESHOLD", 4),
+
+		AgeRetentionSeconds:     getNonNegativeInt("AGE_RETENTION_SECONDS", 0),
+		CommandTTLSeconds:       getPositiveInt("COMMAND_TTL_SECONDS", 60),
+		CommandRetentionSeconds: getPositiveInt("COMMAND_RETENTION_SECONDS", 3600),
+		RetentionSweepSeconds:   getPositiveInt("RETENTION_SWEEP_SECONDS", 60),
+
+		PollDefaultLength:  getPositiveInt("POLL_DEFAULT_LENGTH", 10),
+		PollMaxLength:      getPositiveInt("POLL_MAX_LENGTH", 1000),
+		PollMaxWaitSeconds: getPositiveInt("POLL_MAX_WAIT_SECONDS", 30),
+
+		ProbeStaleSeconds:            getPositiveInt("PROBE_STALE_SECONDS", 120),
+		ProbeRefreshDefault:          getPositiveInt("PROBE_REFRESH_DEFAULT", 60),
+		ActivityMaxWindowSeconds:     getPositiveInt("ACTIVITY_MAX_WINDOW_SECONDS", 3600),
+		ProbeStatusCheckSeconds:      getPositiveInt("PROBE_STATUS_CHECK_SECONDS", 5),
+		ProbeStatusHysteresisSeconds: getPositiveInt("PROBE_STATUS_HYSTERESIS_SECONDS", 10),
+		ProbeAssignmentsPath:         get("PROBE_ASSIGNMENTS_PATH", ""),
+		ProbeIDRulesPath:             get("PROBE_ID_RULES_PATH", ""),
+		SeverityMapPath:              get("SEVERITY_MAP_PATH", ""),
+		AreaStorePath:                get("AREA_STORE_PATH", ""),
+		PredefinedAreas:              getList("PREDEFINED_AREAS", []string{"FLOOR17", "FLOOR16", "FLOOR15", "FLOOR12", "FLOOR11", "TEAROOM", "POOL"}),
+		AreaAliases:                  getList("AREA_ALIASES", nil),
+		LocationAliases:              getList("LOCATION_ALIASES", nil),
+		AssignmentLogSize:            getPositiveInt("ASSIGNMENT_LOG_SIZE", 10000),
+		AssignmentLogPath:            get("ASSIGNMENT_LOG_PATH", ""),
+
+		MaxBodyBytes:             int64(getPositiveInt("MAX_BODY_BYTES", 1<<20)),
+		MaxDecompressedBytes:     int64(getPositiveInt("MAX_DECOMPRESSED_BYTES", 1<<20)),
+		MaxProbeIDLength:         getPositiveInt("MAX_PROBE_ID_LENGTH", 8),
+		MinFirmwareVersion:       get("MIN_FIRMWARE_VERSION", ""),
+		LowBatteryThreshold:      getNonNegativeFloat("LOW_BATTERY_THRESHOLD", 20),
+		StrictProbeIDs:           getBool("STRICT_PROBE_IDS", false),
+		StrictProbeData:          getBool("STRICT_PROBE_DATA", false),
+		TrustProbeTimestamps:     getBool("TRUST_PROBE_TIMESTAMPS", false),
+		StripNonPrintable:        getBool("STRIP_NON_PRINTABLE", false),
+		KeepRawProbeData:         getBool("KEEP_RAW_PROBE_DATA", false),
+		IdempotencyWindowSeconds: getPositiveInt("IDEMPOTENCY_WINDOW_SECONDS", 30),
+		StrictPixelAreas:         getBool("STRICT_PIXEL_AREAS", false),
+		PixelMax:                 getPositiveInt("PIXEL_MAX", 6),
+
+		IngestRateLimit:   getNonNegativeInt("INGEST_RATE_LIMIT", 0),
+		IngestRateBurst:   getPositiveInt("INGEST_RATE_BURST", 20),
+		IngestTrustedCIDR: getList("INGEST_TRUSTED_CIDRS", nil),
+
+		EnableSimulator: getBool("ENABLE_SIMULATOR", false),
+
+		TraceSpans: getBool("TRACE_SPANS", false),
 	}
 	return cfg
 }
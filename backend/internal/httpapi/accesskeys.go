@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// legacyKeyLabel is the label given to the single ACCESS_KEY
+const legacyKeyLabel = "default"
+
+// accessKey is one key accepted in X-Access-Key, with the label it is logged under
+type accessKey struct {
+	label string
+	key   string
+}
+
+// parseAccessKeys combines the single ACCESS_KEY with the label:key pairs from ACCESS_KEYS
+// Malformed entries and repeated labels or keys are skipped with a warning
+func parseAccessKeys(single string, pairs []string) []accessKey {
+	var keys []accessKey
+	labels := make(map[string]bool)
+	secrets := make(map[string]bool)
+	add := func(label, key string) {
+		if labels[label] || secrets[key] {
+			log.Printf("access keys: skipping repeated label or key for %q", label)
+			return
+		}
+		labels[label], secrets[key] = true, true
+		keys = append(keys, accessKey{label: label, key: key})
+	}
+
+	if single != "" {
+		add(legacyKeyLabel, single)
+	}
+	for i, pair := range pairs {
+		label, key, ok := strings.Cut(pair, ":")
+		label, key = strings.TrimSpace(label), strings.TrimSpace(key)
+		if !ok || label == "" || key == "" {
+			// The entry may hold a secret, so only its position is logged
+			log.Printf("access keys: skipping entry %d, want label:key", i+1)
+			continue
+		}
+		add(label, key)
+	}
+	return keys
+}
+
+// authEnabled reports whether any access key is configured; with none, every endpoint is open
+func (r *router) authEnabled() bool {
+	return len(r.accessKeys) > 0
+}
+
+// keyLabel returns the label of the configured key matching key
+// Every key is compared, so the time taken doesn't reveal which one matched
+func (r *router) keyLabel(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	label, found := "", false
+	for _, k := range r.accessKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k.key)) == 1 {
+			label, found = k.label, true
+		}
+	}
+	return label, found
+}
+
+// validKey reports whether key matches any configured access key
+func (r *router) validKey(key string) bool {
+	_, ok := r.keyLabel(key)
+	return ok
+}
+
+// authorize checks a request's key, logging the matched label for audit
+func (r *router) authorize(req *http.Request, key string) bool {
+	label, ok := r.keyLabel(key)
+	if !ok {
+		return false
+	}
+	slog.Info("access key accepted",
+		"request_id", requestID(req.Context()),
+		"key", label,
+		"method", req.Method,
+		"path", req.URL.Path,
+	)
+	return true
+}
+
+// keyLabels returns the configured key labels in the order they were given
+func (r *router) keyLabels() []string {
+	labels := make([]string, 0, len(r.accessKeys))
+	for _, k := range r.accessKeys {
+		labels = append(labels, k.label)
+	}
+	return labels
+}
+
+// handleAccessKeys lists the labels of the configured access keys, never the keys themselves
+func (r *router) handleAccessKeys(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	labels := r.keyLabels()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"labels": labels,
+		"count":  len(labels),
+	})
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestParseAccessKeys(t *testing.T) {
+	keys := parseAccessKeys("legacy", []string{
+		"grafana:g-key",
+		" ci : c-key ",
+		"no-colon",    // Malformed
+		":nolabel",    // Malformed
+		"empty:",      // Malformed
+		"grafana:x",   // Repeated label
+		"other:c-key", // Repeated key
+		"url:a:b",     // The key may itself contain colons
+	})
+	want := []accessKey{
+		{legacyKeyLabel, "legacy"},
+		{"grafana", "g-key"},
+		{"ci", "c-key"},
+		{"url", "a:b"},
+	}
+	if !slices.Equal(keys, want) {
+		t.Errorf("parseAccessKeys = %+v, want %+v", keys, want)
+	}
+
+	if keys := parseAccessKeys("", nil); len(keys) != 0 {
+		t.Errorf("parseAccessKeys with nothing configured = %+v, want none", keys)
+	}
+}
+
+func TestLabelledAccessKeys(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = ""
+		cfg.AccessKeys = []string{"grafana:g-key", "ci:c-key"}
+	})
+	logs := captureLogs(t)
+
+	// Any configured key is accepted, and the matched label is logged
+	for _, key := range []string{"g-key", "c-key"} {
+		expectStatus(t, serve(rt, "GET", "/api/config", "", map[string]string{"X-Access-Key": key}), http.StatusOK)
+	}
+	if out := logs.String(); !strings.Contains(out, `"key":"grafana"`) || !strings.Contains(out, `"key":"ci"`) {
+		t.Errorf("audit log doesn't name the matched labels: %s", out)
+	}
+	if out := logs.String(); strings.Contains(out, "g-key") || strings.Contains(out, "c-key") {
+		t.Errorf("audit log contains a key: %s", out)
+	}
+
+	// A revoked or unknown key is refused
+	expectStatus(t, serve(rt, "GET", "/api/config", "", map[string]string{"X-Access-Key": "old-key"}), http.StatusUnauthorized)
+	expectStatus(t, serve(rt, "GET", "/api/config", "", nil), http.StatusUnauthorized)
+
+	// Labelled keys also open the live feeds through the query parameter
+	if rec := serve(rt, "GET", "/ws?access_key=nope", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("/ws with an unknown key = %d, want 401", rec.Code)
+	}
+	if rec := serve(rt, "GET", "/ws?access_key=c-key", "", nil); rec.Code == http.StatusUnauthorized {
+		t.Error("/ws with a labelled key was refused")
+	}
+}
+
+func TestAccessKeyLabelsEndpoint(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "legacy"
+		cfg.AccessKeys = []string{"grafana:g-key", "ci:c-key"}
+	})
+
+	expectStatus(t, serve(rt, "GET", "/api/keys", "", nil), http.StatusUnauthorized)
+	expectStatus(t, serve(rt, "POST", "/api/keys", "", map[string]string{"X-Access-Key": "legacy"}), http.StatusMethodNotAllowed)
+
+	rec := serve(rt, "GET", "/api/keys", "", map[string]string{"X-Access-Key": "g-key"})
+	expectStatus(t, rec, http.StatusOK)
+	for _, key := range []string{"legacy", "g-key", "c-key"} {
+		if strings.Contains(rec.Body.String(), key) {
+			t.Errorf("response leaks key %q: %s", key, rec.Body)
+		}
+	}
+	var got struct {
+		Labels []string `json:"labels"`
+		Count  int      `json:"count"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := []string{legacyKeyLabel, "grafana", "ci"}; !slices.Equal(got.Labels, want) || got.Count != 3 {
+		t.Errorf("keys = %+v, want labels %v", got, want)
+	}
+
+	rec = serve(rt, "GET", "/api/config", "", map[string]string{"X-Access-Key": "c-key"})
+	expectStatus(t, rec, http.StatusOK)
+	var cfg configResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	if !slices.Equal(cfg.AccessKeyLabels, got.Labels) {
+		t.Errorf("accessKeyLabels = %v, want %v", cfg.AccessKeyLabels, got.Labels)
+	}
+	if strings.Contains(rec.Body.String(), "c-key") {
+		t.Errorf("config leaks a key: %s", rec.Body)
+	}
+}
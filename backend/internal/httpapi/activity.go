@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// activityRing counts a probe's messages per second over a fixed span of seconds
+// Slot i holds the count for the most recent second s with s % len == i
+type activityRing struct {
+	seconds []int64 // Unix second each slot currently counts
+	counts  []int
+}
+
+// ActivityStore counts the messages each probe sent per second, keeping up to maxWindow seconds
+type ActivityStore struct {
+	mu        sync.Mutex
+	maxWindow int
+	probes    map[string]*activityRing // probeID -> per-second counts
+}
+
+// NewActivityStore creates an activity store able to answer windows up to maxWindow seconds
+func NewActivityStore(maxWindow int) *ActivityStore {
+	return &ActivityStore{
+		maxWindow: maxWindow,
+		probes:    make(map[string]*activityRing),
+	}
+}
+
+// Record counts one message from a probe at the given time
+func (a *ActivityStore) Record(probeID string, t time.Time) {
+	probeID = strings.TrimSpace(probeID)
+	if probeID == "" || a.maxWindow <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ring := a.probes[probeID]
+	if ring == nil {
+		ring = &activityRing{seconds: make([]int64, a.maxWindow), counts: make([]int, a.maxWindow)}
+		a.probes[probeID] = ring
+	}
+	second := t.Unix()
+	slot := int(second % int64(a.maxWindow))
+	if slot < 0 {
+		slot += a.maxWindow
+	}
+	if ring.seconds[slot] != second {
+		ring.seconds[slot] = second
+		ring.counts[slot] = 0
+	}
+	ring.counts[slot]++
+}
+
+// Rename moves a probe's counts to a new probe ID
+func (a *ActivityStore) Rename(oldID, newID string) {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ring, ok := a.probes[oldID]
+	if !ok {
+		return
+	}
+	delete(a.probes, oldID)
+	a.probes[newID] = ring
+}
+
+// probeActivity is a probe's message count over a window
+type probeActivity struct {
+	ProbeID  string    `json:"probeId"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Top returns up to limit probes with the most messages in the window seconds up to now,
+// busiest first; probes with no messages in the window are left out
+func (a *ActivityStore) Top(window int, now time.Time, limit int) []probeActivity {
+	window = min(window, a.maxWindow)
+	newest := now.Unix()
+	oldest := newest - int64(window) // Exclusive
+	a.mu.Lock()
+	result := []probeActivity{}
+	for probeID, ring := range a.probes {
+		count := 0
+		for i, second := range ring.seconds {
+			if second > oldest && second <= newest {
+				count += ring.counts[i]
+			}
+		}
+		if count > 0 {
+			result = append(result, probeActivity{ProbeID: probeID, Count: count})
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].ProbeID < result[j].ProbeID
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// handleActiveProbes lists the probes that sent the most messages in the last window seconds
+// Useful for spotting a probe stuck in a reporting loop
+func (r *router) handleActiveProbes(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := 300
+	if windowStr := req.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := strconv.Atoi(windowStr)
+		if err != nil || parsed <= 0 || parsed > r.cfg.ActivityMaxWindowSeconds {
+			http.Error(w, fmt.Sprintf("window must be between 1 and %d seconds", r.cfg.ActivityMaxWindowSeconds), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	limit := 10
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	probes := r.activityStore.Top(window, time.Now(), limit)
+	for i := range probes {
+		probes[i].LastSeen, _ = r.lastSeenStore.LastSeen(probes[i].ProbeID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"window": window,
+		"probes": probes,
+		"count":  len(probes),
+	})
+}
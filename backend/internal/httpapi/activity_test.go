@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestActivityStoreTopCountsWithinWindow(t *testing.T) {
+	a := NewActivityStore(60)
+	now := time.Unix(1_700_000_000, 0)
+	for range 3 {
+		a.Record("F16R", now.Add(-5*time.Second))
+	}
+	a.Record("F16R", now.Add(-30*time.Second))
+	a.Record("F15R", now.Add(-time.Second))
+	a.Record("F15R", now)
+	a.Record("P1", now.Add(-40*time.Second))
+
+	got := a.Top(20, now, 10)
+	if len(got) != 2 || got[0].ProbeID != "F16R" || got[0].Count != 3 || got[1].ProbeID != "F15R" || got[1].Count != 2 {
+		t.Fatalf("Top(20s) = %+v, want F16R=3 then F15R=2", got)
+	}
+	got = a.Top(60, now, 10)
+	if len(got) != 3 || got[0].Count != 4 || got[2].ProbeID != "P1" {
+		t.Fatalf("Top(60s) = %+v, want F16R=4, F15R=2, P1=1", got)
+	}
+	if got := a.Top(60, now, 1); len(got) != 1 || got[0].ProbeID != "F16R" {
+		t.Errorf("Top with limit 1 = %+v, want only F16R", got)
+	}
+	// Windows past what is kept are cut to it
+	if got := a.Top(600, now, 10); len(got) != 3 {
+		t.Errorf("Top(600s) = %+v, want the 3 probes seen in the kept 60s", got)
+	}
+}
+
+func TestActivityStoreReusesExpiredSlots(t *testing.T) {
+	a := NewActivityStore(10)
+	start := time.Unix(1_700_000_000, 0)
+	a.Record("F16R", start)
+	a.Record("F16R", start)
+	// Ten seconds later the same slot counts a new second
+	later := start.Add(10 * time.Second)
+	a.Record("F16R", later)
+	if got := a.Top(10, later, 10); len(got) != 1 || got[0].Count != 1 {
+		t.Errorf("Top = %+v, want the old second's counts dropped", got)
+	}
+	// Once a probe goes quiet for the whole window it drops out
+	if got := a.Top(10, later.Add(20*time.Second), 10); len(got) != 0 {
+		t.Errorf("Top after going quiet = %+v, want none", got)
+	}
+}
+
+func TestActivityStoreRename(t *testing.T) {
+	a := NewActivityStore(60)
+	now := time.Now()
+	a.Record("F16R", now)
+	a.Rename("F16R", "F16X")
+	if got := a.Top(60, now, 10); len(got) != 1 || got[0].ProbeID != "F16X" {
+		t.Errorf("Top after rename = %+v, want F16X", got)
+	}
+}
+
+func TestActiveProbesEndpoint(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.ActivityMaxWindowSeconds = 600
+	})
+	for _, body := range []string{"F16R co2=400", "F16R co2=401", "F16R co2=402", "F15R co2=500"} {
+		expectStatus(t, serve(rt, "POST", "/api/probedata", body, nil), http.StatusOK)
+	}
+	// Heartbeats keep a probe alive but aren't messages
+	expectStatus(t, serve(rt, "POST", "/api/probes/F12R/heartbeat", "", nil), http.StatusOK)
+
+	rec := serve(rt, "GET", "/api/probes/active?window=60&limit=5", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Window int             `json:"window"`
+		Probes []probeActivity `json:"probes"`
+		Count  int             `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Window != 60 || body.Count != 2 || len(body.Probes) != 2 {
+		t.Fatalf("response = %+v, want 2 probes over 60s", body)
+	}
+	if p := body.Probes[0]; p.ProbeID != "F16R" || p.Count != 3 || p.LastSeen.IsZero() {
+		t.Errorf("busiest = %+v, want F16R with 3 messages and a lastSeen", p)
+	}
+
+	for _, query := range []string{"window=0", "window=601", "window=soon", "limit=0", "limit=x"} {
+		expectStatus(t, serve(rt, "GET", "/api/probes/active?"+query, "", nil), http.StatusBadRequest)
+	}
+	expectStatus(t, serve(rt, "POST", "/api/probes/active", "", nil), http.StatusMethodNotAllowed)
+}
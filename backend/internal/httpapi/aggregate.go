@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MetricAggregate summarizes a probe metric's stored values over a time range
+type MetricAggregate struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Last  float64 `json:"last"`
+	Empty bool    `json:"empty"` // No points matched; the other fields are zero
+}
+
+// aggregatePoints computes count/min/max/avg/last over points within [from, to]
+// A zero from or to leaves that end of the range open
+func aggregatePoints(points []Point, from, to time.Time) MetricAggregate {
+	var agg MetricAggregate
+	var sum float64
+	for _, p := range points {
+		if !from.IsZero() && p.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && p.Timestamp.After(to) {
+			continue
+		}
+		if agg.Count == 0 || p.Value < agg.Min {
+			agg.Min = p.Value
+		}
+		if agg.Count == 0 || p.Value > agg.Max {
+			agg.Max = p.Value
+		}
+		sum += p.Value
+		agg.Last = p.Value // Points are chronological
+		agg.Count++
+	}
+	if agg.Count == 0 {
+		agg.Empty = true
+		return agg
+	}
+	agg.Avg = sum / float64(agg.Count)
+	return agg
+}
+
+func (r *router) handleAggregate(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /api/aggregate?probeId=F16R&metric=co2&from=<rfc3339>&to=<rfc3339>
+	probeID := strings.TrimSpace(req.URL.Query().Get("probeId"))
+	metric := strings.ToLower(strings.TrimSpace(req.URL.Query().Get("metric")))
+	if probeID == "" || metric == "" {
+		http.Error(w, "probeId and metric required", http.StatusBadRequest)
+		return
+	}
+	from, err := parseTimeParam(req, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(req, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+
+	// Aggregates cover the bounded per-metric history, not messages evicted from it
+	agg := aggregatePoints(r.historyStore.Series(probeID, metric, 0), from, to)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ProbeID string `json:"probeId"`
+		Metric  string `json:"metric"`
+		MetricAggregate
+	}{probeID, metric, agg})
+}
@@ -0,0 +1,317 @@
+package httpapi
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Threshold bands derived from the six ascending threshold values
+// values[0] and values[1] bound the critical and warning lows,
+// values[4] and values[5] bound the warning and critical highs
+const (
+	BandNormal   = "normal"
+	BandWarnLow  = "warn-low"
+	BandWarnHigh = "warn-high"
+	BandCritLow  = "crit-low"
+	BandCritHigh = "crit-high"
+)
+
+// classifyValue returns the threshold band a value falls into
+// Thresholds that are all zero are treated as unset and always return normal
+func classifyValue(values []float64, v float64) string {
+	if len(values) < 6 {
+		return BandNormal
+	}
+	unset := true
+	for _, t := range values {
+		if t != 0 {
+			unset = false
+			break
+		}
+	}
+	if unset {
+		return BandNormal
+	}
+
+	switch {
+	case v < values[0]:
+		return BandCritLow
+	case v < values[1]:
+		return BandWarnLow
+	case v > values[5]:
+		return BandCritHigh
+	case v > values[4]:
+		return BandWarnHigh
+	}
+	return BandNormal
+}
+
+// ThresholdEvaluation is the current band of one probe metric against its area's thresholds
+type ThresholdEvaluation struct {
+	ProbeID  string  `json:"probeId"`
+	Location string  `json:"location"`
+	Metric   string  `json:"metric"`
+	Value    float64 `json:"value"`
+	Band     string  `json:"band"`
+	Label    string  `json:"label"` // The band's label and color from the severity map
+	Color    string  `json:"color"`
+	Breached bool    `json:"breached"` // Any band other than normal
+}
+
+// evaluateArea classifies the latest reading of every probe in an area against
+// the area's thresholds; metrics with thresholds but no reading are skipped
+// Returns false if the area doesn't exist
+func (r *router) evaluateArea(area string) ([]ThresholdEvaluation, bool) {
+	locations, ok := r.areaStore.GetLocations(area)
+	if !ok {
+		return nil, false
+	}
+	thresholds := r.thresholdStore.GetThresholds(area)
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i].Metric < thresholds[j].Metric
+	})
+
+	evaluations := []ThresholdEvaluation{}
+	for _, loc := range locations {
+		reading, ok := r.readingStore.GetReading(loc.ProbeID)
+		if !ok {
+			continue
+		}
+		for _, threshold := range thresholds {
+			value, ok := reading.Metrics[threshold.Metric]
+			if !ok {
+				continue
+			}
+			band := classifyValue(threshold.Values, value)
+			evaluations = append(evaluations, ThresholdEvaluation{
+				ProbeID:  loc.ProbeID,
+				Location: loc.Location,
+				Metric:   threshold.Metric,
+				Value:    value,
+				Band:     band,
+				Label:    r.severityMap[band].Label,
+				Color:    r.severityMap[band].Color,
+				Breached: band != BandNormal,
+			})
+		}
+	}
+	return evaluations, true
+}
+
+// minSuggestSamples is how many points a metric needs before thresholds are suggested for it
+const minSuggestSamples = 20
+
+// percentile returns the p-th percentile (0-100) of sorted values, interpolating between ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(rank)
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := rank - float64(lower)
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+}
+
+// suggestThresholdValues proposes the six threshold values from observed data:
+// p1/p5 bound the critical and warning lows, p95/p99 the warning and critical highs,
+// each widened by 5% of the observed p1-p99 spread; p25/p75 fill the middle values
+func suggestThresholdValues(samples []float64) []float64 {
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	p1, p99 := percentile(sorted, 1), percentile(sorted, 99)
+	margin := 0.05 * (p99 - p1)
+	return []float64{
+		p1 - margin,
+		percentile(sorted, 5) - margin,
+		percentile(sorted, 25),
+		percentile(sorted, 75),
+		percentile(sorted, 95) + margin,
+		p99 + margin,
+	}
+}
+
+// suggestAreaThresholds proposes thresholds for every metric recorded by an area's probes
+// Metrics with fewer than minSuggestSamples points are returned separately as insufficient
+// Returns false if the area doesn't exist
+func (r *router) suggestAreaThresholds(area string) (suggested []MetricThreshold, insufficient []string, ok bool) {
+	locations, ok := r.areaStore.GetLocations(area)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// Pool the history of every probe in the area per metric
+	samples := make(map[string][]float64)
+	for _, loc := range locations {
+		for _, metric := range r.historyStore.Metrics(loc.ProbeID) {
+			for _, p := range r.historyStore.Series(loc.ProbeID, metric, 0) {
+				samples[metric] = append(samples[metric], p.Value)
+			}
+		}
+	}
+
+	metrics := make([]string, 0, len(samples))
+	for metric := range samples {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	suggested, insufficient = []MetricThreshold{}, []string{}
+	for _, metric := range metrics {
+		if len(samples[metric]) < minSuggestSamples {
+			insufficient = append(insufficient, metric)
+			continue
+		}
+		suggested = append(suggested, MetricThreshold{
+			Metric: metric,
+			Values: suggestThresholdValues(samples[metric]),
+		})
+	}
+	return suggested, insufficient, true
+}
+
+// ThresholdAlert is broadcast over the WebSocket when a reading enters a breach band
+type ThresholdAlert struct {
+	ProbeID   string    `json:"probeId"`
+	Area      string    `json:"area"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Severity  string    `json:"severity"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// bandTracker remembers the last band per probe/metric so alerts only fire on transitions
+type bandTracker struct {
+	mu    sync.Mutex
+	bands map[string]string // probeID/metric -> band
+}
+
+func newBandTracker() *bandTracker {
+	return &bandTracker{
+		bands: make(map[string]string),
+	}
+}
+
+// transition records the band for a probe/metric and reports whether it changed
+func (bt *bandTracker) transition(probeID, metric, band string) bool {
+	key := probeID + "/" + metric
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	previous, seen := bt.bands[key]
+	bt.bands[key] = band
+	if !seen {
+		return band != BandNormal
+	}
+	return previous != band
+}
+
+// MetricBreaches counts the readings of one area metric that fell in a breach band
+type MetricBreaches struct {
+	Metric     string           `json:"metric"`
+	Total      int64            `json:"total"`
+	Bands      map[string]int64 `json:"bands"` // Breach band -> readings in that band
+	LastBreach time.Time        `json:"lastBreach"`
+}
+
+// breachCounter tallies threshold breaches per area, metric, and band since startup or the last reset
+type breachCounter struct {
+	mu       sync.Mutex
+	breaches map[string]map[string]*MetricBreaches // area -> metric -> counts
+}
+
+func newBreachCounter() *breachCounter {
+	return &breachCounter{
+		breaches: make(map[string]map[string]*MetricBreaches),
+	}
+}
+
+// Record counts one reading in a breach band
+func (bc *breachCounter) Record(area, metric, band string, timestamp time.Time) {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	metrics, ok := bc.breaches[areaUpper]
+	if !ok {
+		metrics = make(map[string]*MetricBreaches)
+		bc.breaches[areaUpper] = metrics
+	}
+	counts, ok := metrics[metric]
+	if !ok {
+		counts = &MetricBreaches{Metric: metric, Bands: make(map[string]int64)}
+		metrics[metric] = counts
+	}
+	counts.Total++
+	counts.Bands[band]++
+	if timestamp.After(counts.LastBreach) {
+		counts.LastBreach = timestamp
+	}
+}
+
+// Get returns the breach counts for an area, sorted by metric
+func (bc *breachCounter) Get(area string) []MetricBreaches {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	result := make([]MetricBreaches, 0, len(bc.breaches[areaUpper]))
+	for _, counts := range bc.breaches[areaUpper] {
+		c := *counts
+		c.Bands = make(map[string]int64, len(counts.Bands))
+		for band, n := range counts.Bands {
+			c.Bands[band] = n
+		}
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Metric < result[j].Metric
+	})
+	return result
+}
+
+// Reset clears an area's breach counts
+func (bc *breachCounter) Reset(area string) {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	delete(bc.breaches, areaUpper)
+}
+
+// evaluateThresholds checks a probe's metrics against its area's thresholds
+// and broadcasts an alert for each metric that moves into a breach band
+func (r *router) evaluateThresholds(probeID string, metrics map[string]float64, timestamp time.Time) {
+	area, _, ok := r.areaStore.FindProbe(probeID)
+	if !ok {
+		area, _ = r.parseProbeID(probeID)
+	}
+	if area == "" {
+		return
+	}
+
+	for metric, value := range metrics {
+		values, ok := r.thresholdStore.GetMetricThreshold(area, metric)
+		if !ok {
+			continue
+		}
+		band := classifyValue(values, value)
+		// Every breached reading is counted; alerts only fire on transitions
+		if band != BandNormal {
+			r.breachCounter.Record(area, metric, band, timestamp)
+		}
+		if !r.bandTracker.transition(probeID, metric, band) || band == BandNormal {
+			continue
+		}
+		r.messageStore.Broadcast(ThresholdAlert{
+			ProbeID:   probeID,
+			Area:      area,
+			Metric:    metric,
+			Value:     value,
+			Severity:  band,
+			Timestamp: timestamp,
+		})
+	}
+}
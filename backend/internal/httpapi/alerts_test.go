@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBreachingReadingBroadcastsAlert(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	expectStatus(t, serve(rt, "POST", "/api/thresholds/FLOOR16",
+		`{"thresholds":[{"metric":"co2","values":[300,350,400,800,1000,1200]}]}`, nil), http.StatusOK)
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=1250", nil), http.StatusOK)
+
+	frame := readFrameOfType(t, conn, "alert")
+	if frame.Version != wsProtocolVersion {
+		t.Errorf("version = %d, want %d", frame.Version, wsProtocolVersion)
+	}
+	var alert ThresholdAlert
+	if err := json.Unmarshal(frame.Payload, &alert); err != nil {
+		t.Fatalf("decode alert: %v", err)
+	}
+	if alert.ProbeID != "F16R" || alert.Area != "FLOOR16" || alert.Metric != "co2" || alert.Value != 1250 || alert.Severity != BandCritHigh {
+		t.Errorf("alert = %+v, want a crit-high co2 alert for F16R in FLOOR16", alert)
+	}
+}
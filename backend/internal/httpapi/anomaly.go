@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// anomalyDetector flags metric values far from a probe metric's recent history by rolling z-score
+type anomalyDetector struct {
+	window    int     // Most recent points the mean and stddev are taken over
+	minPoints int     // Points needed in the window before anything is flagged
+	threshold float64 // |z| above this is anomalous; 0 disables detection
+}
+
+// score returns v's z-score against the mean and population stddev of history, and whether it is anomalous
+// A flat history (stddev 0) has no spread to measure against, so nothing is flagged until it varies
+func (d anomalyDetector) score(history []Point, v float64) (float64, bool) {
+	if d.threshold <= 0 || len(history) < d.minPoints || len(history) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, p := range history {
+		sum += p.Value
+	}
+	mean := sum / float64(len(history))
+	var squares float64
+	for _, p := range history {
+		squares += (p.Value - mean) * (p.Value - mean)
+	}
+	stddev := math.Sqrt(squares / float64(len(history)))
+	if stddev == 0 {
+		return 0, false
+	}
+	z := (v - mean) / stddev
+	return z, math.Abs(z) > d.threshold
+}
+
+// Anomaly is a flagged point from a probe metric's history
+type Anomaly struct {
+	ProbeID   string    `json:"probeId"`
+	Area      string    `json:"area,omitempty"`
+	Metric    string    `json:"metric"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	ZScore    float64   `json:"zScore"`
+}
+
+// Anomalies returns every anomalous point still in the history, newest first
+func (hs *HistoryStore) Anomalies() []Anomaly {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	result := []Anomaly{}
+	for probeID, series := range hs.series {
+		for metric, ring := range series {
+			for _, p := range ring.last(0) {
+				if p.Anomalous {
+					result = append(result, Anomaly{ProbeID: probeID, Metric: metric, Timestamp: p.Timestamp, Value: p.Value, ZScore: p.ZScore})
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Timestamp.Equal(result[j].Timestamp) {
+			return result[i].Timestamp.After(result[j].Timestamp)
+		}
+		if result[i].ProbeID != result[j].ProbeID {
+			return result[i].ProbeID < result[j].ProbeID
+		}
+		return result[i].Metric < result[j].Metric
+	})
+	return result
+}
+
+// handleAnomalies lists readings flagged as anomalous, optionally for one area, newest first
+func (r *router) handleAnomalies(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	area := r.normalizer.normalizeArea(req.URL.Query().Get("area"))
+	limit := 100
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	anomalies := []Anomaly{}
+	for _, anomaly := range r.historyStore.Anomalies() {
+		anomaly.Area = r.probeArea(anomaly.ProbeID)
+		if area != "" && anomaly.Area != area {
+			continue
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	total := len(anomalies)
+	if len(anomalies) > limit {
+		anomalies = anomalies[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"anomalies": anomalies,
+		"count":     len(anomalies),
+		"total":     total,
+		"threshold": r.cfg.AnomalyZThreshold,
+	})
+}
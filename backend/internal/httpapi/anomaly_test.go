@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+// historyOf builds points with the given values
+func historyOf(values ...float64) []Point {
+	points := make([]Point, len(values))
+	for i, v := range values {
+		points[i] = Point{Value: v}
+	}
+	return points
+}
+
+func TestAnomalyDetectorScore(t *testing.T) {
+	d := anomalyDetector{window: 10, minPoints: 4, threshold: 3}
+	history := historyOf(400, 410, 400, 410, 400, 410)
+
+	if _, anomalous := d.score(history, 408); anomalous {
+		t.Error("a value within the usual spread was flagged")
+	}
+	z, anomalous := d.score(history, 500)
+	if !anomalous || z < 19 || z > 19.1 {
+		t.Errorf("score(500) = %v, %v, want z=19 flagged", z, anomalous)
+	}
+	if z, anomalous := d.score(history, 300); !anomalous || z > 0 {
+		t.Errorf("score(300) = %v, %v, want a negative z flagged", z, anomalous)
+	}
+
+	// Too little history to judge
+	if _, anomalous := d.score(history[:3], 500); anomalous {
+		t.Error("flagged with fewer than minPoints of history")
+	}
+	// A flat history has no spread to compare against
+	if _, anomalous := d.score(historyOf(21, 21, 21, 21, 21), 30); anomalous {
+		t.Error("flagged against a flat history")
+	}
+	// A zero threshold disables detection
+	if _, anomalous := (anomalyDetector{window: 10, minPoints: 4}).score(history, 5000); anomalous {
+		t.Error("flagged with detection disabled")
+	}
+}
+
+func TestHistoryStoreUsesRollingWindow(t *testing.T) {
+	hs := NewHistoryStore(100, 10, anomalyDetector{window: 4, minPoints: 4, threshold: 3})
+	now := time.Now()
+	// An old, wide-ranging stretch falls out of the window, so a later jump is judged against the steady one
+	for i, v := range []float64{0, 1000, 0, 1000, 500, 502, 500, 502} {
+		if p, _ := hs.Append("F16R", "co2", now.Add(time.Duration(i)*time.Second), v); p.Anomalous {
+			t.Fatalf("point %d (%v) flagged during setup", i, v)
+		}
+	}
+	p, _ := hs.Append("F16R", "co2", now.Add(10*time.Second), 520)
+	if !p.Anomalous || p.ZScore != 19 {
+		t.Errorf("Append(520) = %+v, want flagged with z=19", p)
+	}
+	series := hs.Series("F16R", "co2", 1)
+	if len(series) != 1 || !series[0].Anomalous {
+		t.Errorf("stored point = %+v, want it flagged", series)
+	}
+}
+
+func TestAnomaliesEndpoint(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AnomalyWindow = 20
+		cfg.AnomalyMinPoints = 10
+		cfg.AnomalyZThreshold = 3
+	})
+	for i := range 20 {
+		body := fmt.Sprintf("F16R co2=%d,temp=21.5", 400+10*(i%2))
+		expectStatus(t, serve(rt, "POST", "/api/probedata", body, nil), http.StatusOK)
+	}
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=2000,temp=21.5", nil), http.StatusOK)
+
+	reading, ok := rt.r.readingStore.GetReading("F16R")
+	if !ok || len(reading.Anomalous) != 1 || reading.Anomalous[0] != "co2" {
+		t.Fatalf("reading anomalous = %v, want [co2]", reading.Anomalous)
+	}
+
+	var body struct {
+		Anomalies []Anomaly `json:"anomalies"`
+		Count     int       `json:"count"`
+		Total     int       `json:"total"`
+	}
+	rec := serve(rt, "GET", "/api/anomalies?area=floor16", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != 1 || body.Total != 1 {
+		t.Fatalf("anomalies = %+v, want 1", body)
+	}
+	got := body.Anomalies[0]
+	if got.ProbeID != "F16R" || got.Area != "FLOOR16" || got.Metric != "co2" || got.Value != 2000 || got.ZScore <= 3 {
+		t.Errorf("anomaly = %+v, want F16R FLOOR16 co2=2000", got)
+	}
+
+	// Other areas see none
+	rec = serve(rt, "GET", "/api/anomalies?area=POOL", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	body.Anomalies = nil
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != 0 || body.Anomalies == nil {
+		t.Errorf("POOL anomalies = %+v, want an empty list", body)
+	}
+
+	expectStatus(t, serve(rt, "GET", "/api/anomalies?limit=0", "", nil), http.StatusBadRequest)
+	expectStatus(t, serve(rt, "POST", "/api/anomalies", "", nil), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// areaOrderPath places the area order next to the area file,
+// e.g. /data/areas.json -> /data/areas.order.json
+func areaOrderPath(areaStorePath string) string {
+	if areaStorePath == "" {
+		return ""
+	}
+	ext := filepath.Ext(areaStorePath)
+	return strings.TrimSuffix(areaStorePath, ext) + ".order.json"
+}
+
+// AreaOrderStore holds the order areas are listed in, persisting changes made at runtime
+type AreaOrderStore struct {
+	mu    sync.RWMutex
+	order []string
+	path  string // Optional JSON file the order is persisted to
+}
+
+// NewAreaOrderStore creates an area order store, loading a saved order from path if set
+func NewAreaOrderStore(path string) *AreaOrderStore {
+	ao := &AreaOrderStore{
+		order: []string{},
+		path:  path,
+	}
+	if path == "" {
+		return ao
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ao
+	}
+	if err != nil {
+		log.Printf("area order: read %s: %v", path, err)
+		return ao
+	}
+	var saved []string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("area order: parse %s: %v", path, err)
+		return ao
+	}
+	if saved != nil {
+		ao.order = saved
+	}
+	return ao
+}
+
+// Get returns a copy of the configured order
+func (ao *AreaOrderStore) Get() []string {
+	ao.mu.RLock()
+	defer ao.mu.RUnlock()
+	return append([]string{}, ao.order...)
+}
+
+// Set writes the order to disk and then replaces it
+// If the write fails the previous order stays in effect
+func (ao *AreaOrderStore) Set(order []string) error {
+	ao.mu.Lock()
+	defer ao.mu.Unlock()
+	if ao.path != "" {
+		if err := writeJSONFile(ao.path, order); err != nil {
+			return err
+		}
+	}
+	ao.order = order
+	return nil
+}
+
+// Sort orders area names in place: listed areas first, in the configured order,
+// then the rest alphabetically
+func (ao *AreaOrderStore) Sort(areas []string) {
+	ao.mu.RLock()
+	position := make(map[string]int, len(ao.order))
+	for i, area := range ao.order {
+		position[area] = i
+	}
+	ao.mu.RUnlock()
+
+	sort.SliceStable(areas, func(i, j int) bool {
+		pi, iListed := position[areas[i]]
+		pj, jListed := position[areas[j]]
+		switch {
+		case iListed && jListed:
+			return pi < pj
+		case iListed != jListed:
+			return iListed
+		default:
+			return areas[i] < areas[j]
+		}
+	})
+}
+
+// parseAreaOrder normalizes the area names in a requested order, rejecting blanks and duplicates
+func (r *router) parseAreaOrder(names []string) ([]string, error) {
+	order := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		area := r.normalizer.normalizeArea(name)
+		if area == "" {
+			return nil, fmt.Errorf("area %d is empty", i)
+		}
+		if seen[area] {
+			return nil, fmt.Errorf("area %s is listed more than once", area)
+		}
+		seen[area] = true
+		order = append(order, area)
+	}
+	return order, nil
+}
+
+// handleAreaOrder gets or replaces the order areas are listed in
+func (r *router) handleAreaOrder(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"order": r.areaOrder.Get(),
+		})
+		return
+	}
+
+	if req.Method == "PUT" {
+		var names []string
+		if err := json.NewDecoder(req.Body).Decode(&names); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		order, err := r.parseAreaOrder(names)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := r.areaOrder.Set(order); err != nil {
+			log.Printf("area order: save %s: %v", r.areaOrder.path, err)
+			http.Error(w, "failed to save area order", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": "updated",
+			"order":  order,
+		})
+		return
+	}
+
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+// listedAreas returns the distinct areas from GET /api/areas in the order they appear
+func listedAreas(t *testing.T, rt *Router) []string {
+	t.Helper()
+	rec := serve(rt, "GET", "/api/areas", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var rows []map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var areas []string
+	for _, row := range rows {
+		if len(areas) == 0 || areas[len(areas)-1] != row["area"] {
+			areas = append(areas, row["area"])
+		}
+	}
+	return areas
+}
+
+func TestAreasSortedAlphabeticallyByDefault(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.PredefinedAreas = []string{"POOL", "FLOOR17", "FLOOR16"}
+	})
+	// An area with several probes stays together
+	serve(rt, "POST", "/api/probedata", "F16R co2=454", nil)
+	serve(rt, "POST", "/api/probedata", "F16H co2=454", nil)
+
+	for range 5 {
+		if got, want := listedAreas(t, rt), []string{"FLOOR16", "FLOOR17", "POOL"}; !slices.Equal(got, want) {
+			t.Fatalf("areas = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAreaOrder(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.PredefinedAreas = []string{"POOL", "FLOOR17", "FLOOR16", "FLOOR15", "TEAROOM"}
+	})
+
+	rec := serve(rt, "PUT", "/api/areas/order", `["tearoom", " floor17 ", "BASEMENT"]`, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Order []string `json:"order"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := []string{"TEAROOM", "FLOOR17", "BASEMENT"}; !slices.Equal(body.Order, want) {
+		t.Errorf("order = %v, want %v", body.Order, want)
+	}
+
+	// Listed areas come first and the rest follow alphabetically; BASEMENT doesn't exist yet
+	if got, want := listedAreas(t, rt), []string{"TEAROOM", "FLOOR17", "FLOOR15", "FLOOR16", "POOL"}; !slices.Equal(got, want) {
+		t.Errorf("areas = %v, want %v", got, want)
+	}
+
+	// The overview keeps its own contract of sorting by name
+	rec = serve(rt, "GET", "/api/overview", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var overview []AreaOverview
+	if err := json.Unmarshal(rec.Body.Bytes(), &overview); err != nil {
+		t.Fatalf("decode overview: %v", err)
+	}
+	if !slices.IsSortedFunc(overview, func(a, b AreaOverview) int { return strings.Compare(a.Area, b.Area) }) {
+		t.Errorf("overview = %+v, want it sorted by area name", overview)
+	}
+
+	rec = serve(rt, "GET", "/api/areas/order", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := []string{"TEAROOM", "FLOOR17", "BASEMENT"}; !slices.Equal(body.Order, want) {
+		t.Errorf("GET order = %v, want %v", body.Order, want)
+	}
+}
+
+func TestAreaOrderRejectsInvalid(t *testing.T) {
+	rt := newTestRouter(t, nil)
+
+	for _, body := range []string{
+		`["FLOOR16", "floor16"]`, // Duplicate once normalized
+		`["FLOOR16", " "]`,
+		`{"order": ["FLOOR16"]}`,
+		`not json`,
+	} {
+		if rec := serve(rt, "PUT", "/api/areas/order", body, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, rec.Code)
+		}
+	}
+	expectStatus(t, serve(rt, "POST", "/api/areas/order", `["FLOOR16"]`, nil), http.StatusMethodNotAllowed)
+
+	// Writes need the access key when one is set
+	rt = newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "secret"
+	})
+	expectStatus(t, serve(rt, "PUT", "/api/areas/order", `["FLOOR16"]`, nil), http.StatusUnauthorized)
+	expectStatus(t, serve(rt, "PUT", "/api/areas/order", `["FLOOR16"]`, map[string]string{"X-Access-Key": "secret"}), http.StatusOK)
+}
+
+func TestAreaOrderPersistsAcrossRestart(t *testing.T) {
+	areaPath := filepath.Join(t.TempDir(), "areas.json")
+	configure := func(cfg *config.Config) {
+		cfg.AreaStorePath = areaPath
+		cfg.PredefinedAreas = []string{"FLOOR16", "FLOOR17", "POOL"}
+	}
+
+	rt := newTestRouter(t, configure)
+	expectStatus(t, serve(rt, "PUT", "/api/areas/order", `["POOL", "FLOOR17"]`, nil), http.StatusOK)
+	rt.Shutdown()
+
+	if got, want := listedAreas(t, newTestRouter(t, configure)), []string{"POOL", "FLOOR17", "FLOOR16"}; !slices.Equal(got, want) {
+		t.Errorf("areas after restart = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(areaPath), "areas.order.json")); err != nil {
+		t.Errorf("area order file: %v", err)
+	}
+}
+
+func TestAreaOrderKeptWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AreaStorePath = filepath.Join(dir, "areas.json")
+		cfg.PredefinedAreas = []string{"FLOOR16", "FLOOR17", "POOL"}
+	})
+	expectStatus(t, serve(rt, "PUT", "/api/areas/order", `["POOL"]`, nil), http.StatusOK)
+	if code, checks := readinessChecks(t, rt); code != http.StatusOK || checks["areaOrder"] != "ok" {
+		t.Errorf("healthz = %d %v, want 200 with areaOrder ok", code, checks)
+	}
+
+	// A directory in the file's place makes the write fail
+	orderPath := filepath.Join(dir, "areas.order.json")
+	if err := os.Remove(orderPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Mkdir(orderPath, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	expectStatus(t, serve(rt, "PUT", "/api/areas/order", `["FLOOR17"]`, nil), http.StatusInternalServerError)
+	if got, want := listedAreas(t, rt), []string{"POOL", "FLOOR16", "FLOOR17"}; !slices.Equal(got, want) {
+		t.Errorf("areas after a failed save = %v, want the previous order %v", got, want)
+	}
+	if code, checks := readinessChecks(t, rt); code != http.StatusServiceUnavailable || checks["areaOrder"] == "ok" {
+		t.Errorf("healthz = %d %v, want 503 with areaOrder failing", code, checks)
+	}
+}
@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// areaSaveDelay batches bursts of assignment changes into a single write
+const areaSaveDelay = 500 * time.Millisecond
+
+// scheduleSave records a change and queues a write of the area file; must be called with as.mu held for writing
+func (as *AreaStore) scheduleSave() {
+	as.version++
+	if as.path == "" {
+		return
+	}
+	as.saveMu.Lock()
+	defer as.saveMu.Unlock()
+	if as.savePending {
+		return // The pending write will pick up this change too
+	}
+	as.savePending = true
+	as.saveTimer = time.AfterFunc(areaSaveDelay, as.save)
+}
+
+// save writes the current areas to the area file
+func (as *AreaStore) save() {
+	as.writeMu.Lock()
+	defer as.writeMu.Unlock()
+
+	as.saveMu.Lock()
+	as.savePending = false
+	as.saveMu.Unlock()
+
+	if err := writeJSONFile(as.path, as.GetAreas()); err != nil {
+		log.Printf("area store: save %s: %v", as.path, err)
+	}
+}
+
+// Close flushes any pending write of the area file
+func (as *AreaStore) Close() {
+	if as.path == "" {
+		return
+	}
+	as.saveMu.Lock()
+	if as.saveTimer != nil {
+		as.saveTimer.Stop()
+	}
+	as.saveMu.Unlock()
+	as.save()
+}
+
+// writeJSONFile replaces the file at path with v encoded as JSON, writing to a
+// temp file first so a crash mid-write never leaves a truncated file behind
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadAreaFile reads areas previously written by save
+// A missing file is not an error
+func loadAreaFile(path string) (map[string][]AreaLocation, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var areas map[string][]AreaLocation
+	if err := json.Unmarshal(data, &areas); err != nil {
+		return nil, err
+	}
+	for area, locations := range areas {
+		if locations == nil {
+			areas[area] = []AreaLocation{}
+		}
+	}
+	return areas, nil
+}
@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestAreaStoreSurvivesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "areas.json")
+
+	as := NewAreaStore(path, []string{"POOL"}, newNameNormalizer(nil, nil))
+	as.AddLocation("FLOOR16", "ROTUNDA", "X16R")
+	as.AddLocation("BASEMENT", "BOILER", "B01") // Not a predefined area
+	as.RemoveProbe("X16R")
+	as.AddLocation("FLOOR16", "HALLWAY", "X16H")
+	as.Close()
+
+	reloaded := NewAreaStore(path, []string{"POOL"}, newNameNormalizer(nil, nil))
+	defer reloaded.Close()
+	for probeID, want := range map[string][2]string{
+		"X16H": {"FLOOR16", "HALLWAY"},
+		"B01":  {"BASEMENT", "BOILER"},
+	} {
+		area, location, ok := reloaded.FindProbe(probeID)
+		if !ok || area != want[0] || location != want[1] {
+			t.Errorf("FindProbe(%s) = %s/%s, %v; want %s/%s", probeID, area, location, ok, want[0], want[1])
+		}
+	}
+	if reloaded.ProbeAssigned("X16R") {
+		t.Error("removed probe X16R came back after reload")
+	}
+	// Predefined areas are still present
+	if _, ok := reloaded.GetLocations("POOL"); !ok {
+		t.Error("predefined area POOL missing after reload")
+	}
+}
+
+func TestAreaStoreConcurrentAssignment(t *testing.T) {
+	as := NewAreaStore("", nil, newNameNormalizer(nil, nil))
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				probeID := fmt.Sprintf("T%d%02d", w, i)
+				as.AddLocation("LAB", "BENCH-"+probeID, probeID)
+				if as.AssignIfUnassigned("LAB", "SPARE-"+probeID, probeID) {
+					t.Errorf("%s assigned twice", probeID)
+				}
+				as.ProbeAssigned(probeID)
+				if i%2 == 0 {
+					as.RemoveProbe(probeID)
+				}
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				for _, locations := range as.GetAreas() {
+					_ = len(locations)
+				}
+				as.FindProbe("T000")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each worker kept its 50 odd-numbered probes
+	if kept := len(as.GetAreas()["LAB"]); kept != 200 {
+		t.Errorf("%d probes assigned after the run, want 200", kept)
+	}
+}
+
+func TestAreaStoreCustomPredefinedAreas(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.PredefinedAreas = []string{"Floor3", "tea_room", " lobby ", ""}
+	})
+
+	areas := rt.r.areaStore.GetAreas()
+	want := []string{"FLOOR3", "TEAROOM", "LOBBY"}
+	if len(areas) != len(want) {
+		t.Fatalf("areas = %v, want %v", areas, want)
+	}
+	for _, area := range want {
+		if _, ok := areas[area]; !ok {
+			t.Errorf("predefined area %s missing from %v", area, areas)
+		}
+	}
+	if _, ok := areas["FLOOR16"]; ok {
+		t.Error("built-in area FLOOR16 present with a custom set")
+	}
+
+	// Assigning under another spelling lands in the seeded area rather than a new one
+	expectStatus(t, serve(rt, "POST", "/api/probes/L01", `{"area": "lobby", "location": "desk"}`, nil), 200)
+	if area, _, ok := rt.r.areaStore.FindProbe("L01"); !ok || area != "LOBBY" {
+		t.Errorf("FindProbe(L01) = %s, %v; want LOBBY", area, ok)
+	}
+	if got := len(rt.r.areaStore.GetAreas()); got != len(want) {
+		t.Errorf("%d areas after assignment, want %d", got, len(want))
+	}
+}
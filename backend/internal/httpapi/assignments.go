@@ -0,0 +1,223 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Assignment log actions
+const (
+	assignmentAssigned     = "assigned"      // Assigned through POST /api/probes/{id}
+	assignmentAutoAssigned = "auto-assigned" // Assigned from the probe ID on first report
+	assignmentRemoved      = "removed"       // Unassigned by DELETE /api/probes/{id} or clearing its area
+	assignmentRenamed      = "renamed"       // Assignment carried over by a probe rename
+)
+
+// AssignmentEvent is one entry in the probe assignment log
+type AssignmentEvent struct {
+	ProbeID     string    `json:"probeId"`
+	Action      string    `json:"action"`
+	Area        string    `json:"area,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	RenamedFrom string    `json:"renamedFrom,omitempty"` // Set on the new ID's entry for a rename
+	RenamedTo   string    `json:"renamedTo,omitempty"`   // Set on the old ID's entry for a rename
+}
+
+// AssignmentLog is an append-only record of probe assignment changes
+// It keeps the most recent maxSize events, optionally appending each one to a JSON-lines file
+// The file is compacted back to maxSize lines once it holds twice that many
+type AssignmentLog struct {
+	mu      sync.Mutex
+	events  []AssignmentEvent
+	maxSize int
+	path    string
+	file    *os.File // nil when persistence is disabled or the file couldn't be opened
+	lines   int      // Events in the file, counted to know when to compact it
+}
+
+// NewAssignmentLog creates an assignment log, loading earlier events from path if set
+func NewAssignmentLog(maxSize int, path string) *AssignmentLog {
+	al := &AssignmentLog{
+		events:  make([]AssignmentEvent, 0, min(maxSize, 1024)),
+		maxSize: maxSize,
+		path:    path,
+	}
+	if path == "" {
+		return al
+	}
+
+	events, total, err := loadAssignmentLog(path, maxSize)
+	if err != nil {
+		log.Printf("assignment log: load %s: %v", path, err)
+	}
+	al.events = append(al.events, events...)
+	al.lines = total
+	// Compact a file that has grown past the limit so it doesn't grow forever
+	if total > len(events) {
+		al.compactLocked()
+	}
+	al.openLocked()
+	return al
+}
+
+// openLocked opens the log file for appending; on failure events are kept in memory only
+// Must be called with al.mu held
+func (al *AssignmentLog) openLocked() {
+	f, err := os.OpenFile(al.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("assignment log: open %s: %v", al.path, err)
+		return
+	}
+	al.file = f
+}
+
+// compactLocked rewrites the file with only the events kept in memory
+// A failed rewrite leaves the old file in place
+// Must be called with al.mu held and the file closed
+func (al *AssignmentLog) compactLocked() {
+	if err := writeAssignmentLog(al.path, al.events); err != nil {
+		log.Printf("assignment log: compact %s: %v", al.path, err)
+		return
+	}
+	al.lines = len(al.events)
+}
+
+// Record appends an event, stamping it with the current time if unset
+func (al *AssignmentLog) Record(event AssignmentEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.events = append(al.events, event)
+	if len(al.events) > al.maxSize {
+		al.events = al.events[len(al.events)-al.maxSize:]
+	}
+
+	if al.file == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("assignment log: encode event for %s: %v", event.ProbeID, err)
+		return
+	}
+	if _, err := al.file.Write(append(line, '\n')); err != nil {
+		log.Printf("assignment log: write %s: %v", al.path, err)
+		return
+	}
+	al.lines++
+	if al.lines >= 2*al.maxSize {
+		al.file.Close()
+		al.file = nil
+		al.compactLocked()
+		al.openLocked()
+	}
+}
+
+// ForProbe returns the events for a probe ID, oldest first
+func (al *AssignmentLog) ForProbe(probeID string) []AssignmentEvent {
+	probeID = strings.TrimSpace(probeID)
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	result := []AssignmentEvent{}
+	for _, event := range al.events {
+		if strings.EqualFold(event.ProbeID, probeID) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// Close closes the log file
+func (al *AssignmentLog) Close() {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.file != nil {
+		al.file.Close()
+		al.file = nil
+	}
+}
+
+// loadAssignmentLog reads back the last maxSize events from the log at path,
+// along with the number of valid events in the file
+// A missing file is not an error; malformed lines are skipped
+func loadAssignmentLog(path string, maxSize int) ([]AssignmentEvent, int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var events []AssignmentEvent
+	total := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event AssignmentEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("assignment log: skipping malformed line: %v", err)
+			continue
+		}
+		total++
+		events = append(events, event)
+		if len(events) > maxSize {
+			events = events[1:]
+		}
+	}
+	return events, total, scanner.Err()
+}
+
+// writeAssignmentLog replaces the log at path with events
+// It writes to a temporary file and renames it over the log, so a crash can't lose the history
+func writeAssignmentLog(path string, events []AssignmentEvent) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// handleProbeAssignments returns a probe's assignment history, oldest first
+func (r *router) handleProbeAssignments(w http.ResponseWriter, req *http.Request, probeID string) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"probeId":     probeID,
+		"assignments": r.assignmentLog.ForProbe(probeID),
+	})
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countLines returns the number of lines in the file at path
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestAssignmentLogCompactsWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assignments.jsonl")
+	al := NewAssignmentLog(3, path)
+	defer al.Close()
+
+	for i := range 5 {
+		al.Record(AssignmentEvent{ProbeID: "F16R", Action: assignmentAssigned, Area: "FLOOR16", Location: string(rune('A' + i))})
+	}
+	if n := countLines(t, path); n != 5 {
+		t.Fatalf("file has %d lines before reaching the limit, want 5", n)
+	}
+	// The sixth event takes the file to twice the limit, so it is cut back to the kept events
+	al.Record(AssignmentEvent{ProbeID: "F16R", Action: assignmentRemoved})
+	if n := countLines(t, path); n != 3 {
+		t.Errorf("file has %d lines after compacting, want 3", n)
+	}
+	// Appending continues on the compacted file
+	al.Record(AssignmentEvent{ProbeID: "F17R", Action: assignmentAssigned})
+	if n := countLines(t, path); n != 4 {
+		t.Errorf("file has %d lines after another event, want 4", n)
+	}
+	al.Close()
+
+	reloaded := NewAssignmentLog(3, path)
+	defer reloaded.Close()
+	events := reloaded.ForProbe("F16R")
+	if len(events) != 2 || events[0].Location != "E" || events[1].Action != assignmentRemoved {
+		t.Errorf("reloaded F16R events = %+v, want the last assignment and the removal", events)
+	}
+}
+
+func TestAssignmentLogCompactsOnStartupWithoutTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "assignments.jsonl")
+	al := NewAssignmentLog(10, path)
+	for range 4 {
+		al.Record(AssignmentEvent{ProbeID: "F16R", Action: assignmentAssigned})
+	}
+	al.Close()
+
+	reloaded := NewAssignmentLog(2, path)
+	defer reloaded.Close()
+	if n := countLines(t, path); n != 2 {
+		t.Errorf("file has %d lines after startup compaction, want 2", n)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the log", len(entries))
+	}
+}
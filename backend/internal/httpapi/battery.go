@@ -0,0 +1,154 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// splitProbeBattery removes a bat=<level> token from probe data, returning the data without it
+// and the reported level; ok is false if there was none
+// A value that isn't a number is left in place, so it is reported like any other malformed metric
+func splitProbeBattery(data string, maxIDLength int) (stripped string, level float64, ok bool) {
+	stripped, value := splitProbeToken(data, maxIDLength, "bat", func(value string) bool {
+		v, err := strconv.ParseFloat(value, 64)
+		return err == nil && !math.IsNaN(v) && !math.IsInf(v, 0)
+	})
+	if value == "" {
+		return data, 0, false
+	}
+	level, _ = strconv.ParseFloat(value, 64)
+	return stripped, level, true
+}
+
+// BatteryAlert is broadcast over the WebSocket when a probe's battery drops below LOW_BATTERY_THRESHOLD
+type BatteryAlert struct {
+	ProbeID   string    `json:"probeId"`
+	Area      string    `json:"area"`
+	Level     float64   `json:"level"`
+	Threshold float64   `json:"threshold"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// batteryReport is the last battery level a probe reported
+type batteryReport struct {
+	level      float64
+	reportedAt time.Time
+	low        bool // Below the threshold when reported
+}
+
+// BatteryStore tracks the latest battery level reported by each probe
+type BatteryStore struct {
+	mu           sync.RWMutex
+	batteries    map[string]batteryReport // probeID -> latest report
+	lowThreshold float64                  // Levels below this are low; 0 disables
+}
+
+// NewBatteryStore creates a new battery store flagging levels below lowThreshold
+func NewBatteryStore(lowThreshold float64) *BatteryStore {
+	return &BatteryStore{
+		batteries:    make(map[string]batteryReport),
+		lowThreshold: lowThreshold,
+	}
+}
+
+// Set records the battery level a probe reported at the given time,
+// reporting whether the level just dropped below the threshold
+// A probe whose first report is already low counts as dropping; one that stays low doesn't
+func (bs *BatteryStore) Set(probeID string, level float64, t time.Time) (droppedLow bool) {
+	probeID = strings.TrimSpace(probeID)
+	if probeID == "" {
+		return false
+	}
+	low := bs.lowThreshold > 0 && level < bs.lowThreshold
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	previous, seen := bs.batteries[probeID]
+	bs.batteries[probeID] = batteryReport{level: level, reportedAt: t, low: low}
+	return low && !(seen && previous.low)
+}
+
+// Get returns the battery level a probe last reported and whether it is low
+func (bs *BatteryStore) Get(probeID string) (level float64, low, ok bool) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	report, ok := bs.batteries[strings.TrimSpace(probeID)]
+	return report.level, report.low, ok
+}
+
+// Rename moves a probe's battery level to a new probe ID
+func (bs *BatteryStore) Rename(oldID, newID string) {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	report, ok := bs.batteries[oldID]
+	if !ok {
+		return
+	}
+	delete(bs.batteries, oldID)
+	bs.batteries[newID] = report
+}
+
+// all returns a copy of every probe's latest report
+func (bs *BatteryStore) all() map[string]batteryReport {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	result := make(map[string]batteryReport, len(bs.batteries))
+	for probeID, report := range bs.batteries {
+		result[probeID] = report
+	}
+	return result
+}
+
+// recordBattery stores a probe's battery level and alerts WebSocket clients when it drops below the threshold
+func (r *router) recordBattery(probeID string, level float64, receivedAt, timestamp time.Time) {
+	if !r.batteryStore.Set(probeID, level, receivedAt) {
+		return
+	}
+	r.messageStore.Broadcast(BatteryAlert{
+		ProbeID:   strings.TrimSpace(probeID),
+		Area:      r.probeArea(strings.TrimSpace(probeID)),
+		Level:     level,
+		Threshold: r.cfg.LowBatteryThreshold,
+		Timestamp: timestamp,
+	})
+}
+
+// handleProbeBattery lists the battery level each probe last reported, lowest first
+func (r *router) handleProbeBattery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type batteryEntry struct {
+		ProbeID    string    `json:"probeId"`
+		Level      float64   `json:"level"`
+		ReportedAt time.Time `json:"reportedAt"`
+		Low        bool      `json:"low"`
+	}
+
+	entries := []batteryEntry{}
+	for probeID, report := range r.batteryStore.all() {
+		entries = append(entries, batteryEntry{
+			ProbeID:    probeID,
+			Level:      report.level,
+			ReportedAt: report.reportedAt,
+			Low:        report.low,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Level != entries[j].Level {
+			return entries[i].Level < entries[j].Level
+		}
+		return entries[i].ProbeID < entries[j].ProbeID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
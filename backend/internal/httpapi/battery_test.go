@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/probemaster2/internal/config"
+)
+
+func TestSplitProbeBattery(t *testing.T) {
+	tests := []struct {
+		data, wantData string
+		wantLevel      float64
+		wantOK         bool
+	}{
+		{"F16R bat=87,co2=454", "F16R co2=454", 87, true},
+		{"F16R co2=454, BAT=12.5 ,temp=25", "F16R co2=454,temp=25", 12.5, true},
+		{"F16R co2=454", "F16R co2=454", 0, false},
+		{"F16R co2=454,bat=low", "F16R co2=454,bat=low", 0, false}, // Left for validation to report
+		{"F16R", "F16R", 0, false},
+	}
+	for _, tt := range tests {
+		data, level, ok := splitProbeBattery(tt.data, 8)
+		if data != tt.wantData || level != tt.wantLevel || ok != tt.wantOK {
+			t.Errorf("splitProbeBattery(%q) = %q, %v, %v; want %q, %v, %v", tt.data, data, level, ok, tt.wantData, tt.wantLevel, tt.wantOK)
+		}
+	}
+}
+
+func TestBatteryStoreAlertsOnceWhenLow(t *testing.T) {
+	bs := NewBatteryStore(20)
+	now := time.Now()
+	steps := []struct {
+		level       float64
+		wantDropped bool
+	}{
+		{50, false},
+		{19, true},
+		{15, false}, // Still low
+		{25, false}, // Swapped
+		{10, true},
+	}
+	for i, step := range steps {
+		if dropped := bs.Set("F16R", step.level, now); dropped != step.wantDropped {
+			t.Errorf("step %d: Set(%v) = %v, want %v", i, step.level, dropped, step.wantDropped)
+		}
+	}
+
+	// A probe that first reports a low level is alerted on straight away
+	if !bs.Set("F17R", 5, now) {
+		t.Error("first low report didn't count as dropping")
+	}
+
+	// With no threshold nothing is ever low
+	disabled := NewBatteryStore(0)
+	if disabled.Set("F16R", 1, now) {
+		t.Error("Set with threshold 0 reported a drop")
+	}
+}
+
+func TestProbeBatteryIngest(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.LowBatteryThreshold = 20
+		cfg.StrictProbeData = true
+	})
+
+	rec := serve(rt, "POST", "/api/probedata", "F16R co2=454,bat=15", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp["battery"] != float64(15) {
+		t.Errorf("battery = %v, want 15", resp["battery"])
+	}
+	// The level isn't a metric
+	if metrics, _ := resp["metrics"].(map[string]any); len(metrics) != 1 || metrics["co2"] != float64(454) {
+		t.Errorf("metrics = %v, want only co2", resp["metrics"])
+	}
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F17R co2=454,bat=80", nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F15R co2=454", nil), http.StatusOK)
+	// Strict mode still rejects a level that isn't a number
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454,bat=low", nil), http.StatusBadRequest)
+
+	rec = serve(rt, "GET", "/api/probes/battery", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var batteries []struct {
+		ProbeID string  `json:"probeId"`
+		Level   float64 `json:"level"`
+		Low     bool    `json:"low"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &batteries); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(batteries) != 2 || batteries[0].ProbeID != "F16R" || !batteries[0].Low || batteries[1].ProbeID != "F17R" || batteries[1].Low {
+		t.Errorf("batteries = %+v, want low F16R then F17R", batteries)
+	}
+
+	rec = serve(rt, "GET", "/api/probes/status", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var statuses []ProbeStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	byID := make(map[string]ProbeStatus)
+	for _, status := range statuses {
+		byID[status.ProbeID] = status
+	}
+	if s := byID["F16R"]; s.Battery == nil || *s.Battery != 15 || !s.LowBattery {
+		t.Errorf("F16R status = %+v, want battery 15 flagged low", s)
+	}
+	if s := byID["F17R"]; s.Battery == nil || *s.Battery != 80 || s.LowBattery {
+		t.Errorf("F17R status = %+v, want battery 80 not low", s)
+	}
+	if s := byID["F15R"]; s.Battery != nil || s.LowBattery {
+		t.Errorf("F15R status = %+v, want no battery", s)
+	}
+
+	expectStatus(t, serve(rt, "POST", "/api/probes/battery", "", nil), http.StatusMethodNotAllowed)
+}
+
+func TestLowBatteryBroadcastsAlert(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.LowBatteryThreshold = 20
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454,bat=30", nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454,bat=12", nil), http.StatusOK)
+
+	frame := readFrameOfType(t, conn, "low_battery")
+	var alert BatteryAlert
+	if err := json.Unmarshal(frame.Payload, &alert); err != nil {
+		t.Fatalf("decode alert: %v", err)
+	}
+	if alert.ProbeID != "F16R" || alert.Area != "FLOOR16" || alert.Level != 12 || alert.Threshold != 20 {
+		t.Errorf("alert = %+v, want F16R in FLOOR16 at 12 below 20", alert)
+	}
+}
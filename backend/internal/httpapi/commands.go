@@ -0,0 +1,200 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errCommandNotFound = errors.New("command not found")
+
+// Command lifecycle states
+const (
+	CommandQueued    = "queued"    // Waiting for the probe to poll
+	CommandDelivered = "delivered" // Pulled by the probe, not yet confirmed
+	CommandAcked     = "acked"     // Probe confirmed it executed the command
+	CommandExpired   = "expired"   // Not pulled before its TTL ran out, so never delivered
+)
+
+// Command is a single command sent to a probe and its delivery state
+type Command struct {
+	ID          string     `json:"commandId"`
+	ProbeID     string     `json:"probeId"` // Empty for the default queue
+	Command     string     `json:"command"`
+	Status      string     `json:"status"`
+	Result      string     `json:"result,omitempty"` // Reported by the probe on ack
+	QueuedAt    time.Time  `json:"queuedAt"`
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+	AckedAt     *time.Time `json:"ackedAt,omitempty"`
+	ExpiredAt   *time.Time `json:"expiredAt,omitempty"`
+}
+
+// CommandQueue holds pending commands per probe, delivered first in first out
+// Commands queued without a probe ID go to the default queue, which is what
+// probes polling without a probe ID receive
+// A command not pulled within the TTL expires, so a probe coming back online
+// doesn't execute something queued long ago
+type CommandQueue struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	queues   map[string][]string // probeID -> pending command IDs ("" is the default queue)
+	commands map[string]*Command // commandID -> command, kept after delivery for status lookups until pruned
+	counter  int64
+	expired  int64 // Commands that expired unclaimed since startup
+}
+
+// NewCommandQueue creates an empty command queue whose commands expire after ttl
+func NewCommandQueue(ttl time.Duration) *CommandQueue {
+	return &CommandQueue{
+		ttl:      ttl,
+		queues:   make(map[string][]string),
+		commands: make(map[string]*Command),
+	}
+}
+
+// normalizeCommandProbeID maps a probe ID onto its queue key
+func normalizeCommandProbeID(probeID string) string {
+	return strings.ToUpper(strings.TrimSpace(probeID))
+}
+
+// Enqueue adds a command to the end of a probe's queue
+func (cq *CommandQueue) Enqueue(probeID, cmd string) Command {
+	probeID = normalizeCommandProbeID(probeID)
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	cq.counter++
+	c := &Command{
+		ID:       fmt.Sprintf("cmd-%d", cq.counter),
+		ProbeID:  probeID,
+		Command:  cmd,
+		Status:   CommandQueued,
+		QueuedAt: time.Now(),
+	}
+	cq.commands[c.ID] = c
+	cq.queues[probeID] = append(cq.queues[probeID], c.ID)
+	return *c
+}
+
+// Dequeue removes the next command from a probe's queue and marks it delivered
+func (cq *CommandQueue) Dequeue(probeID string) (Command, bool) {
+	probeID = normalizeCommandProbeID(probeID)
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	now := time.Now()
+	cq.expireLocked(probeID, now)
+	queue := cq.queues[probeID]
+	if len(queue) == 0 {
+		return Command{}, false
+	}
+	if len(queue) == 1 {
+		delete(cq.queues, probeID)
+	} else {
+		cq.queues[probeID] = queue[1:]
+	}
+
+	c := cq.commands[queue[0]]
+	c.Status = CommandDelivered
+	c.DeliveredAt = &now
+	return *c, true
+}
+
+// Ack records that a probe executed a delivered command
+// Returns an error if the command is unknown or hasn't been delivered yet
+func (cq *CommandQueue) Ack(commandID, result string) (Command, error) {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	c, ok := cq.commands[strings.TrimSpace(commandID)]
+	if !ok {
+		return Command{}, errCommandNotFound
+	}
+	if c.Status != CommandDelivered {
+		return *c, fmt.Errorf("command %s is %s, not %s", c.ID, c.Status, CommandDelivered)
+	}
+	now := time.Now()
+	c.Status = CommandAcked
+	c.Result = result
+	c.AckedAt = &now
+	return *c, nil
+}
+
+// Get returns a command by ID
+func (cq *CommandQueue) Get(commandID string) (Command, bool) {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	c, ok := cq.commands[strings.TrimSpace(commandID)]
+	if !ok {
+		return Command{}, false
+	}
+	return *c, true
+}
+
+// expireLocked expires the commands at the front of a probe's queue that have outlived the TTL
+// Commands are queued in order with the same TTL, so the expired ones are always at the front
+// Must be called with cq.mu held
+func (cq *CommandQueue) expireLocked(probeID string, now time.Time) {
+	queue := cq.queues[probeID]
+	n := 0
+	for n < len(queue) && now.Sub(cq.commands[queue[n]].QueuedAt) >= cq.ttl {
+		c := cq.commands[queue[n]]
+		c.Status = CommandExpired
+		c.ExpiredAt = &now
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	cq.expired += int64(n)
+	if n == len(queue) {
+		delete(cq.queues, probeID)
+	} else {
+		cq.queues[probeID] = queue[n:]
+	}
+}
+
+// Expired returns how many commands expired unclaimed since startup
+func (cq *CommandQueue) Expired() int64 {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+	return cq.expired
+}
+
+// PruneOlderThan forgets finished commands, returning how many were removed
+// Queued commands past the TTL are expired first, so probes that stopped polling don't keep them
+// Acked and expired commands are removed once they finished before cutoff, and commands
+// delivered before cutoff that were never acked are given up on
+func (cq *CommandQueue) PruneOlderThan(cutoff time.Time) int {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	now := time.Now()
+	for probeID := range cq.queues {
+		cq.expireLocked(probeID, now)
+	}
+
+	removed := 0
+	for id, c := range cq.commands {
+		finished := c.Status == CommandAcked && c.AckedAt.Before(cutoff) ||
+			c.Status == CommandDelivered && c.DeliveredAt.Before(cutoff) ||
+			c.Status == CommandExpired && c.ExpiredAt.Before(cutoff)
+		if finished {
+			delete(cq.commands, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Pending returns how many commands are waiting for a probe
+func (cq *CommandQueue) Pending(probeID string) int {
+	probeID = normalizeCommandProbeID(probeID)
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+	cq.expireLocked(probeID, time.Now())
+	return len(cq.queues[probeID])
+}
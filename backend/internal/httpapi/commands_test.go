@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestCommandQueuePruneOlderThan(t *testing.T) {
+	cq := NewCommandQueue(time.Hour)
+	acked := cq.Enqueue("F16R", "reboot")
+	delivered := cq.Enqueue("F16R", "calibrate")
+	queued := cq.Enqueue("F17R", "reboot")
+
+	cq.Dequeue("F16R")
+	cq.Dequeue("F16R")
+	if _, err := cq.Ack(acked.ID, "ok"); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+
+	// Nothing has finished before a cutoff in the past
+	if removed := cq.PruneOlderThan(time.Now().Add(-time.Hour)); removed != 0 {
+		t.Errorf("pruned %d commands before the cutoff, want 0", removed)
+	}
+	if removed := cq.PruneOlderThan(time.Now().Add(time.Second)); removed != 2 {
+		t.Errorf("pruned %d commands, want 2", removed)
+	}
+	for _, id := range []string{acked.ID, delivered.ID} {
+		if _, ok := cq.Get(id); ok {
+			t.Errorf("command %s kept after pruning", id)
+		}
+	}
+	if _, ok := cq.Get(queued.ID); !ok {
+		t.Errorf("queued command %s was pruned before delivery", queued.ID)
+	}
+}
+
+func TestCommandQueueExpiresUnclaimedCommands(t *testing.T) {
+	cq := NewCommandQueue(20 * time.Millisecond)
+	stale := cq.Enqueue("F16R", "reboot")
+	time.Sleep(30 * time.Millisecond)
+	fresh := cq.Enqueue("F16R", "calibrate")
+
+	if pending := cq.Pending("F16R"); pending != 1 {
+		t.Errorf("pending = %d, want 1 once the stale command expired", pending)
+	}
+	delivered, ok := cq.Dequeue("F16R")
+	if !ok || delivered.ID != fresh.ID {
+		t.Errorf("Dequeue = %+v, %v; want the fresh command %s", delivered, ok, fresh.ID)
+	}
+	if c, _ := cq.Get(stale.ID); c.Status != CommandExpired || c.ExpiredAt == nil {
+		t.Errorf("stale command = %+v, want status expired", c)
+	}
+	if expired := cq.Expired(); expired != 1 {
+		t.Errorf("Expired() = %d, want 1", expired)
+	}
+	if _, err := cq.Ack(stale.ID, "ok"); err == nil {
+		t.Error("acking an expired command succeeded")
+	}
+}
+
+func TestSendCommandExpiresBeforePoll(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.CommandTTLSeconds = 1
+	})
+	expectStatus(t, serve(rt, "POST", "/api/sendcommand", `{"probeId":"F16R","command":"reboot"}`, nil), http.StatusOK)
+	time.Sleep(1100 * time.Millisecond)
+
+	rec := serve(rt, "GET", "/api/sendcommand?probeId=F16R", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var resp struct {
+		Available bool `json:"available"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Available {
+		t.Errorf("response = %s, want available:false after the TTL", rec.Body)
+	}
+}
@@ -0,0 +1,178 @@
+package httpapi
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compress gzips responses for clients that send Accept-Encoding: gzip
+// Bodies under cfg.CompressMinBytes go out as-is, since gzip would only make them bigger;
+// the WebSocket and SSE streams are never compressed
+func (r *router) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/ws" || req.URL.Path == "/api/stream" || req.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: r.cfg.CompressMinBytes}
+		defer gw.close()
+		next.ServeHTTP(gw, req)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, "gzip") && coding != "*" {
+			continue
+		}
+		// gzip;q=0 explicitly refuses it
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the header and the start of the body until it knows
+// whether the response is big enough to compress
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int          // Held until the header is sent; 0 if the handler hasn't set one
+	buf     []byte       // Body written before the decision
+	started bool         // Header sent
+	gz      *gzip.Writer // Non-nil when the body is being compressed
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if gw.started || gw.status != 0 {
+		return
+	}
+	// Informational responses don't end the header, so pass them straight through
+	if status >= 100 && status < 200 {
+		gw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	gw.status = status
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if gw.started {
+		if gw.gz != nil {
+			return gw.gz.Write(p)
+		}
+		return gw.ResponseWriter.Write(p)
+	}
+	gw.buf = append(gw.buf, p...)
+	if len(gw.buf) >= gw.minSize {
+		if err := gw.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start sends the header, switching to gzip if the held body is big enough and not already compressed,
+// then writes out the held body
+func (gw *gzipResponseWriter) start() error {
+	gw.started = true
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+	h := gw.Header()
+	if len(gw.buf) >= gw.minSize && compressible(h, gw.status) {
+		// Sniff the type from the plain body; net/http would otherwise sniff the gzip bytes
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(gw.buf))
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		// The compressed bytes differ from the ones a strong ETag names; etagMatches ignores W/
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if gw.gz != nil {
+		_, err := gw.gz.Write(buf)
+		return err
+	}
+	_, err := gw.ResponseWriter.Write(buf)
+	return err
+}
+
+// compressible reports whether a response may be gzipped
+func compressible(h http.Header, status int) bool {
+	if status == http.StatusNoContent || status == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, skip := range []string{"image/", "video/", "audio/", "text/event-stream", "zip", "compress"} {
+		if strings.Contains(contentType, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush sends whatever has been written so far, deciding on compression early if it must
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.started {
+		gw.start()
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close sends a body that never reached the threshold and finishes the gzip stream
+func (gw *gzipResponseWriter) close() {
+	if !gw.started {
+		gw.start()
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+// Hijack passes through to the underlying writer; upgraded connections skip compression anyway
+func (gw *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := gw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	// The connection is the caller's now, so close must not send a header on it
+	gw.started = true
+	return hijacker.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestCompressLargeResponse(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	for i := range 200 {
+		rt.r.messageStore.AddMessage(fmt.Sprintf("F16R co2=%d,temp=25.5,hum=36.2", 400+i))
+	}
+
+	plain := serve(rt, "GET", "/api/export/csv", "", nil)
+	expectStatus(t, plain, 200)
+	if enc := plain.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("Content-Encoding without Accept-Encoding = %q", enc)
+	}
+
+	rec := serve(rt, "GET", "/api/export/csv", "", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	expectStatus(t, rec, 200)
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", enc)
+	}
+	if got, want := rec.Header().Get("Content-Type"), plain.Header().Get("Content-Type"); got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if vary := rec.Header().Values("Vary"); !containsFold(vary, "Accept-Encoding") {
+		t.Errorf("Vary = %v, want Accept-Encoding", vary)
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if string(body) != plain.Body.String() {
+		t.Errorf("decompressed body differs from the plain response:\n%s\nwant:\n%s", body, plain.Body.String())
+	}
+}
+
+func TestCompressSkipsSmallResponses(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.CompressMinBytes = 4096
+	})
+
+	rec := serve(rt, "GET", "/api/version", "", map[string]string{"Accept-Encoding": "gzip"})
+	expectStatus(t, rec, 200)
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Content-Encoding = %q for a small response, want none", enc)
+	}
+	if body := rec.Body.String(); body == "" || body[0] != '{' {
+		t.Errorf("body = %q, want the plain JSON", body)
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := []struct {
+		contentType, contentEncoding string
+		status                       int
+		want                         bool
+	}{
+		{"application/json", "", 200, true},
+		{"text/csv", "", 200, true},
+		{"application/gzip", "", 200, false},
+		{"image/png", "", 200, false},
+		{"text/event-stream", "", 200, false},
+		{"application/json", "br", 200, false},
+		{"", "", http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.contentType != "" {
+			h.Set("Content-Type", tt.contentType)
+		}
+		if tt.contentEncoding != "" {
+			h.Set("Content-Encoding", tt.contentEncoding)
+		}
+		if got := compressible(h, tt.status); got != tt.want {
+			t.Errorf("compressible(%q, %q, %d) = %v, want %v", tt.contentType, tt.contentEncoding, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                     false,
+		"gzip":                 true,
+		"deflate, GZIP":        true,
+		"br;q=1.0, gzip;q=0.5": true,
+		"gzip;q=0":             false,
+		"*":                    true,
+		"identity":             false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+// containsFold reports whether any comma-separated entry in values matches want, ignoring case
+func containsFold(values []string, want string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestConfigRedactsAccessKey(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "s3cret"
+	})
+
+	rec := serve(rt, "GET", "/api/config", "", map[string]string{"X-Access-Key": "s3cret"})
+	expectStatus(t, rec, http.StatusOK)
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["accessKey"] != redacted {
+		t.Errorf("accessKey = %v, want %q", got["accessKey"], redacted)
+	}
+	if _, ok := got["messageStoreSize"]; !ok {
+		t.Errorf("messageStoreSize missing from %s", rec.Body)
+	}
+	if _, ok := got["AccessKey"]; ok {
+		t.Errorf("response uses Go field names: %s", rec.Body)
+	}
+}
+
+func TestConfigShowsEmptyAccessKey(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = ""
+	})
+
+	rec := serve(rt, "GET", "/api/config", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var got configResponse
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if got.AccessKey != "" {
+		t.Errorf("accessKey = %q, want empty when unset", got.AccessKey)
+	}
+}
+
+// Settings where 0 turns a feature off accept an explicit 0 without falling back to the default
+func TestConfigAcceptsZeroToDisable(t *testing.T) {
+	t.Setenv("AGE_RETENTION_SECONDS", "0")
+	t.Setenv("INGEST_RATE_LIMIT", "0")
+	logs := captureLogs(t)
+
+	cfg := config.Load()
+	if cfg.AgeRetentionSeconds != 0 || cfg.IngestRateLimit != 0 {
+		t.Errorf("AgeRetentionSeconds = %d, IngestRateLimit = %d; want both 0", cfg.AgeRetentionSeconds, cfg.IngestRateLimit)
+	}
+	if out := logs.String(); strings.Contains(out, "invalid value") {
+		t.Errorf("explicit 0 was logged as invalid: %s", out)
+	}
+
+	// Negative values are still refused
+	t.Setenv("INGEST_RATE_LIMIT", "-5")
+	if cfg := config.Load(); cfg.IngestRateLimit != 0 {
+		t.Errorf("IngestRateLimit = %d for -5, want the default 0", cfg.IngestRateLimit)
+	}
+	if out := logs.String(); !strings.Contains(out, "INGEST_RATE_LIMIT") {
+		t.Errorf("negative value wasn't warned about: %s", out)
+	}
+}
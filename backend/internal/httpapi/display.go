@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AreaDisplay is how the dashboard presents an area
+type AreaDisplay struct {
+	Color string `json:"color"` // CSS color, e.g. "#1f77b4"
+	Order int    `json:"order"` // Sort position on the dashboard
+	Icon  string `json:"icon"`
+}
+
+// DisplayConfigStore stores per-area display settings
+type DisplayConfigStore struct {
+	mu      sync.RWMutex
+	configs map[string]AreaDisplay // area -> display settings
+	path    string                 // Optional JSON file the settings are persisted to
+}
+
+// displayConfigPath places the display settings next to the area file,
+// e.g. /data/areas.json -> /data/areas.display.json
+func displayConfigPath(areaStorePath string) string {
+	if areaStorePath == "" {
+		return ""
+	}
+	ext := filepath.Ext(areaStorePath)
+	return strings.TrimSuffix(areaStorePath, ext) + ".display.json"
+}
+
+// NewDisplayConfigStore creates a display config store, loading saved settings from path if set
+func NewDisplayConfigStore(path string) *DisplayConfigStore {
+	ds := &DisplayConfigStore{
+		configs: make(map[string]AreaDisplay),
+		path:    path,
+	}
+	if path == "" {
+		return ds
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ds
+	}
+	if err != nil {
+		log.Printf("display config: read %s: %v", path, err)
+		return ds
+	}
+	if err := json.Unmarshal(data, &ds.configs); err != nil {
+		log.Printf("display config: parse %s: %v", path, err)
+		ds.configs = make(map[string]AreaDisplay)
+	}
+	return ds
+}
+
+// Get returns the display settings for an area
+func (ds *DisplayConfigStore) Get(area string) (AreaDisplay, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	display, ok := ds.configs[area]
+	return display, ok
+}
+
+// Set replaces the display settings for an area and writes them to disk
+// Display edits are rare, so they are written immediately rather than debounced
+func (ds *DisplayConfigStore) Set(area string, display AreaDisplay) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.configs[area] = display
+	if ds.path == "" {
+		return nil
+	}
+	return writeJSONFile(ds.path, ds.configs)
+}
+
+// handleAreaDisplay gets or replaces an area's display settings
+func (r *router) handleAreaDisplay(w http.ResponseWriter, req *http.Request, areaName string) {
+	// Only areas the area store knows about can be configured
+	area := r.normalizer.normalizeArea(areaName)
+	if _, ok := r.areaStore.GetLocations(area); !ok {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Method == "GET" {
+		display, _ := r.displayStore.Get(area)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"area":    area,
+			"display": display,
+		})
+		return
+	}
+
+	if req.Method == "PUT" {
+		var display AreaDisplay
+		if err := json.NewDecoder(req.Body).Decode(&display); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		display.Color = strings.TrimSpace(display.Color)
+		display.Icon = strings.TrimSpace(display.Icon)
+
+		if err := r.displayStore.Set(area, display); err != nil {
+			log.Printf("display config: save %s: %v", r.displayStore.path, err)
+			http.Error(w, "failed to save display config", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"area":    area,
+			"display": display,
+		})
+		return
+	}
+
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
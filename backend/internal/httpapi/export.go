@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleExportCSV streams stored messages as CSV: id,timestamp,probeId,rawData followed by one column per metric
+// An optional area query parameter restricts rows to probes assigned to that area
+func (r *router) handleExportCSV(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Resolve the set of probes in the requested area, if any
+	var areaProbes map[string]bool
+	if area := req.URL.Query().Get("area"); area != "" {
+		locations, ok := r.areaStore.GetLocations(area)
+		if !ok {
+			http.Error(w, "area not found", http.StatusNotFound)
+			return
+		}
+		areaProbes = make(map[string]bool, len(locations))
+		for _, loc := range locations {
+			areaProbes[strings.ToUpper(loc.ProbeID)] = true
+		}
+	}
+
+	// First pass: collect the metric columns for the header
+	messages := r.messageStore.GetMessages()
+	metricSet := make(map[string]bool)
+	for _, msg := range messages {
+		probeID, metrics, _ := parseMetrics(msg.Data, r.cfg.MaxProbeIDLength)
+		if areaProbes != nil && !areaProbes[strings.ToUpper(probeID)] {
+			continue
+		}
+		for metric := range metrics {
+			metricSet[metric] = true
+		}
+	}
+	metricColumns := make([]string, 0, len(metricSet))
+	for metric := range metricSet {
+		metricColumns = append(metricColumns, metric)
+	}
+	sort.Strings(metricColumns)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="probedata.csv"`)
+
+	// Second pass: stream rows, flushing periodically so large stores aren't buffered
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"id", "timestamp", "probeId", "rawData"}, metricColumns...))
+	record := make([]string, 4+len(metricColumns))
+	written := 0
+	for _, msg := range messages {
+		probeID, metrics, _ := parseMetrics(msg.Data, r.cfg.MaxProbeIDLength)
+		if areaProbes != nil && !areaProbes[strings.ToUpper(probeID)] {
+			continue
+		}
+		record[0] = msg.ID
+		record[1] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+		record[2] = probeID
+		record[3] = msg.Data
+		for j, metric := range metricColumns {
+			record[4+j] = ""
+			if v, ok := metrics[metric]; ok {
+				record[4+j] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return // Client went away
+		}
+		written++
+		if written%500 == 0 {
+			cw.Flush()
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+	}
+	cw.Flush()
+}
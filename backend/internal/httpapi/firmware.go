@@ -0,0 +1,181 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// splitProbeFirmware removes an fw=<version> token from probe data, returning the data without it
+// and the reported version, or "" if there was none
+// The token may appear anywhere among the metrics; versions aren't numbers, so left in place
+// it would be skipped as a malformed metric (and rejected by STRICT_PROBE_DATA)
+func splitProbeFirmware(data string, maxIDLength int) (stripped, firmware string) {
+	return splitProbeToken(data, maxIDLength, "fw", nil)
+}
+
+// splitProbeToken removes every name=<value> token among the metrics in probe data,
+// returning the data without them and the last trimmed value, or "" if there was none
+// If valid is set, a token whose value it rejects is left in place
+func splitProbeToken(data string, maxIDLength int, name string, valid func(value string) bool) (stripped, value string) {
+	probeID, rest, err := splitProbeID(data, maxIDLength)
+	if err != nil {
+		return data, ""
+	}
+	tokens := strings.Split(rest, ",")
+	kept := tokens[:0]
+	found := false
+	for _, token := range tokens {
+		key, v, ok := strings.Cut(token, "=")
+		if ok && strings.ToLower(strings.TrimSpace(key)) == name {
+			v = strings.TrimSpace(v)
+			if valid == nil || valid(v) {
+				value, found = v, true
+				continue
+			}
+		}
+		kept = append(kept, token)
+	}
+	if !found {
+		return data, ""
+	}
+	return probeID + " " + strings.TrimLeftFunc(strings.Join(kept, ","), unicode.IsSpace), value
+}
+
+// firmwareReport is the last firmware version a probe reported
+type firmwareReport struct {
+	version    string
+	reportedAt time.Time
+}
+
+// FirmwareStore tracks the latest firmware version reported by each probe
+type FirmwareStore struct {
+	mu       sync.RWMutex
+	firmware map[string]firmwareReport // probeID -> latest report
+}
+
+// NewFirmwareStore creates a new firmware store
+func NewFirmwareStore() *FirmwareStore {
+	return &FirmwareStore{
+		firmware: make(map[string]firmwareReport),
+	}
+}
+
+// Set records the firmware version a probe reported at the given time
+func (fs *FirmwareStore) Set(probeID, version string, t time.Time) {
+	probeID = strings.TrimSpace(probeID)
+	if probeID == "" || version == "" {
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.firmware[probeID] = firmwareReport{version: version, reportedAt: t}
+}
+
+// Get returns the firmware version a probe last reported
+func (fs *FirmwareStore) Get(probeID string) (string, bool) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	report, ok := fs.firmware[strings.TrimSpace(probeID)]
+	return report.version, ok
+}
+
+// Rename moves a probe's firmware version to a new probe ID
+func (fs *FirmwareStore) Rename(oldID, newID string) {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	report, ok := fs.firmware[oldID]
+	if !ok {
+		return
+	}
+	delete(fs.firmware, oldID)
+	fs.firmware[newID] = report
+}
+
+// all returns a copy of every probe's latest report
+func (fs *FirmwareStore) all() map[string]firmwareReport {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	result := make(map[string]firmwareReport, len(fs.firmware))
+	for probeID, report := range fs.firmware {
+		result[probeID] = report
+	}
+	return result
+}
+
+// compareVersions orders dotted version strings such as "1.10.2" and "v1.9", returning -1, 0, or 1
+// Numeric parts compare as numbers and anything else as text; a missing part counts as 0
+func compareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(strings.ToLower(a), "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(strings.ToLower(b), "v"), ".")
+	for i := range max(len(partsA), len(partsB)) {
+		partA, partB := "0", "0"
+		if i < len(partsA) {
+			partA = partsA[i]
+		}
+		if i < len(partsB) {
+			partB = partsB[i]
+		}
+		numA, errA := strconv.Atoi(partA)
+		numB, errB := strconv.Atoi(partB)
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case partA != partB:
+			if partA < partB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// handleProbeFirmware lists the firmware version each probe last reported, sorted by probe ID
+// Probes below MIN_FIRMWARE_VERSION are flagged as outdated
+func (r *router) handleProbeFirmware(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type firmwareEntry struct {
+		ProbeID    string    `json:"probeId"`
+		Firmware   string    `json:"firmware"`
+		ReportedAt time.Time `json:"reportedAt"` // When this version was last reported
+		LastSeen   time.Time `json:"lastSeen"`   // When the probe last reported anything
+		Outdated   bool      `json:"outdated"`
+	}
+
+	entries := []firmwareEntry{}
+	for probeID, report := range r.firmwareStore.all() {
+		entry := firmwareEntry{
+			ProbeID:    probeID,
+			Firmware:   report.version,
+			ReportedAt: report.reportedAt,
+			LastSeen:   report.reportedAt,
+			Outdated:   r.cfg.MinFirmwareVersion != "" && compareVersions(report.version, r.cfg.MinFirmwareVersion) < 0,
+		}
+		if lastSeen, ok := r.lastSeenStore.LastSeen(probeID); ok {
+			entry.LastSeen = lastSeen
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ProbeID < entries[j].ProbeID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestSplitProbeFirmware(t *testing.T) {
+	tests := []struct {
+		data, wantData, wantFirmware string
+	}{
+		{"F16R fw=1.4.2,co2=454", "F16R co2=454", "1.4.2"},
+		{"F16R co2=454, FW=v2.0 ,temp=25", "F16R co2=454,temp=25", "v2.0"},
+		{"F16R co2=454", "F16R co2=454", ""},
+		{"F16R fw=1.0", "F16R ", "1.0"},
+		{"F16R", "F16R", ""},
+	}
+	for _, tt := range tests {
+		data, firmware := splitProbeFirmware(tt.data, 8)
+		if data != tt.wantData || firmware != tt.wantFirmware {
+			t.Errorf("splitProbeFirmware(%q) = %q, %q; want %q, %q", tt.data, data, firmware, tt.wantData, tt.wantFirmware)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.10", "1.9", 1},
+		{"v1.2", "1.2.0", 0},
+		{"1.2", "1.2.1", -1},
+		{"2.0-beta", "2.0-rc", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestProbeFirmwareReport(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.MinFirmwareVersion = "1.10"
+		cfg.StrictProbeData = true
+		cfg.TrustProbeTimestamps = true
+	})
+
+	// The fw token is accepted in strict mode and doesn't hide a ts token behind it
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R fw=1.9.4,ts=1700000000,co2=454", nil), 200)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F15R co2=500,fw=1.12", nil), 200)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F12R co2=410", nil), 200)
+
+	msgs := rt.r.messageStore.GetMessages()
+	if len(msgs) != 3 || msgs[0].Data != "F16R co2=454" || !msgs[0].Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("stored messages = %+v, want fw and ts stripped from the first", msgs)
+	}
+	if reading, ok := rt.r.readingStore.GetReading("F15R"); !ok || len(reading.Metrics) != 1 {
+		t.Errorf("F15R reading = %+v, want only co2", reading)
+	}
+
+	rec := serve(rt, "GET", "/api/probes/firmware", "", nil)
+	expectStatus(t, rec, 200)
+	var got []struct {
+		ProbeID  string    `json:"probeId"`
+		Firmware string    `json:"firmware"`
+		LastSeen time.Time `json:"lastSeen"`
+		Outdated bool      `json:"outdated"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("firmware = %+v, want F15R and F16R", got)
+	}
+	if got[0].ProbeID != "F15R" || got[0].Firmware != "1.12" || got[0].Outdated {
+		t.Errorf("F15R = %+v, want 1.12, not outdated", got[0])
+	}
+	if got[1].ProbeID != "F16R" || got[1].Firmware != "1.9.4" || !got[1].Outdated || got[1].LastSeen.IsZero() {
+		t.Errorf("F16R = %+v, want 1.9.4, outdated", got[1])
+	}
+}
@@ -1,13 +1,24 @@
 package httpapi
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,8 +26,8 @@ import (
 )
 
 type probeAssignment struct {
-	Area     string
-	Location string
+	Area     string `json:"area"`
+	Location string `json:"location"`
 }
 
 var fixedProbeAssignments = map[string]probeAssignment{
@@ -35,48 +46,182 @@ var fixedProbeAssignments = map[string]probeAssignment{
 	"POOL": {Area: "POOL", Location: "LINE"},
 }
 
+// loadProbeAssignments returns the built-in probe assignments merged with those in the file at path
+// Format: {"F14R":{"area":"FLOOR14","location":"ROTUNDA"}, ...}
+// A missing or malformed file leaves the built-in assignments in place
+func loadProbeAssignments(path string) map[string]probeAssignment {
+	assignments := make(map[string]probeAssignment, len(fixedProbeAssignments))
+	for id, assignment := range fixedProbeAssignments {
+		assignments[id] = assignment
+	}
+	if path == "" {
+		return assignments
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("probe assignments: %s not found, using built-in defaults", path)
+		return assignments
+	}
+	if err != nil {
+		log.Printf("probe assignments: read %s: %v", path, err)
+		return assignments
+	}
+
+	var fromFile map[string]probeAssignment
+	if err := json.Unmarshal(data, &fromFile); err != nil {
+		log.Printf("probe assignments: parse %s: %v", path, err)
+		return assignments
+	}
+	for id, assignment := range fromFile {
+		id = strings.ToUpper(strings.TrimSpace(id))
+		area := strings.ToUpper(strings.TrimSpace(assignment.Area))
+		location := strings.ToUpper(strings.TrimSpace(assignment.Location))
+		if id == "" || area == "" || location == "" {
+			log.Printf("probe assignments: skipping incomplete entry %q", id)
+			continue
+		}
+		assignments[id] = probeAssignment{Area: area, Location: location}
+	}
+	return assignments
+}
+
 type router struct {
-	cfg                  config.Config
-	mux                  *http.ServeMux
-	messageStore         *MessageStore
-	areaStore            *AreaStore
-	statsStore           *StatsStore
-	thresholdStore       *ThresholdStore
-	pixelStore           *PixelStore
-	upgrader             websocket.Upgrader
-	probeRefreshInterval int // Probe refresh interval in seconds
-	pixelLastUpdated     time.Time
-	sendCommandValue     string
-	sendCommandReceived  bool
-}
-
-func NewRouter(cfg config.Config) *http.ServeMux {
-	msgStore := NewMessageStore(5000)
-	areaStore := NewAreaStore()
+	cfg              config.Config
+	mux              *http.ServeMux
+	accessKeys       []accessKey                // Every key accepted in X-Access-Key; none means auth is off
+	probeAssignments map[string]probeAssignment // Fixed probe ID -> area/location
+	probeIDRules     []probeIDRule              // Configured patterns tried before the built-in ones
+	severityMap      map[string]bandStyle       // Threshold band -> label and color, read-only after startup
+	messageStore     *MessageStore
+	areaStore        *AreaStore
+	normalizer       *nameNormalizer // Shared with areaStore
+	assignmentLog    *AssignmentLog
+	displayStore     *DisplayConfigStore
+	statsStore       *StatsStore
+	thresholdStore   *ThresholdStore
+	pixelStore       *PixelStore
+	readingStore     *ReadingStore
+	lastSeenStore    *LastSeenStore
+	firmwareStore    *FirmwareStore
+	batteryStore     *BatteryStore
+	activityStore    *ActivityStore
+	historyStore     *HistoryStore
+	metrics          serverMetrics
+	done             chan struct{} // Closed on shutdown to stop background goroutines
+	broadcastRunning atomic.Bool   // Reported by the readiness check
+	bandTracker      *bandTracker
+	breachCounter    *breachCounter
+	upgrader         websocket.Upgrader
+	probeConfig      *ProbeConfigStore
+	areaOrder        *AreaOrderStore
+	commandQueue     *CommandQueue
+	idempotencyStore *idempotencyStore
+	ingestLimiter    *rateLimiter // nil when INGEST_RATE_LIMIT is unset
+	simulator        *simulator
+	snapshotCache    *snapshotCache
+}
+
+// Router is the API handler returned by NewRouter
+type Router struct {
+	http.Handler
+	r        *router
+	stopOnce sync.Once
+}
+
+// Stop ends the long-lived connections and background goroutines: it closes all WebSocket
+// connections and makes /api/stream handlers return, so http.Server.Shutdown doesn't wait on them
+// Register it with http.Server.RegisterOnShutdown; it is safe to call more than once
+func (rt *Router) Stop() {
+	rt.stopOnce.Do(func() {
+		close(rt.r.done)
+		// Tell clients this is planned, so they wait and reconnect rather than treating it as a failure
+		reason := wsCloseReason{Reason: "server shutting down", RetryAfter: rt.r.cfg.WSRetryAfterSeconds}
+		for _, client := range rt.r.messageStore.snapshotClients() {
+			rt.r.messageStore.removeClient(client.conn)
+			client.close(websocket.CloseServiceRestart, reason)
+		}
+	})
+}
+
+// Shutdown calls Stop, then flushes the message log, area file, and assignment log
+// Call it after the HTTP server has stopped, so no in-flight request writes to a closed store
+func (rt *Router) Shutdown() {
+	rt.Stop()
+	rt.r.messageStore.Close()
+	rt.r.areaStore.Close()
+	rt.r.assignmentLog.Close()
+}
+
+// NewRouter builds the API handler, wrapped with CORS and request logging
+func NewRouter(cfg config.Config) *Router {
+	msgStore := NewMessageStore(cfg.MessageStoreSize, cfg.MessageLogPath, cfg.BroadcastBuffer)
+	msgStore.idScheme = cfg.MessageIDScheme
+	msgStore.compact = cfg.CompactDuplicateMessages
+	// In reject mode longer data never reaches the store, but a raw payload still might
+	msgStore.maxDataLength = cfg.MessageMaxLength
+	normalizer := newNameNormalizer(cfg.AreaAliases, cfg.LocationAliases)
+	areaStore := NewAreaStore(cfg.AreaStorePath, cfg.PredefinedAreas, normalizer)
 	statsStore := NewStatsStore()
 	thresholdStore := NewThresholdStore()
-	pixelStore := NewPixelStore()
+	pixelStore := NewPixelStore(cfg.PixelMax)
+	readingStore := NewReadingStore()
+	lastSeenStore := NewLastSeenStore()
+	historyStore := NewHistoryStore(cfg.HistorySize, cfg.HistoryMaxMetrics, anomalyDetector{
+		window:    cfg.AnomalyWindow,
+		minPoints: cfg.AnomalyMinPoints,
+		threshold: cfg.AnomalyZThreshold,
+	})
 	r := &router{
-		cfg:            cfg,
-		mux:            http.NewServeMux(),
-		messageStore:   msgStore,
-		areaStore:      areaStore,
-		statsStore:     statsStore,
-		thresholdStore: thresholdStore,
-		pixelStore:     pixelStore,
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for now
-			},
-		},
-		probeRefreshInterval: 60, // Default 10 seconds
-		pixelLastUpdated:     time.Time{},
-		sendCommandValue:     "",
-		sendCommandReceived:  true,
+		cfg:              cfg,
+		mux:              http.NewServeMux(),
+		accessKeys:       parseAccessKeys(cfg.AccessKey, cfg.AccessKeys),
+		probeAssignments: loadProbeAssignments(cfg.ProbeAssignmentsPath),
+		probeIDRules:     loadProbeIDRules(cfg.ProbeIDRulesPath),
+		severityMap:      loadSeverityMap(cfg.SeverityMapPath),
+		messageStore:     msgStore,
+		areaStore:        areaStore,
+		normalizer:       normalizer,
+		assignmentLog:    NewAssignmentLog(cfg.AssignmentLogSize, cfg.AssignmentLogPath),
+		displayStore:     NewDisplayConfigStore(displayConfigPath(cfg.AreaStorePath)),
+		statsStore:       statsStore,
+		thresholdStore:   thresholdStore,
+		pixelStore:       pixelStore,
+		readingStore:     readingStore,
+		lastSeenStore:    lastSeenStore,
+		firmwareStore:    NewFirmwareStore(),
+		batteryStore:     NewBatteryStore(cfg.LowBatteryThreshold),
+		activityStore:    NewActivityStore(cfg.ActivityMaxWindowSeconds),
+		historyStore:     historyStore,
+		bandTracker:      newBandTracker(),
+		breachCounter:    newBreachCounter(),
+		simulator:        newSimulator(),
+		snapshotCache:    &snapshotCache{},
+		done:             make(chan struct{}),
+		upgrader:         websocket.Upgrader{},
+		probeConfig:      NewProbeConfigStore(probeConfigPath(cfg.AreaStorePath), cfg.ProbeRefreshDefault),
+		areaOrder:        NewAreaOrderStore(areaOrderPath(cfg.AreaStorePath)),
+		commandQueue:     NewCommandQueue(time.Duration(cfg.CommandTTLSeconds) * time.Second),
+		idempotencyStore: newIdempotencyStore(time.Duration(cfg.IdempotencyWindowSeconds) * time.Second),
+	}
+	// WebSocket handshakes from browsers follow the same origin allow-list as CORS
+	// Non-browser clients (probes, CLI tools) send no Origin and are always let through
+	r.upgrader.CheckOrigin = func(req *http.Request) bool {
+		origin := req.Header.Get("Origin")
+		return origin == "" || r.originAllowed(origin)
+	}
+	if cfg.ProtectReads && !r.authEnabled() {
+		log.Printf("PROTECT_READS is set without ACCESS_KEY or ACCESS_KEYS; read endpoints stay open")
+	}
+	if cfg.IngestRateLimit > 0 {
+		r.ingestLimiter = newRateLimiter(cfg.IngestRateLimit, cfg.IngestRateBurst, cfg.IngestTrustedCIDR)
 	}
 	r.routes()
+	r.broadcastRunning.Store(true) // Set before serving so an early readiness check doesn't race the goroutine start
 	go r.handleBroadcast()
-	return r.mux
+	go r.runRetentionSweep()
+	go r.runProbeStatusWatcher()
+	return &Router{Handler: logRequests(r.cors(r.compress(r.limitBodies(r.mux)))), r: r}
 }
 
 func (r *router) routes() {
@@ -84,41 +229,111 @@ func (r *router) routes() {
 		w.WriteHeader(200)
 		w.Write([]byte("ok"))
 	})
-	r.mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+	// /livez only shows the process is up; /healthz is the readiness check
+	r.mux.HandleFunc("/livez", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(200)
 		w.Write([]byte("ok"))
 	})
+	r.mux.HandleFunc("/healthz", r.handleReadiness)
 
 	// NEW endpoint for version info
-	r.mux.HandleFunc("/api/version", func(w http.ResponseWriter, _ *http.Request) {
+	r.mux.HandleFunc("/api/version", r.protectReads(func(w http.ResponseWriter, _ *http.Request) {
 		resp := map[string]string{
 			"backend_version": r.cfg.Version,
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
-	})
+	}))
+
+	r.mux.HandleFunc("/api/config", r.requireKey(r.handleConfig))
+	r.mux.HandleFunc("/api/keys", r.requireKey(r.handleAccessKeys))
 
 	// Probe data endpoints - support both /probedata and /api/probedata for compatibility
-	r.mux.HandleFunc("/probedata", r.handleProbeData)
-	r.mux.HandleFunc("/api/probedata", r.handleProbeData)
-	r.mux.HandleFunc("/api/poll", r.handlePoll)
-	r.mux.HandleFunc("/api/clear", r.handleClear)
-	r.mux.HandleFunc("/api/probeconfig", r.handleProbeConfig)
-	r.mux.HandleFunc("/api/areas", r.handleGetAreas)
-	r.mux.HandleFunc("/api/stats", r.handleStats)
-	r.mux.HandleFunc("/api/thresholds/", r.handleThresholds)
-	r.mux.HandleFunc("/api/pixels", r.handlePixels)
-	r.mux.HandleFunc("/api/probes/", r.handleProbes)
-	r.mux.HandleFunc("/api/sendcommand", r.handleSendCommand)
-	r.mux.HandleFunc("/api/sendcommandreceived", r.handleSendCommandReceived)
-	r.mux.HandleFunc("/api/pixeltimestamp", r.handlePixelTimestamp)
-	r.mux.HandleFunc("/ws", r.handleWebSocket)
+	r.mux.HandleFunc("/probedata", r.rateLimit(r.handleProbeData))
+	r.mux.HandleFunc("/api/probedata", r.rateLimit(r.handleProbeData))
+	r.mux.HandleFunc("/api/probedata/batch", r.rateLimit(r.handleProbeDataBatch))
+	r.mux.HandleFunc("/api/poll", r.protectReads(r.handlePoll))
+	r.mux.HandleFunc("/api/clear", r.requireKey(r.handleClear))
+	r.mux.HandleFunc("/api/store/stats", r.protectReads(r.handleStoreStats))
+	r.mux.HandleFunc("/api/messages", r.protectReads(r.handleMessages))
+	r.mux.HandleFunc("/api/messages/", r.protectReads(r.requireKeyForWrites(r.handleMessage)))
+	r.mux.HandleFunc("/api/messages/search", r.protectReads(r.handleMessageSearch))
+	r.mux.HandleFunc("/api/export/csv", r.protectReads(r.handleExportCSV))
+	r.mux.HandleFunc("/api/aggregate", r.protectReads(r.handleAggregate))
+	r.mux.HandleFunc("/api/overview", r.protectReads(r.handleOverview))
+	r.mux.HandleFunc("/api/snapshot", r.protectReads(r.handleSnapshot))
+	r.mux.HandleFunc("/api/schema", r.protectReads(r.handleSchema))
+	// Probes read their config and pull commands without a key, so GETs stay open even with PROTECT_READS
+	r.mux.HandleFunc("/api/probeconfig", r.requireKeyForWrites(r.handleProbeConfig))
+	r.mux.HandleFunc("/api/areas", r.protectReads(r.handleGetAreas))
+	r.mux.HandleFunc("/api/areas/order", r.protectReads(r.requireKeyForWrites(r.handleAreaOrder)))
+	r.mux.HandleFunc("/api/areas/", r.protectReads(r.requireKeyForWrites(r.handleArea)))
+	r.mux.HandleFunc("/api/stats", r.protectGets(r.handleStats))
+	r.mux.HandleFunc("/api/thresholds", r.protectReads(r.requireKeyForWrites(r.handleAllThresholds)))
+	r.mux.HandleFunc("/api/thresholds/", r.protectReads(r.requireKeyForWrites(r.handleThresholds)))
+	r.mux.HandleFunc("/api/thresholds/severity-map", r.protectReads(r.handleSeverityMap))
+	r.mux.HandleFunc("/api/pixels", r.protectGets(r.handlePixels))
+	r.mux.HandleFunc("/api/pixels/history", r.protectReads(r.handlePixelHistory))
+	r.mux.HandleFunc("/api/probes", r.protectReads(r.handleProbeList))
+	r.mux.HandleFunc("/api/probes/", r.probeRoutes())
+	r.mux.HandleFunc("/api/probes/status", r.protectReads(r.handleProbeStatus))
+	r.mux.HandleFunc("/api/probes/firmware", r.protectReads(r.handleProbeFirmware))
+	r.mux.HandleFunc("/api/probes/battery", r.protectReads(r.handleProbeBattery))
+	r.mux.HandleFunc("/api/probes/active", r.protectReads(r.handleActiveProbes))
+	r.mux.HandleFunc("/api/readings/", r.protectReads(r.handleReadings))
+	r.mux.HandleFunc("/api/anomalies", r.protectReads(r.handleAnomalies))
+	r.mux.HandleFunc("/api/sendcommand", r.requireKeyForWrites(r.handleSendCommand))
+	// Probes ack without an access key, the same way they post probe data
+	r.mux.HandleFunc("/api/sendcommand/ack", r.handleSendCommandAck)
+	r.mux.HandleFunc("/api/sendcommand/status", r.protectReads(r.handleSendCommandStatus))
+	r.mux.HandleFunc("/api/sendcommandreceived", r.protectReads(r.handleSendCommandReceived))
+	r.mux.HandleFunc("/api/pixeltimestamp", r.protectReads(r.handlePixelTimestamp))
+	r.mux.HandleFunc("/ws", r.requireKeyOrToken(r.handleWebSocket))
+	r.mux.HandleFunc("/api/ws/clients", r.protectReads(r.handleWSClients))
+	r.mux.HandleFunc("/api/stream", r.requireKeyOrToken(r.handleStream))
+
+	// Synthetic probe data for frontend development; not registered unless explicitly enabled
+	if r.cfg.EnableSimulator {
+		log.Printf("probe simulator enabled at /api/simulate; disable ENABLE_SIMULATOR in production")
+		r.mux.HandleFunc("/api/simulate", r.protectReads(r.requireKeyForWrites(r.handleSimulate)))
+		r.mux.HandleFunc("/api/simulate/", r.requireKey(r.handleSimulateStop))
+	}
+	r.mux.HandleFunc("/metrics", r.protectReads(r.handleMetrics))
+	r.mux.HandleFunc("/api/metrics", r.protectReads(r.handleMetrics))
+	r.mux.HandleFunc("/api/metrics/definitions", r.protectReads(r.handleMetricDefinitions))
 }
 
+// requireKey rejects requests without a valid X-Access-Key header; any configured key is accepted
+// When no access key is configured, all requests are allowed for backward compatibility
+// CORS preflight requests are always allowed since browsers don't send custom headers on them
 func (r *router) requireKey(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
+		if !r.authEnabled() || req.Method == "OPTIONS" {
+			next(w, req)
+			return
+		}
+		if !r.authorize(req, req.Header.Get("X-Access-Key")) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// requireKeyOrToken is requireKey that also accepts the key in the access_key query parameter,
+// since browsers can't set headers on WebSocket handshakes or EventSource requests
+func (r *router) requireKeyOrToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !r.authEnabled() {
+			next(w, req)
+			return
+		}
 		key := req.Header.Get("X-Access-Key")
-		if key == "" || key != r.cfg.AccessKey {
+		if key == "" {
+			key = req.URL.Query().Get("access_key")
+		}
+		if !r.authorize(req, key) {
+			// Rejected before the upgrade, so the client sees a plain 401
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -126,60 +341,604 @@ func (r *router) requireKey(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func (r *router) handleProbeData(w http.ResponseWriter, req *http.Request) {
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.WriteHeader(http.StatusOK)
+// requireKeyForWrites applies requireKey to every method except GET and HEAD
+func (r *router) requireKeyForWrites(next http.HandlerFunc) http.HandlerFunc {
+	protected := r.requireKey(next)
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" || req.Method == "HEAD" {
+			next(w, req)
+			return
+		}
+		protected(w, req)
+	}
+}
+
+// protectReads applies requireKey to every method when PROTECT_READS is on
+// It wraps endpoints whose methods are all reads or already need the key for writes
+func (r *router) protectReads(next http.HandlerFunc) http.HandlerFunc {
+	if !r.cfg.ProtectReads {
+		return next
+	}
+	return r.requireKey(next)
+}
+
+// protectGets applies requireKey to GET and HEAD when PROTECT_READS is on,
+// for endpoints whose writes come from devices without the key
+func (r *router) protectGets(next http.HandlerFunc) http.HandlerFunc {
+	if !r.cfg.ProtectReads {
+		return next
+	}
+	protected := r.requireKey(next)
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" || req.Method == "HEAD" {
+			protected(w, req)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// redacted replaces secret config values so their presence is visible but not their content
+const redacted = "[redacted]"
+
+// configResponse is the configuration served by GET /api/config
+// Fields are listed explicitly, so a new config.Config field stays hidden until it is added here
+type configResponse struct {
+	ServerAddr                   string   `json:"serverAddr"`
+	Version                      string   `json:"version"`
+	AccessKey                    string   `json:"accessKey"`       // "[redacted]" when set
+	AccessKeyLabels              []string `json:"accessKeyLabels"` // Labels of every accepted key; the keys are never shown
+	ProtectReads                 bool     `json:"protectReads"`
+	AllowedOrigins               []string `json:"allowedOrigins"`
+	ShutdownTimeoutSeconds       int      `json:"shutdownTimeoutSeconds"`
+	ReadTimeoutSeconds           int      `json:"readTimeoutSeconds"`
+	WriteTimeoutSeconds          int      `json:"writeTimeoutSeconds"`
+	IdleTimeoutSeconds           int      `json:"idleTimeoutSeconds"`
+	CompressMinBytes             int      `json:"compressMinBytes"`
+	BroadcastBuffer              int      `json:"broadcastBuffer"`
+	WSPingIntervalSeconds        int      `json:"wsPingIntervalSeconds"`
+	WSMaxMessageBytes            int      `json:"wsMaxMessageBytes"`
+	WSRetryAfterSeconds          int      `json:"wsRetryAfterSeconds"`
+	MessageStoreSize             int      `json:"messageStoreSize"`
+	MessageLogPath               string   `json:"messageLogPath"`
+	MessageIDScheme              string   `json:"messageIdScheme"`
+	CompactDuplicateMessages     bool     `json:"compactDuplicateMessages"`
+	MessageMaxLength             int      `json:"messageMaxLength"`
+	MessageOversize              string   `json:"messageOversize"`
+	HistorySize                  int      `json:"historySize"`
+	HistoryMaxMetrics            int      `json:"historyMaxMetrics"`
+	AnomalyWindow                int      `json:"anomalyWindow"`
+	AnomalyMinPoints             int      `json:"anomalyMinPoints"`
+	AnomalyZThreshold            float64  `json:"anomalyZThreshold"`
+	AgeRetentionSeconds          int      `json:"ageRetentionSeconds"`
+	CommandTTLSeconds            int      `json:"commandTtlSeconds"`
+	CommandRetentionSeconds      int      `json:"commandRetentionSeconds"`
+	RetentionSweepSeconds        int      `json:"retentionSweepSeconds"`
+	PollDefaultLength            int      `json:"pollDefaultLength"`
+	PollMaxLength                int      `json:"pollMaxLength"`
+	PollMaxWaitSeconds           int      `json:"pollMaxWaitSeconds"`
+	ProbeStaleSeconds            int      `json:"probeStaleSeconds"`
+	ProbeRefreshDefault          int      `json:"probeRefreshDefault"`
+	ActivityMaxWindowSeconds     int      `json:"activityMaxWindowSeconds"`
+	ProbeStatusCheckSeconds      int      `json:"probeStatusCheckSeconds"`
+	ProbeStatusHysteresisSeconds int      `json:"probeStatusHysteresisSeconds"`
+	ProbeAssignmentsPath         string   `json:"probeAssignmentsPath"`
+	ProbeIDRulesPath             string   `json:"probeIdRulesPath"`
+	SeverityMapPath              string   `json:"severityMapPath"`
+	AreaStorePath                string   `json:"areaStorePath"`
+	PredefinedAreas              []string `json:"predefinedAreas"`
+	AreaAliases                  []string `json:"areaAliases"`
+	LocationAliases              []string `json:"locationAliases"`
+	AssignmentLogSize            int      `json:"assignmentLogSize"`
+	AssignmentLogPath            string   `json:"assignmentLogPath"`
+	MaxBodyBytes                 int64    `json:"maxBodyBytes"`
+	MaxDecompressedBytes         int64    `json:"maxDecompressedBytes"`
+	MaxProbeIDLength             int      `json:"maxProbeIdLength"`
+	MinFirmwareVersion           string   `json:"minFirmwareVersion"`
+	LowBatteryThreshold          float64  `json:"lowBatteryThreshold"`
+	StrictProbeIDs               bool     `json:"strictProbeIds"`
+	StrictProbeData              bool     `json:"strictProbeData"`
+	TrustProbeTimestamps         bool     `json:"trustProbeTimestamps"`
+	StripNonPrintable            bool     `json:"stripNonPrintable"`
+	KeepRawProbeData             bool     `json:"keepRawProbeData"`
+	IdempotencyWindowSeconds     int      `json:"idempotencyWindowSeconds"`
+	IngestRateLimit              int      `json:"ingestRateLimit"`
+	IngestRateBurst              int      `json:"ingestRateBurst"`
+	IngestTrustedCIDR            []string `json:"ingestTrustedCidrs"`
+	StrictPixelAreas             bool     `json:"strictPixelAreas"`
+	PixelMax                     int      `json:"pixelMax"`
+	EnableSimulator              bool     `json:"enableSimulator"`
+	TraceSpans                   bool     `json:"traceSpans"`
+}
+
+// newConfigResponse copies the exposed configuration, masking secrets
+func newConfigResponse(cfg config.Config) configResponse {
+	resp := configResponse{
+		ServerAddr:                   cfg.ServerAddr,
+		Version:                      cfg.Version,
+		ProtectReads:                 cfg.ProtectReads,
+		AllowedOrigins:               cfg.AllowedOrigins,
+		ShutdownTimeoutSeconds:       cfg.ShutdownTimeoutSeconds,
+		ReadTimeoutSeconds:           cfg.ReadTimeoutSeconds,
+		WriteTimeoutSeconds:          cfg.WriteTimeoutSeconds,
+		IdleTimeoutSeconds:           cfg.IdleTimeoutSeconds,
+		CompressMinBytes:             cfg.CompressMinBytes,
+		BroadcastBuffer:              cfg.BroadcastBuffer,
+		WSPingIntervalSeconds:        cfg.WSPingIntervalSeconds,
+		WSMaxMessageBytes:            cfg.WSMaxMessageBytes,
+		WSRetryAfterSeconds:          cfg.WSRetryAfterSeconds,
+		MessageStoreSize:             cfg.MessageStoreSize,
+		MessageLogPath:               cfg.MessageLogPath,
+		MessageIDScheme:              cfg.MessageIDScheme,
+		CompactDuplicateMessages:     cfg.CompactDuplicateMessages,
+		MessageMaxLength:             cfg.MessageMaxLength,
+		MessageOversize:              cfg.MessageOversize,
+		HistorySize:                  cfg.HistorySize,
+		HistoryMaxMetrics:            cfg.HistoryMaxMetrics,
+		AnomalyWindow:                cfg.AnomalyWindow,
+		AnomalyMinPoints:             cfg.AnomalyMinPoints,
+		AnomalyZThreshold:            cfg.AnomalyZThreshold,
+		AgeRetentionSeconds:          cfg.AgeRetentionSeconds,
+		CommandTTLSeconds:            cfg.CommandTTLSeconds,
+		CommandRetentionSeconds:      cfg.CommandRetentionSeconds,
+		RetentionSweepSeconds:        cfg.RetentionSweepSeconds,
+		PollDefaultLength:            cfg.PollDefaultLength,
+		PollMaxLength:                cfg.PollMaxLength,
+		PollMaxWaitSeconds:           cfg.PollMaxWaitSeconds,
+		ProbeStaleSeconds:            cfg.ProbeStaleSeconds,
+		ProbeRefreshDefault:          cfg.ProbeRefreshDefault,
+		ActivityMaxWindowSeconds:     cfg.ActivityMaxWindowSeconds,
+		ProbeStatusCheckSeconds:      cfg.ProbeStatusCheckSeconds,
+		ProbeStatusHysteresisSeconds: cfg.ProbeStatusHysteresisSeconds,
+		ProbeAssignmentsPath:         cfg.ProbeAssignmentsPath,
+		ProbeIDRulesPath:             cfg.ProbeIDRulesPath,
+		SeverityMapPath:              cfg.SeverityMapPath,
+		AreaStorePath:                cfg.AreaStorePath,
+		PredefinedAreas:              cfg.PredefinedAreas,
+		AreaAliases:                  cfg.AreaAliases,
+		LocationAliases:              cfg.LocationAliases,
+		AssignmentLogSize:            cfg.AssignmentLogSize,
+		AssignmentLogPath:            cfg.AssignmentLogPath,
+		MaxBodyBytes:                 cfg.MaxBodyBytes,
+		MaxDecompressedBytes:         cfg.MaxDecompressedBytes,
+		MaxProbeIDLength:             cfg.MaxProbeIDLength,
+		MinFirmwareVersion:           cfg.MinFirmwareVersion,
+		LowBatteryThreshold:          cfg.LowBatteryThreshold,
+		StrictProbeIDs:               cfg.StrictProbeIDs,
+		StrictProbeData:              cfg.StrictProbeData,
+		TrustProbeTimestamps:         cfg.TrustProbeTimestamps,
+		StripNonPrintable:            cfg.StripNonPrintable,
+		KeepRawProbeData:             cfg.KeepRawProbeData,
+		IdempotencyWindowSeconds:     cfg.IdempotencyWindowSeconds,
+		IngestRateLimit:              cfg.IngestRateLimit,
+		IngestRateBurst:              cfg.IngestRateBurst,
+		IngestTrustedCIDR:            cfg.IngestTrustedCIDR,
+		StrictPixelAreas:             cfg.StrictPixelAreas,
+		PixelMax:                     cfg.PixelMax,
+		EnableSimulator:              cfg.EnableSimulator,
+		TraceSpans:                   cfg.TraceSpans,
+	}
+	if cfg.AccessKey != "" {
+		resp.AccessKey = redacted
+	}
+	return resp
+}
+
+// handleConfig returns the configuration the server loaded, with secrets masked
+func (r *router) handleConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	resp := newConfigResponse(r.cfg)
+	resp.AccessKeyLabels = r.keyLabels()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (r *router) handleProbeData(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	body, err := io.ReadAll(req.Body)
+	readSpan := r.startSpan(req.Context(), "probedata.read")
+	body, err := r.readProbeBody(req)
+	readSpan.end()
+	if errors.Is(err, errBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	data := string(body)
-	msg := r.messageStore.AddMessage(data)
+	var lines []string // Set when the body carries several readings
+	if isJSONRequest(req) {
+		// Structured bodies are converted to the text form, so they're stored and parsed like any other
+		if data, err = probeDataFromJSON(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if split := splitProbeLines(data); len(split) > 1 {
+		// Gateways may concatenate several probe lines into one body; each line becomes its own message
+		lines = split
+	}
+
+	// A retried upload carrying the same Idempotency-Key gets the original result back
+	idempotencyKey := strings.TrimSpace(req.Header.Get("Idempotency-Key"))
+	var reservation *idempotencyEntry
+	if idempotencyKey != "" {
+		// The key is reserved before anything is stored, so concurrent retries can't both store
+		var reserved bool
+		reservation, reserved = r.idempotencyStore.Reserve(idempotencyKey, time.Now())
+		if !reserved {
+			results := r.idempotencyStore.Original(reservation)
+			response := map[string]any{"duplicate": true}
+			if lines != nil {
+				maps.Copy(response, batchResponse(results))
+			} else {
+				response["id"] = results[0].ID
+				response["timestamp"] = results[0].Timestamp
+				response["status"] = results[0].Status
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		// Released if nothing is stored below; a no-op once the upload has completed
+		defer r.idempotencyStore.Release(idempotencyKey, reservation)
+	}
+
+	if lines != nil {
+		// Each line is checked the same way as a single-line body
+		results := r.ingestBatch(req.Context(), lines, false)
+		if reservation != nil && countReceived(results) > 0 {
+			r.idempotencyStore.Complete(reservation, results, time.Now())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(batchResponse(results))
+		return
+	}
+
+	data, raw := r.sanitizeProbeLine(data)
+	if status, err := r.checkProbeData(data); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	result := r.ingestProbeData(req.Context(), data, raw)
+	if reservation != nil {
+		timestamp := result.Message.Timestamp
+		r.idempotencyStore.Complete(reservation, []batchResult{{ID: result.Message.ID, Timestamp: &timestamp, Status: "received"}}, time.Now())
+	}
+
+	response := map[string]any{
+		"id":        result.Message.ID,
+		"timestamp": result.Message.Timestamp,
+		"status":    "received",
+	}
+	// Echo back what was parsed to help debug probe firmware
+	if result.Parsed {
+		response["probeId"] = result.ProbeID
+		response["area"] = result.Area
+		response["location"] = result.Location
+		response["metrics"] = result.Metrics
+		response["warnings"] = result.Warnings
+		response["suspect"] = result.Suspect
+		if result.Firmware != "" {
+			response["firmware"] = result.Firmware
+		}
+		if result.Battery != nil {
+			response["battery"] = *result.Battery
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkProbeData applies the length limit (in reject mode) and strict mode checks to a probe data
+// message before it is stored, returning the status to reject it with
+// Lenient mode stores whatever parses; strict mode rejects malformed metric tokens
+// Unrecognized IDs are always counted, but only rejected in strict mode
+func (r *router) checkProbeData(data string) (int, error) {
+	if r.cfg.MessageOversize == "reject" && r.cfg.MessageMaxLength > 0 && len(data) > r.cfg.MessageMaxLength {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("probe data is %d bytes, longer than the %d byte limit", len(data), r.cfg.MessageMaxLength)
+	}
+	if r.cfg.StrictProbeData {
+		stripped, _ := splitProbeFirmware(data, r.cfg.MaxProbeIDLength)
+		stripped, _, _ = r.probeTimestamp(stripped)
+		if err := validateProbeData(stripped, r.cfg.MaxProbeIDLength); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	if recognized := r.checkProbeID(data); !recognized && r.cfg.StrictProbeIDs {
+		return http.StatusUnprocessableEntity, errors.New("unrecognized probe ID")
+	}
+	return http.StatusOK, nil
+}
+
+// checkProbeID reports whether a payload's probe ID resolves to a known area/location,
+// counting unrecognized IDs for monitoring
+func (r *router) checkProbeID(data string) bool {
+	probeID, _, err := parseMetrics(data, r.cfg.MaxProbeIDLength)
+	if err == nil {
+		if area, location := r.parseProbeID(probeID); area != "" && location != "" {
+			return true
+		}
+	}
+	r.metrics.unrecognizedProbeIDs.Add(1)
+	return false
+}
+
+// probeTimestamp strips a leading ts token from probe data when TRUST_PROBE_TIMESTAMPS is on,
+// returning the reported time, or the zero time (meaning now) if it's absent, invalid, or untrusted
+// err reports a ts token whose value didn't parse
+func (r *router) probeTimestamp(data string) (string, time.Time, error) {
+	if !r.cfg.TrustProbeTimestamps {
+		return data, time.Time{}, nil
+	}
+	stripped, timestamp, _, err := splitProbeTimestamp(data, r.cfg.MaxProbeIDLength)
+	return stripped, timestamp, err
+}
 
-	// Parse probe ID from data and add to area store
+// ingestResult describes a stored probe data message and what was parsed from it
+type ingestResult struct {
+	Message  ProbeMessage
+	Parsed   bool // Whether a probe ID was found
+	ProbeID  string
+	Area     string
+	Location string
+	Metrics  map[string]float64
+	Warnings []string
+	Suspect  []string
+	Firmware string   // Reported with fw=; empty if absent
+	Battery  *float64 // Reported with bat=; nil if absent
+}
+
+// ingestProbeData stores a raw probe data message and updates readings,
+// last-seen tracking, area assignments, and threshold alerts from it
+// raw is the payload as received, kept alongside data when sanitizing changed it
+func (r *router) ingestProbeData(ctx context.Context, data, raw string) ingestResult {
+	defer r.startSpan(ctx, "probedata.ingest").end()
+	receivedAt := time.Now()
+	// The firmware token goes first so it can't sit in front of a leading ts token
+	data, firmware := splitProbeFirmware(data, r.cfg.MaxProbeIDLength)
+	data, battery, hasBattery := splitProbeBattery(data, r.cfg.MaxProbeIDLength)
+	data, timestamp, err := r.probeTimestamp(data)
+	if err != nil {
+		log.Printf("probe data: %v, using receive time", err)
+	}
+	storeSpan := r.startSpan(ctx, "probedata.store")
+	msg := r.messageStore.AddRawMessageAt(data, raw, timestamp)
+	storeSpan.end()
+	r.metrics.messagesReceived.Add(1)
+
+	// Parse probe ID and metrics from data
 	// Format: "F16R co2=454,temp=25.5,hum=36.2,db=67,rssi=-57"
-	// 4 character probe ID, followed by space, then data
-	var probeID string
-	if len(data) >= 5 {
-		// Check if first 4 chars are followed by a space
-		if data[4] == ' ' {
-			probeID = data[:4]
+	parseSpan := r.startSpan(ctx, "probedata.parse")
+	parsed, err := parseProbeData(data, r.cfg.MaxProbeIDLength)
+	parseSpan.end()
+	probeID, metrics := parsed.ProbeID, parsed.Metrics
+	if err == nil && len(metrics) > 0 {
+		readingSpan := r.startSpan(ctx, "probedata.readings")
+		// History goes first so the reading can record which metrics it flagged
+		// Names are visited in order so a probe over the metric limit always keeps the same ones
+		names := make([]string, 0, len(metrics))
+		for metric := range metrics {
+			names = append(names, metric)
 		}
+		sort.Strings(names)
+		anomalous, skipped := []string{}, 0
+		for _, metric := range names {
+			point, ok := r.historyStore.Append(probeID, metric, msg.Timestamp, metrics[metric])
+			if !ok {
+				// Metrics beyond the limit are dropped from the reading too, so they can't grow memory there
+				delete(metrics, metric)
+				skipped++
+				continue
+			}
+			if point.Anomalous {
+				anomalous = append(anomalous, metric)
+			}
+		}
+		if skipped > 0 {
+			warning := fmt.Sprintf("%d metrics skipped, the probe is at the %d metric limit", skipped, r.cfg.HistoryMaxMetrics)
+			log.Printf("probe data: %s: %s", probeID, warning)
+			parsed.Warnings = append(parsed.Warnings, warning)
+		}
+		r.readingStore.UpdateReading(probeID, metrics, parsed.Suspect, anomalous, msg.Timestamp)
+		readingSpan.end()
 	}
 
 	// If we have a probe ID, try to parse it and add to area store
 	// Preserve original case of probe ID
 	if probeID != "" {
+		// Liveness follows the server clock even when the probe supplies its own timestamp
+		r.lastSeenStore.Touch(probeID, receivedAt)
+		r.firmwareStore.Set(probeID, firmware, receivedAt)
+		if hasBattery {
+			r.recordBattery(probeID, battery, receivedAt, msg.Timestamp)
+		}
+		r.activityStore.Record(probeID, receivedAt)
 		probeIDTrimmed := strings.TrimSpace(probeID)
 		area, location := r.parseProbeID(probeIDTrimmed)
-		if area != "" && location != "" && !r.areaStore.ProbeAssigned(probeIDTrimmed) {
-			r.areaStore.AddLocation(area, location, probeIDTrimmed)
+		if area != "" && location != "" {
+			if r.areaStore.AssignIfUnassigned(area, location, probeIDTrimmed) {
+				r.assignmentLog.Record(AssignmentEvent{
+					ProbeID:  probeIDTrimmed,
+					Action:   assignmentAutoAssigned,
+					Area:     r.normalizer.normalizeArea(area),
+					Location: r.normalizer.normalizeLocation(location),
+				})
+			}
 		}
 	}
 
+	// Alert WebSocket clients about any threshold breaches
+	if len(metrics) > 0 {
+		r.evaluateThresholds(probeID, metrics, msg.Timestamp)
+	}
+
+	result := ingestResult{
+		Message:  msg,
+		Parsed:   err == nil,
+		ProbeID:  probeID,
+		Metrics:  metrics,
+		Warnings: parsed.Warnings,
+		Suspect:  parsed.Suspect,
+		Firmware: firmware,
+	}
+	if hasBattery {
+		result.Battery = &battery
+	}
+	if result.Parsed {
+		if area, location, ok := r.areaStore.FindProbe(probeID); ok {
+			result.Area, result.Location = area, location
+		} else {
+			result.Area, result.Location = r.parseProbeID(probeID)
+		}
+	}
+	return result
+}
+
+// batchResult is the per-entry outcome of a batch ingestion
+type batchResult struct {
+	ID        string     `json:"id,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// handleProbeDataBatch ingests a JSON array of raw probe data strings
+// Entries without a parsable probe ID are rejected individually without failing the batch
+func (r *router) handleProbeDataBatch(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := r.readProbeBody(req)
+	if errors.Is(err, errBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var entries []string
+	if err := json.Unmarshal(body, &entries); err != nil {
+		http.Error(w, fmt.Sprintf("invalid JSON format: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"id":        msg.ID,
-		"timestamp": msg.Timestamp,
-		"status":    "received",
-	})
+	json.NewEncoder(w).Encode(batchResponse(r.ingestBatch(req.Context(), entries, true)))
+}
+
+// ingestBatch checks and ingests each entry, returning the per-entry results
+// With requireProbeID, entries without a parsable probe ID are rejected even in lenient mode
+func (r *router) ingestBatch(ctx context.Context, entries []string, requireProbeID bool) []batchResult {
+	results := make([]batchResult, 0, len(entries))
+	for _, data := range entries {
+		data, raw := r.sanitizeProbeLine(data)
+		if requireProbeID {
+			if _, _, err := parseMetrics(data, r.cfg.MaxProbeIDLength); err != nil {
+				r.metrics.unrecognizedProbeIDs.Add(1)
+				results = append(results, batchResult{Status: "error", Error: err.Error()})
+				continue
+			}
+		}
+		if _, err := r.checkProbeData(data); err != nil {
+			results = append(results, batchResult{Status: "error", Error: err.Error()})
+			continue
+		}
+		msg := r.ingestProbeData(ctx, data, raw).Message
+		timestamp := msg.Timestamp
+		results = append(results, batchResult{ID: msg.ID, Timestamp: &timestamp, Status: "received"})
+	}
+	return results
+}
+
+// batchResponse is the response body listing per-entry batch results
+func batchResponse(results []batchResult) map[string]any {
+	return map[string]any{
+		"results":  results,
+		"count":    len(results),
+		"received": countReceived(results),
+	}
+}
+
+// countReceived returns how many batch entries were stored
+func countReceived(results []batchResult) int {
+	received := 0
+	for _, result := range results {
+		if result.Status == "received" {
+			received++
+		}
+	}
+	return received
+}
+
+// splitProbeLines returns the non-empty lines of a newline-delimited probe data body
+func splitProbeLines(body string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+var errBodyTooLarge = errors.New("decompressed body too large")
+
+// writeBodyError reports a failure to read or decode a request body
+// Bodies cut off by limitBodies get 413; anything else is the client's malformed input
+func writeBodyError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		http.Error(w, fmt.Sprintf("request body too large (limit %d bytes)", maxErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// isJSONRequest reports whether a request declares a JSON body
+func isJSONRequest(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// readProbeBody reads a probe data body, transparently decompressing gzip uploads
+// Decompressed output is capped at cfg.MaxDecompressedBytes to guard against decompression bombs
+func (r *router) readProbeBody(req *http.Request) ([]byte, error) {
+	if !strings.EqualFold(strings.TrimSpace(req.Header.Get("Content-Encoding")), "gzip") {
+		return io.ReadAll(req.Body)
+	}
+
+	gz, err := gzip.NewReader(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	defer gz.Close()
+
+	limit := r.cfg.MaxDecompressedBytes
+	body, err := io.ReadAll(io.LimitReader(gz, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
 }
 
 // parseProbeID parses a probe ID and returns area and location
@@ -197,12 +956,17 @@ func (r *router) parseProbeID(probeID string) (area, location string) {
 	}
 	// Use uppercase only for pattern matching, but preserve original case
 	upperID := strings.ToUpper(probeID)
+	for _, rule := range r.probeIDRules {
+		if ruleArea, ruleLocation, ok := rule.match(upperID); ok {
+			return ruleArea, ruleLocation
+		}
+	}
 	if len(upperID) < 2 {
 		return "", ""
 	}
 
-	// Floor probes: F17R, F17H, F16R, F11R, F11H, etc.
-	// Pattern: F followed by digits, then R or H
+	// Floor probes: F17R, F17H, F16R, F11R, F11H, F100R, etc.
+	// Pattern: F followed by any number of digits, then R or H
 	if len(upperID) >= 4 && upperID[0] == 'F' {
 		// Extract floor number (digits after F)
 		floorNum := ""
@@ -211,9 +975,10 @@ func (r *router) parseProbeID(probeID string) (area, location string) {
 			floorNum += string(upperID[i])
 			i++
 		}
-		// Check if we have a location code after the floor number
-		// For F11R/F11H: F(0), 1(1), 1(2), R(3) - i should be 3, len is 4, so i < len is true
-		if i < len(upperID) && floorNum != "" {
+		// Check the location code is the last character after the floor number
+		// For F11R/F11H: F(0), 1(1), 1(2), R(3) - i should be 3, len is 4
+		// Longer IDs with a suffix (F12H1) would collide with F12H, so they don't match
+		if i == len(upperID)-1 && floorNum != "" {
 			locCode := upperID[i]
 			if locCode == 'R' {
 				return "FLOOR" + floorNum, "ROTUNDA"
@@ -242,7 +1007,7 @@ func (r *router) parseProbeID(probeID string) (area, location string) {
 
 func (r *router) lookupFixedProbeAssignment(probeID string) (string, string) {
 	id := strings.ToUpper(strings.TrimSpace(probeID))
-	if assignment, ok := fixedProbeAssignments[id]; ok {
+	if assignment, ok := r.probeAssignments[id]; ok {
 		return assignment.Area, assignment.Location
 	}
 	return "", ""
@@ -254,61 +1019,135 @@ func (r *router) handlePoll(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Get parameters from query or body
 	var lastID string
 	var beforeID string
+	var probeID string
 	var maxLength int
+	var waitSeconds float64
 	if req.Method == "GET" {
 		lastID = req.URL.Query().Get("lastId")
 		beforeID = req.URL.Query().Get("beforeId")
+		probeID = req.URL.Query().Get("probeId")
 		lengthStr := req.URL.Query().Get("length")
 		if lengthStr != "" {
 			if parsed, err := strconv.Atoi(lengthStr); err == nil {
 				maxLength = parsed
 			}
 		}
+		if waitStr := req.URL.Query().Get("wait"); waitStr != "" {
+			parsed, err := strconv.ParseFloat(waitStr, 64)
+			if err != nil || parsed < 0 {
+				http.Error(w, "wait must be a non-negative number of seconds", http.StatusBadRequest)
+				return
+			}
+			waitSeconds = parsed
+		}
 	} else {
 		var body struct {
-			LastID   string `json:"lastId"`
-			BeforeID string `json:"beforeId"`
-			Length   int    `json:"length"`
+			LastID   string  `json:"lastId"`
+			BeforeID string  `json:"beforeId"`
+			ProbeID  string  `json:"probeId"`
+			Length   int     `json:"length"`
+			Wait     float64 `json:"wait"`
 		}
-		if err := json.NewDecoder(req.Body).Decode(&body); err == nil {
+		err := json.NewDecoder(req.Body).Decode(&body)
+		if err == nil {
 			lastID = body.LastID
 			beforeID = body.BeforeID
+			probeID = body.ProbeID
 			maxLength = body.Length
+			waitSeconds = max(body.Wait, 0)
+		}
+		// Other decode errors fall back to the defaults, but an oversized body is still refused
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeBodyError(w, err)
+			return
+		}
+	}
+
+	if maxLength <= 0 {
+		if beforeID != "" {
+			maxLength = 100 // Default to 100 for pagination
+		} else {
+			maxLength = r.cfg.PollDefaultLength // The store falls back to 10 if unset
 		}
 	}
 
+	// Clamp oversized requests so a single poll can't serialize the whole store
+	capped := false
+	if r.cfg.PollMaxLength > 0 && maxLength > r.cfg.PollMaxLength {
+		maxLength = r.cfg.PollMaxLength
+		capped = true
+	}
+
 	// Get messages based on pagination direction
 	var messages []ProbeMessage
 	if beforeID != "" {
 		// Pagination: get messages before this ID (for fetching older messages)
-		if maxLength <= 0 {
-			maxLength = 100 // Default to 100 for pagination
-		}
 		messages = r.messageStore.GetMessagesBefore(beforeID, maxLength)
 	} else {
-		// Normal polling: get messages after lastID (defaults to max 10 if length not specified)
-		messages = r.messageStore.GetMessagesAfter(lastID, maxLength)
+		// Normal polling: get messages after lastID
+		// Optionally restricted to a single probe
+		// With wait set, an empty result blocks until a matching message arrives or the wait runs out
+		messages = r.waitForMessages(w, req, lastID, probeID, maxLength, r.pollWait(waitSeconds))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
+	resp := map[string]any{
 		"messages": messages,
 		"count":    len(messages),
-	})
+	}
+	if capped {
+		resp["capped"] = true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// pollWait converts a poll's wait parameter to a duration, clamped to POLL_MAX_WAIT_SECONDS
+func (r *router) pollWait(seconds float64) time.Duration {
+	if limit := float64(r.cfg.PollMaxWaitSeconds); seconds > limit {
+		seconds = limit
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// waitForMessages returns the messages after lastID, blocking for up to wait while there are none
+// It wakes on every new message, so a poll filtered to one probe keeps waiting through other probes' data
+// It also gives up early when the client disconnects or the server shuts down
+func (r *router) waitForMessages(w http.ResponseWriter, req *http.Request, lastID, probeID string, maxLength int, wait time.Duration) []ProbeMessage {
+	arrived := r.messageStore.messageArrived()
+	messages := r.messageStore.GetMessagesAfterFiltered(lastID, probeID, maxLength)
+	if len(messages) > 0 || wait <= 0 {
+		return messages
+	}
+
+	// The server's WriteTimeout runs from the start of the request, so push it past the wait
+	clearDeadlines(w)
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(wait + time.Duration(r.cfg.WriteTimeoutSeconds)*time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("poll: set write deadline: %v", err)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-arrived:
+		case <-timer.C:
+			return messages
+		case <-req.Context().Done():
+			return messages
+		case <-r.done:
+			return messages
+		}
+		arrived = r.messageStore.messageArrived()
+		messages = r.messageStore.GetMessagesAfterFiltered(lastID, probeID, maxLength)
+		if len(messages) > 0 {
+			return messages
+		}
+	}
 }
 
 func (r *router) handleClear(w http.ResponseWriter, req *http.Request) {
@@ -322,22 +1161,186 @@ func (r *router) handleClear(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "cleared"})
 }
 
+// runRetentionSweep periodically drops messages older than AGE_RETENTION_SECONDS
+// and finished commands older than COMMAND_RETENTION_SECONDS until shutdown
+func (r *router) runRetentionSweep() {
+	interval := time.Duration(r.cfg.RetentionSweepSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	retention := time.Duration(r.cfg.AgeRetentionSeconds) * time.Second
+	commandRetention := time.Duration(r.cfg.CommandRetentionSeconds) * time.Second
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if retention > 0 {
+				if removed := r.messageStore.PruneOlderThan(now.Add(-retention)); removed > 0 {
+					log.Printf("retention: removed %d messages older than %s", removed, retention)
+				}
+			}
+			if removed := r.commandQueue.PruneOlderThan(now.Add(-commandRetention)); removed > 0 {
+				log.Printf("retention: removed %d finished commands older than %s", removed, commandRetention)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// handleStoreStats reports how full the message buffer is, to help size MESSAGE_STORE_SIZE
+func (r *router) handleStoreStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.messageStore.Stats())
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter, returning the zero time if absent
+func parseTimeParam(req *http.Request, name string) (time.Time, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected RFC3339 timestamp", name)
+	}
+	return t, nil
+}
+
+func (r *router) handleMessages(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get time range from query: /api/messages?from=<rfc3339>&to=<rfc3339>
+	from, err := parseTimeParam(req, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(req, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+
+	messages := r.messageStore.GetMessagesByTimeRange(from, to)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"messages": messages,
+		"count":    len(messages),
+	})
+}
+
+func (r *router) handleMessage(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "DELETE" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract message ID from URL path: /api/messages/{id}
+	id := strings.TrimPrefix(req.URL.Path, "/api/messages/")
+	if id == "" {
+		http.Error(w, "message ID required", http.StatusBadRequest)
+		return
+	}
+
+	if !r.messageStore.DeleteByID(id) {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "deleted",
+		"id":     id,
+	})
+}
+
+// handleMessageSearch finds stored messages whose data contains a substring
+func (r *router) handleMessageSearch(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /api/messages/search?q=ERR&limit=50&i=true
+	q := req.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "q required", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	// Same cap as polling, so a search can't serialize the whole store either
+	capped := false
+	if r.cfg.PollMaxLength > 0 && limit > r.cfg.PollMaxLength {
+		limit = r.cfg.PollMaxLength
+		capped = true
+	}
+	ignoreCase := false
+	if iStr := req.URL.Query().Get("i"); iStr != "" {
+		parsed, err := strconv.ParseBool(iStr)
+		if err != nil {
+			http.Error(w, "i must be true or false", http.StatusBadRequest)
+			return
+		}
+		ignoreCase = parsed
+	}
+
+	messages := r.messageStore.Search(q, ignoreCase, limit)
+	resp := map[string]any{
+		"messages": messages,
+		"count":    len(messages),
+	}
+	if capped {
+		resp["capped"] = true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 func (r *router) handleGetAreas(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get all areas
 	areas := r.areaStore.GetAreas()
 
+	names := make([]string, 0, len(areas))
+	for area := range areas {
+		names = append(names, area)
+	}
+	r.areaOrder.Sort(names)
+
 	// Convert to JSON array format: [{area, location, probeID}, ...]
 	var response []map[string]string
-	for area, locations := range areas {
+	for _, area := range names {
+		locations := areas[area]
 		if len(locations) == 0 {
 			// Area with no probes - still include it but with empty location and probeID
 			response = append(response, map[string]string{
@@ -360,24 +1363,112 @@ func (r *router) handleGetAreas(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (r *router) handleStats(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// handleArea routes requests under /api/areas/{area}/...
+func (r *router) handleArea(w http.ResponseWriter, req *http.Request) {
+	// Extract area name from URL path: /api/areas/{area} or /api/areas/{area}/readings
+	rest := strings.TrimPrefix(req.URL.Path, "/api/areas/")
+	areaName, action, _ := strings.Cut(rest, "/")
+	if areaName == "" {
+		http.Error(w, "area name required", http.StatusBadRequest)
+		return
+	}
 
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	switch action {
+	case "":
+		r.handleClearArea(w, req, areaName)
+	case "readings":
+		r.handleAreaReadings(w, req, areaName)
+	case "display":
+		r.handleAreaDisplay(w, req, areaName)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// handleClearArea removes every probe assignment in an area
+func (r *router) handleClearArea(w http.ResponseWriter, req *http.Request, areaName string) {
+	if req.Method != "DELETE" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	removed, ok := r.areaStore.ClearArea(areaName)
+	if !ok {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+	for _, loc := range removed {
+		if loc.ProbeID == "" {
+			continue
+		}
+		r.assignmentLog.Record(AssignmentEvent{
+			ProbeID:  loc.ProbeID,
+			Action:   assignmentRemoved,
+			Area:     r.normalizer.normalizeArea(areaName),
+			Location: loc.Location,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":  "cleared",
+		"area":    r.normalizer.normalizeArea(areaName),
+		"removed": len(removed),
+	})
+}
+
+// handleAreaReadings returns the latest reading for every probe assigned to an area
+func (r *router) handleAreaReadings(w http.ResponseWriter, req *http.Request, areaName string) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	locations, ok := r.areaStore.GetLocations(areaName)
+	if !ok {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+
+	type areaReading struct {
+		ProbeID   string             `json:"probeID"`
+		Location  string             `json:"location"`
+		Metrics   map[string]float64 `json:"metrics"`
+		Timestamp *time.Time         `json:"timestamp"`
+	}
+
+	response := make([]areaReading, 0, len(locations))
+	for _, loc := range locations {
+		entry := areaReading{
+			ProbeID:  loc.ProbeID,
+			Location: loc.Location,
+			Metrics:  map[string]float64{},
+		}
+		// Probes that have never reported keep empty metrics and a null timestamp
+		if reading, ok := r.readingStore.GetReading(loc.ProbeID); ok {
+			entry.Metrics = reading.Metrics
+			timestamp := reading.Timestamp
+			entry.Timestamp = &timestamp
+		}
+		response = append(response, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (r *router) handleStats(w http.ResponseWriter, req *http.Request) {
 	if req.Method == "GET" {
 		// Get area filter from query parameter
 		areaFilter := req.URL.Query().Get("area")
 
-		// Get stats (filtered by area if provided)
-		stats := r.statsStore.GetStats(areaFilter)
+		// Get stats (filtered by area if provided, and by metric to compare it across areas)
+		var stats []AreaStat
+		if metric := req.URL.Query().Get("metric"); strings.TrimSpace(metric) != "" {
+			stats = r.statsStore.GetStatsByMetric(areaFilter, metric)
+		} else {
+			stats = r.statsStore.GetStats(areaFilter)
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
@@ -386,16 +1477,37 @@ func (r *router) handleStats(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if req.Method == "DELETE" {
+		// Reads and stat reports stay open; resetting stats needs the key
+		r.requireKey(r.handleStatsReset)(w, req)
+		return
+	}
+
 	if req.Method == "POST" {
 		// Read the stat message string
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
 		statMsg := string(body)
 
+		// Dry run validates the message against the real parser without storing it
+		if req.URL.Query().Get("dryRun") == "true" {
+			stat, err := parseStat(statMsg)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"status": "valid",
+				"stat":   stat,
+			})
+			return
+		}
+
 		// Parse the stat message
 		// Format: "STAT: {area} {metric} min:{min} max:{max} min_o:{min_o} max_o:{max_o}"
 		// Example: "STAT: FLOOR17 co2 min:400.0 max:600.0 min_o:350.0 max_o:650.0"
@@ -415,13 +1527,54 @@ func (r *router) handleStats(w http.ResponseWriter, req *http.Request) {
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
+// handleStatsReset clears one area's stats (?area=FLOOR16), or all of them without an area,
+// e.g. when an area is recommissioned with new calibration
+func (r *router) handleStatsReset(w http.ResponseWriter, req *http.Request) {
+	area := strings.TrimSpace(req.URL.Query().Get("area"))
+	cleared := r.statsStore.Clear(area)
+	if area != "" && len(cleared) == 0 {
+		http.Error(w, "no stats for area", http.StatusNotFound)
+		return
+	}
+	log.Printf("stats: cleared %v", cleared)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":  "cleared",
+		"cleared": cleared,
+	})
+}
+
+// parsedStat is a STAT message after parsing, with area and metric normalized as stored
+type parsedStat struct {
+	Area   string  `json:"area"`
+	Metric string  `json:"metric"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	MinO   float64 `json:"min_o"`
+	MaxO   float64 `json:"max_o"`
+}
+
 // parseAndUpdateStat parses a STAT message and updates the stats store
 // Format: "STAT: {area} {metric} min:{min} max:{max} min_o:{min_o} max_o:{max_o}"
 func (r *router) parseAndUpdateStat(statMsg string) error {
+	stat, err := parseStat(statMsg)
+	if err != nil {
+		return err
+	}
+
+	// Update the stats store
+	r.statsStore.UpdateStat(stat.Area, stat.Metric, stat.Min, stat.Max, stat.MinO, stat.MaxO)
+
+	return nil
+}
+
+// parseStat parses a STAT message without touching the stats store
+func parseStat(statMsg string) (parsedStat, error) {
 	// Find STAT: in the message
 	statIdx := strings.Index(statMsg, "STAT:")
 	if statIdx == -1 {
-		return fmt.Errorf("STAT: not found in message")
+		return parsedStat{}, fmt.Errorf("STAT: not found in message")
 	}
 
 	// Extract the part after STAT:
@@ -432,7 +1585,7 @@ func (r *router) parseAndUpdateStat(statMsg string) error {
 	// Pattern: (\S+)\s+(\S+)\s+min:([-\d.]+)\s+max:([-\d.]+)\s+min_o:([-\d.]+)\s+max_o:([-\d.]+)
 	parts := strings.Fields(cleaned)
 	if len(parts) < 6 {
-		return fmt.Errorf("invalid stat message format")
+		return parsedStat{}, fmt.Errorf("invalid stat message format")
 	}
 
 	area := parts[0]
@@ -443,10 +1596,10 @@ func (r *router) parseAndUpdateStat(statMsg string) error {
 	if strings.HasPrefix(parts[2], "min:") {
 		_, err := fmt.Sscanf(parts[2], "min:%f", &min)
 		if err != nil {
-			return fmt.Errorf("failed to parse min: %v", err)
+			return parsedStat{}, fmt.Errorf("failed to parse min: %v", err)
 		}
 	} else {
-		return fmt.Errorf("expected min: in position 2")
+		return parsedStat{}, fmt.Errorf("expected min: in position 2")
 	}
 
 	// Parse max
@@ -454,10 +1607,10 @@ func (r *router) parseAndUpdateStat(statMsg string) error {
 	if strings.HasPrefix(parts[3], "max:") {
 		_, err := fmt.Sscanf(parts[3], "max:%f", &max)
 		if err != nil {
-			return fmt.Errorf("failed to parse max: %v", err)
+			return parsedStat{}, fmt.Errorf("failed to parse max: %v", err)
 		}
 	} else {
-		return fmt.Errorf("expected max: in position 3")
+		return parsedStat{}, fmt.Errorf("expected max: in position 3")
 	}
 
 	// Parse min_o
@@ -465,10 +1618,10 @@ func (r *router) parseAndUpdateStat(statMsg string) error {
 	if strings.HasPrefix(parts[4], "min_o:") {
 		_, err := fmt.Sscanf(parts[4], "min_o:%f", &minO)
 		if err != nil {
-			return fmt.Errorf("failed to parse min_o: %v", err)
+			return parsedStat{}, fmt.Errorf("failed to parse min_o: %v", err)
 		}
 	} else {
-		return fmt.Errorf("expected min_o: in position 4")
+		return parsedStat{}, fmt.Errorf("expected min_o: in position 4")
 	}
 
 	// Parse max_o
@@ -476,43 +1629,120 @@ func (r *router) parseAndUpdateStat(statMsg string) error {
 	if strings.HasPrefix(parts[5], "max_o:") {
 		_, err := fmt.Sscanf(parts[5], "max_o:%f", &maxO)
 		if err != nil {
-			return fmt.Errorf("failed to parse max_o: %v", err)
+			return parsedStat{}, fmt.Errorf("failed to parse max_o: %v", err)
 		}
 	} else {
-		return fmt.Errorf("expected max_o: in position 5")
+		return parsedStat{}, fmt.Errorf("expected max_o: in position 5")
 	}
 
-	// Update the stats store
-	r.statsStore.UpdateStat(area, metric, min, max, minO, maxO)
+	// %f accepts NaN and Inf, which JSON can't encode when the stats are read back
+	for _, v := range []float64{min, max, minO, maxO} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return parsedStat{}, fmt.Errorf("stat values must be finite numbers")
+		}
+	}
 
-	return nil
+	return parsedStat{
+		Area:   strings.ToUpper(strings.TrimSpace(area)),
+		Metric: strings.ToLower(strings.TrimSpace(metric)),
+		Min:    min,
+		Max:    max,
+		MinO:   minO,
+		MaxO:   maxO,
+	}, nil
 }
 
-func (r *router) handleThresholds(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// handleThresholdEvaluate reports the current band of every thresholded metric read in an area
+func (r *router) handleThresholdEvaluate(w http.ResponseWriter, req *http.Request, areaName string) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	evaluations, ok := r.evaluateArea(areaName)
+	if !ok {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(evaluations)
+}
+
+// handleThresholdBreaches returns or resets the breach counts for an area
+func (r *router) handleThresholdBreaches(w http.ResponseWriter, req *http.Request, areaName string) {
+	switch req.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"area":     strings.ToUpper(strings.TrimSpace(areaName)),
+			"breaches": r.breachCounter.Get(areaName),
+		})
+	case "DELETE":
+		r.breachCounter.Reset(areaName)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": "reset",
+			"area":   strings.ToUpper(strings.TrimSpace(areaName)),
+		})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+// handleThresholdSuggest proposes thresholds for an area from its probes' recorded history
+func (r *router) handleThresholdSuggest(w http.ResponseWriter, req *http.Request, areaName string) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract area name from URL path: /api/thresholds/{areaname}
+	suggested, insufficient, ok := r.suggestAreaThresholds(areaName)
+	if !ok {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+
+	// Same shape as GET /api/thresholds/{area} so the editor can be pre-filled
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"thresholds":       suggested,
+		"insufficientData": insufficient,
+		"minSamples":       minSuggestSamples,
+	})
+}
+
+func (r *router) handleThresholds(w http.ResponseWriter, req *http.Request) {
+	// Extract area name from URL path: /api/thresholds/{areaname} or /api/thresholds/{areaname}/{action}
 	path := req.URL.Path
 	prefix := "/api/thresholds/"
 	if !strings.HasPrefix(path, prefix) {
 		http.Error(w, "invalid path", http.StatusBadRequest)
 		return
 	}
-	areaName := strings.TrimPrefix(path, prefix)
+	areaName, action, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
 	if areaName == "" {
 		http.Error(w, "area name required", http.StatusBadRequest)
 		return
 	}
 
+	switch action {
+	case "":
+		// Thresholds for the area itself, handled below
+	case "evaluate":
+		r.handleThresholdEvaluate(w, req, areaName)
+		return
+	case "suggest":
+		r.handleThresholdSuggest(w, req, areaName)
+		return
+	case "breaches":
+		r.handleThresholdBreaches(w, req, areaName)
+		return
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
 	if req.Method == "GET" {
 		// Get thresholds for the area
 		thresholds := r.thresholdStore.GetThresholds(areaName)
@@ -530,7 +1760,7 @@ func (r *router) handleThresholds(w http.ResponseWriter, req *http.Request) {
 			Thresholds []MetricThreshold `json:"thresholds"`
 		}
 		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
@@ -548,34 +1778,181 @@ func (r *router) handleThresholds(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if req.Method == "PATCH" {
+		r.handleThresholdPatch(w, req, areaName)
+		return
+	}
+
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// validateThresholdSet checks an area's imported thresholds: named metrics, each once, with six values
+func validateThresholdSet(thresholds []MetricThreshold) error {
+	seen := make(map[string]bool, len(thresholds))
+	for _, threshold := range thresholds {
+		metric := strings.ToLower(strings.TrimSpace(threshold.Metric))
+		if metric == "" {
+			return fmt.Errorf("threshold with empty metric name")
+		}
+		if seen[metric] {
+			return fmt.Errorf("metric %s listed more than once", metric)
+		}
+		seen[metric] = true
+		if len(threshold.Values) != 6 {
+			return fmt.Errorf("metric %s has %d values, want 6", metric, len(threshold.Values))
+		}
+	}
+	return nil
+}
+
+// handleAllThresholds exports or imports every area's thresholds at once, for backup and restore
+func (r *router) handleAllThresholds(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"thresholds": r.thresholdStore.AllThresholds(),
+		})
+	case "PUT":
+		var body struct {
+			Thresholds map[string][]MetricThreshold `json:"thresholds"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+
+		// An invalid area is reported and skipped; the remaining areas are still imported
+		imported := []string{}
+		errs := map[string]string{}
+		for area, thresholds := range body.Thresholds {
+			areaUpper := strings.ToUpper(strings.TrimSpace(area))
+			if areaUpper == "" {
+				errs[area] = "area name required"
+				continue
+			}
+			if err := validateThresholdSet(thresholds); err != nil {
+				errs[areaUpper] = err.Error()
+				continue
+			}
+			r.thresholdStore.ReplaceThresholds(areaUpper, thresholds)
+			imported = append(imported, areaUpper)
+		}
+		sort.Strings(imported)
+
+		status := "imported"
+		if len(errs) > 0 {
+			status = "partial"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":   status,
+			"imported": imported,
+			"errors":   errs,
+		})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleThresholdPatch updates individual threshold values for one metric
+// Accepts {"metric":"co2","index":4,"value":900} or a sparse
+// {"metric":"co2","values":[null,null,null,null,900,1200]}
+func (r *router) handleThresholdPatch(w http.ResponseWriter, req *http.Request, areaName string) {
+	var body struct {
+		Metric string     `json:"metric"`
+		Index  *int       `json:"index"`
+		Value  *float64   `json:"value"`
+		Values []*float64 `json:"values"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if strings.TrimSpace(body.Metric) == "" {
+		http.Error(w, "metric required", http.StatusBadRequest)
+		return
+	}
 
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	var patch [6]*float64
+	switch {
+	case body.Index != nil && body.Values != nil:
+		http.Error(w, "send either index and value or values, not both", http.StatusBadRequest)
+		return
+	case body.Index != nil:
+		if *body.Index < 0 || *body.Index > 5 {
+			http.Error(w, "index must be between 0 and 5", http.StatusBadRequest)
+			return
+		}
+		if body.Value == nil {
+			http.Error(w, "value required with index", http.StatusBadRequest)
+			return
+		}
+		patch[*body.Index] = body.Value
+	case body.Values != nil:
+		if len(body.Values) > 6 {
+			http.Error(w, "values must have at most 6 entries", http.StatusBadRequest)
+			return
+		}
+		copy(patch[:], body.Values)
+	default:
+		http.Error(w, "index and value, or values, required", http.StatusBadRequest)
+		return
+	}
+
+	values, err := r.thresholdStore.PatchThreshold(areaName, body.Metric, patch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Extract probe ID from URL path: /api/probes/{probeId}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "updated",
+		"threshold": MetricThreshold{
+			Metric: strings.ToLower(strings.TrimSpace(body.Metric)),
+			Values: values,
+		},
+	})
+}
+
+func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
+	// Extract probe ID from URL path: /api/probes/{probeId} or /api/probes/{probeId}/{action}
 	path := req.URL.Path
 	prefix := "/api/probes/"
 	if !strings.HasPrefix(path, prefix) {
 		http.Error(w, "invalid path", http.StatusBadRequest)
 		return
 	}
-	probeID := strings.TrimPrefix(path, prefix)
+	probeID, action, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
 	if probeID == "" {
 		http.Error(w, "probe ID required", http.StatusBadRequest)
 		return
 	}
 
+	switch action {
+	case "":
+		// Assignment on the probe itself, handled below
+	case "history":
+		r.handleProbeHistory(w, req, probeID)
+		return
+	case "smoothed":
+		r.handleProbeSmoothed(w, req, probeID)
+		return
+	case "rename":
+		r.handleProbeRename(w, req, probeID)
+		return
+	case "assignments":
+		r.handleProbeAssignments(w, req, probeID)
+		return
+	case "heartbeat":
+		r.handleProbeHeartbeat(w, req, probeID)
+		return
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
 	if req.Method == "POST" {
 		// Assign probe to area and location
 		var body struct {
@@ -583,7 +1960,7 @@ func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
 			Location string `json:"location"`
 		}
 		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
@@ -592,35 +1969,9 @@ func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		// Normalize area name (similar to AddLocation)
-		areaUpper := ""
-		if len(body.Area) > 0 {
-			if len(body.Area) > 5 && (body.Area[:5] == "Floor" || body.Area[:5] == "floor") {
-				areaUpper = "FLOOR" + body.Area[5:]
-			} else if body.Area == "Tea_room" || body.Area == "tea_room" || body.Area == "TEAROOM" {
-				areaUpper = "TEAROOM"
-			} else if body.Area == "pool" || body.Area == "Pool" || body.Area == "POOL" {
-				areaUpper = "POOL"
-			} else {
-				areaUpper = strings.ToUpper(strings.TrimSpace(body.Area))
-			}
-		}
-
-		// Normalize location name
-		locationUpper := ""
-		if body.Location == "Rotunda" || body.Location == "rotunda" || body.Location == "ROTUNDA" {
-			locationUpper = "ROTUNDA"
-		} else if body.Location == "Hallway" || body.Location == "hallway" || body.Location == "HALLWAY" {
-			locationUpper = "HALLWAY"
-		} else if body.Location == "Line" || body.Location == "line" || body.Location == "LINE" {
-			locationUpper = "LINE"
-		} else if body.Location == "Location1" || body.Location == "location1" || body.Location == "LOCATION1" {
-			locationUpper = "LOCATION1"
-		} else if body.Location == "Location2" || body.Location == "location2" || body.Location == "LOCATION2" {
-			locationUpper = "LOCATION2"
-		} else {
-			locationUpper = strings.ToUpper(strings.TrimSpace(body.Location))
-		}
+		// Normalized the same way the area store will store them
+		areaUpper := r.normalizer.normalizeArea(body.Area)
+		locationUpper := r.normalizer.normalizeLocation(body.Location)
 
 		if areaUpper == "" || locationUpper == "" {
 			http.Error(w, "invalid area or location", http.StatusBadRequest)
@@ -629,6 +1980,12 @@ func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
 
 		// Add probe to area store
 		r.areaStore.AddLocation(areaUpper, locationUpper, probeID)
+		r.assignmentLog.Record(AssignmentEvent{
+			ProbeID:  probeID,
+			Action:   assignmentAssigned,
+			Area:     areaUpper,
+			Location: locationUpper,
+		})
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
@@ -641,7 +1998,15 @@ func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if req.Method == "DELETE" {
-		// Remove probe assignment from area store
+		// Remove probe assignment from area store, logging where it was
+		if area, location, ok := r.areaStore.FindProbe(probeID); ok {
+			r.assignmentLog.Record(AssignmentEvent{
+				ProbeID:  probeID,
+				Action:   assignmentRemoved,
+				Area:     area,
+				Location: location,
+			})
+		}
 		r.areaStore.RemoveProbe(probeID)
 
 		w.Header().Set("Content-Type", "application/json")
@@ -655,24 +2020,240 @@ func (r *router) handleProbes(w http.ResponseWriter, req *http.Request) {
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (r *router) handleSendCommand(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+func (r *router) handleReadings(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract probe ID from URL path: /api/readings/{probeId}
+	probeID := strings.TrimPrefix(req.URL.Path, "/api/readings/")
+	if probeID == "" {
+		http.Error(w, "probe ID required", http.StatusBadRequest)
+		return
+	}
+
+	reading, ok := r.readingStore.GetReading(probeID)
+	if !ok {
+		http.Error(w, "no reading for probe", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reading)
+}
+
+func (r *router) handleProbeStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	staleAfter := time.Duration(r.cfg.ProbeStaleSeconds) * time.Second
+	statuses := r.lastSeenStore.Statuses(time.Now(), staleAfter)
+	for i, status := range statuses {
+		if level, low, ok := r.batteryStore.Get(status.ProbeID); ok {
+			statuses[i].Battery = &level
+			statuses[i].LowBattery = low
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// handleProbeList returns every probe that has reported, with its assignment and last-seen time
+func (r *router) handleProbeList(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type probeEntry struct {
+		ProbeID  string    `json:"probeId"`
+		Assigned bool      `json:"assigned"`
+		Area     string    `json:"area,omitempty"`
+		Location string    `json:"location,omitempty"`
+		LastSeen time.Time `json:"lastSeen"`
+	}
+
+	// Every reporting probe is touched in the last-seen store, assigned or not
+	// Statuses is already sorted by probe ID
+	staleAfter := time.Duration(r.cfg.ProbeStaleSeconds) * time.Second
+	statuses := r.lastSeenStore.Statuses(time.Now(), staleAfter)
+	probes := make([]probeEntry, 0, len(statuses))
+	for _, status := range statuses {
+		entry := probeEntry{
+			ProbeID:  status.ProbeID,
+			LastSeen: status.LastSeen,
+		}
+		entry.Area, entry.Location, entry.Assigned = r.areaStore.FindProbe(status.ProbeID)
+		probes = append(probes, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"probes": probes,
+		"count":  len(probes),
+	})
+}
+
+// handleProbeRename moves a probe's assignment, latest reading, history, and
+// last-seen time to a new probe ID, e.g. after relabeling the physical probe
+func (r *router) handleProbeRename(w http.ResponseWriter, req *http.Request, oldID string) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		NewID string `json:"newId"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	newID := strings.TrimSpace(body.NewID)
+	if newID == "" {
+		http.Error(w, "newId required", http.StatusBadRequest)
+		return
+	}
+
+	// The new ID must not belong to a probe the server already knows about
+	_, seenNew := r.lastSeenStore.LastSeen(newID)
+	if seenNew || r.areaStore.ProbeAssigned(newID) {
+		http.Error(w, "newId already in use", http.StatusConflict)
+		return
+	}
+	_, seenOld := r.lastSeenStore.LastSeen(oldID)
+	if !seenOld && !r.areaStore.ProbeAssigned(oldID) {
+		http.Error(w, "probe not found", http.StatusNotFound)
+		return
+	}
+
+	r.areaStore.RenameProbe(oldID, newID)
+	r.readingStore.Rename(oldID, newID)
+	r.historyStore.Rename(oldID, newID)
+	r.lastSeenStore.Rename(oldID, newID)
+	r.firmwareStore.Rename(oldID, newID)
+	r.batteryStore.Rename(oldID, newID)
+	r.activityStore.Rename(oldID, newID)
+
+	response := map[string]any{
+		"status":     "renamed",
+		"probeId":    newID,
+		"previousId": oldID,
+	}
+	area, location, assigned := r.areaStore.FindProbe(newID)
+	response["assigned"] = assigned
+	if assigned {
+		response["area"] = area
+		response["location"] = location
+		// Log under both IDs so each one's history explains where the assignment went
+		now := time.Now()
+		r.assignmentLog.Record(AssignmentEvent{ProbeID: oldID, Action: assignmentRenamed, Area: area, Location: location, Timestamp: now, RenamedTo: newID})
+		r.assignmentLog.Record(AssignmentEvent{ProbeID: newID, Action: assignmentRenamed, Area: area, Location: location, Timestamp: now, RenamedFrom: oldID})
+	}
+	if reading, ok := r.readingStore.GetReading(newID); ok {
+		response["reading"] = reading
+	}
+	if lastSeen, ok := r.lastSeenStore.LastSeen(newID); ok {
+		response["lastSeen"] = lastSeen
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleProbeHistory returns the recorded history of one metric for a probe
+func (r *router) handleProbeHistory(w http.ResponseWriter, req *http.Request, probeID string) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metric := req.URL.Query().Get("metric")
+	if metric == "" {
+		http.Error(w, "metric required", http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	points := r.historyStore.Series(probeID, metric, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"probeId": probeID,
+		"metric":  strings.ToLower(metric),
+		"points":  points,
+		"count":   len(points),
+	})
+}
+
+// handleProbeSmoothed returns an exponential moving average over a probe metric's history
+func (r *router) handleProbeSmoothed(w http.ResponseWriter, req *http.Request, probeID string) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metric := req.URL.Query().Get("metric")
+	if metric == "" {
+		http.Error(w, "metric required", http.StatusBadRequest)
+		return
+	}
+	alpha := 0.3
+	if alphaStr := req.URL.Query().Get("alpha"); alphaStr != "" {
+		parsed, err := strconv.ParseFloat(alphaStr, 64)
+		// NaN fails every comparison, so it has to be rejected explicitly
+		if err != nil || math.IsNaN(parsed) || parsed <= 0 || parsed > 1 {
+			http.Error(w, "alpha must be in (0,1]", http.StatusBadRequest)
+			return
+		}
+		alpha = parsed
+	}
 
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	points := r.historyStore.Series(probeID, metric, 0)
+	if len(points) == 0 {
+		http.Error(w, "no history for probe metric", http.StatusBadRequest)
 		return
 	}
 
+	// Seed with the first value, then s = alpha*x + (1-alpha)*s
+	smoothed := make([]Point, len(points))
+	value := points[0].Value
+	for i, p := range points {
+		value = alpha*p.Value + (1-alpha)*value
+		smoothed[i] = Point{Timestamp: p.Timestamp, Value: value}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"probeId": probeID,
+		"metric":  strings.ToLower(metric),
+		"alpha":   alpha,
+		"points":  smoothed,
+		"latest":  value,
+		"count":   len(smoothed),
+	})
+}
+
+func (r *router) handleSendCommand(w http.ResponseWriter, req *http.Request) {
 	if req.Method == "POST" {
 		var body struct {
+			ProbeID string `json:"probeId"` // Optional; empty targets the default queue
 			Command string `json:"command"`
 		}
 		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
@@ -682,31 +2263,31 @@ func (r *router) handleSendCommand(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		r.sendCommandValue = cmd
-		r.sendCommandReceived = false
+		queued := r.commandQueue.Enqueue(body.ProbeID, cmd)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "queued",
-			"command": cmd,
+			"status":    queued.Status,
+			"commandId": queued.ID,
+			"command":   queued.Command,
+			"probeId":   queued.ProbeID,
+			"pending":   r.commandQueue.Pending(queued.ProbeID),
 		})
 		return
 	}
 
 	if req.Method == "GET" {
-		command := r.sendCommandValue
-		available := command != ""
-
-		if available {
-			// Mark as received and clear the command
-			r.sendCommandValue = ""
-			r.sendCommandReceived = true
-		}
+		// Probes pull their own queue; without a probe ID the default queue is used
+		probeID := normalizeCommandProbeID(req.URL.Query().Get("probeId"))
+		command, available := r.commandQueue.Dequeue(probeID)
 
+		// The probe echoes commandId back to /api/sendcommand/ack once executed
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
-			"command":   command,
+			"command":   command.Command,
+			"commandId": command.ID,
 			"available": available,
+			"probeId":   probeID,
 		})
 		return
 	}
@@ -714,22 +2295,69 @@ func (r *router) handleSendCommand(w http.ResponseWriter, req *http.Request) {
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (r *router) handleSendCommandReceived(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+func (r *router) handleSendCommandAck(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		CommandID string `json:"commandId"`
+		Result    string `json:"result"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if strings.TrimSpace(body.CommandID) == "" {
+		http.Error(w, "commandId required", http.StatusBadRequest)
+		return
+	}
+
+	command, err := r.commandQueue.Ack(body.CommandID, body.Result)
+	if errors.Is(err, errCommandNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		// Acking a command that is still queued or already acked
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(command)
+}
+
+func (r *router) handleSendCommandStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	commandID := req.URL.Query().Get("commandId")
+	if strings.TrimSpace(commandID) == "" {
+		http.Error(w, "commandId required", http.StatusBadRequest)
+		return
+	}
 
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	command, ok := r.commandQueue.Get(commandID)
+	if !ok {
+		http.Error(w, errCommandNotFound.Error(), http.StatusNotFound)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(command)
+}
+
+func (r *router) handleSendCommandReceived(w http.ResponseWriter, req *http.Request) {
 	if req.Method == "GET" {
+		// Received once every queued command for the probe has been pulled
+		probeID := normalizeCommandProbeID(req.URL.Query().Get("probeId"))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
-			"received": r.sendCommandReceived,
+			"received": r.commandQueue.Pending(probeID) == 0,
 		})
 		return
 	}
@@ -738,24 +2366,30 @@ func (r *router) handleSendCommandReceived(w http.ResponseWriter, req *http.Requ
 }
 
 func (r *router) handlePixels(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if req.Method == "GET" {
-		// Get all pixel counts
-		pixelCounts := r.pixelStore.GetPixels()
+		since, err := parseTimeParam(req, "since")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if since.IsZero() {
+			// Get all pixel counts
+			pixelCounts := r.pixelStore.GetPixels()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"pixelCount": pixelCounts,
+			})
+			return
+		}
 
+		// ?since= returns only the areas that changed, with the time to pass as the next since
+		// The time is taken first, so a change landing mid-request is sent again rather than missed
+		asOf := time.Now()
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
-			"pixelCount": pixelCounts,
+			"pixelCount": r.pixelStore.ChangedSince(since),
+			"timestamp":  asOf,
 		})
 		return
 	}
@@ -764,7 +2398,7 @@ func (r *router) handlePixels(w http.ResponseWriter, req *http.Request) {
 		// Read the JSON body - support both array format and object format
 		bodyBytes, err := io.ReadAll(req.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBodyError(w, err)
 			return
 		}
 
@@ -811,85 +2445,103 @@ func (r *router) handlePixels(w http.ResponseWriter, req *http.Request) {
 			})
 		}
 
-		// Update pixel counts
-		r.pixelStore.UpdatePixels(pixelCounts)
-		r.pixelLastUpdated = time.Now()
+		// Areas the area store doesn't know are likely typos the dashboard can't map
+		// Lenient mode stores them and flags them; strict mode drops them
+		accepted, unknown := r.splitUnknownPixelAreas(pixelCounts)
+		response := map[string]any{"status": "received"}
+		if r.cfg.StrictPixelAreas {
+			pixelCounts = accepted
+			response["rejected"] = unknown
+		} else if len(unknown) > 0 {
+			response["unknownAreas"] = unknown
+		}
+
+		// Update pixel counts; values outside 0 to PIXEL_MAX are left out and reported back
+		if invalid := r.pixelStore.UpdatePixels(pixelCounts); len(invalid) > 0 {
+			response["invalid"] = invalid
+		}
+		r.metrics.pixelUpdates.Add(1)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "received",
-		})
+		json.NewEncoder(w).Encode(response)
 		return
 	}
 
 	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (r *router) handlePixelTimestamp(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if req.Method == "GET" {
-		var iso string
-		if !r.pixelLastUpdated.IsZero() {
-			iso = r.pixelLastUpdated.UTC().Format(time.RFC3339)
+// splitUnknownPixelAreas separates pixel counts for areas the area store knows from the rest,
+// returning the unknown area names (uppercased, as the pixel store keys them) once each
+func (r *router) splitUnknownPixelAreas(pixelCounts []PixelCount) (known []PixelCount, unknown []string) {
+	unknown = []string{}
+	seen := make(map[string]bool)
+	for _, pc := range pixelCounts {
+		area := strings.ToUpper(strings.TrimSpace(pc.Area))
+		// Entries without an area are left for UpdatePixels to skip
+		// The pixel store doesn't apply aliases, so an alias of a known area is still unknown
+		if _, ok := r.areaStore.GetLocations(area); (ok && r.normalizer.normalizeArea(area) == area) || area == "" {
+			known = append(known, pc)
+			continue
+		}
+		if !seen[area] {
+			seen[area] = true
+			unknown = append(unknown, area)
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
-			"lastUpdated": iso,
-		})
-		return
 	}
-
-	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return known, unknown
 }
 
-func (r *router) handleProbeConfig(w http.ResponseWriter, req *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle CORS preflight
-	if req.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+// handlePixelHistory returns the last hour of pixel counts for an area
+func (r *router) handlePixelHistory(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if req.Method == "GET" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
-			"refresh": r.probeRefreshInterval,
-		})
+	area := strings.ToUpper(strings.TrimSpace(req.URL.Query().Get("area")))
+	if area == "" {
+		http.Error(w, "area required", http.StatusBadRequest)
 		return
 	}
+	history := r.pixelStore.GetHistory(area)
 
-	if req.Method == "POST" || req.Method == "PUT" {
-		var body struct {
-			Refresh int `json:"refresh"`
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"area":    area,
+		"history": history,
+		"count":   len(history),
+	})
+}
+
+func (r *router) handlePixelTimestamp(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		// lastUpdated stays the most recent update across all areas for older clients
+		var latest time.Time
+		areas := make(map[string]string)
+		for area, t := range r.pixelStore.LastUpdated() {
+			areas[area] = t.UTC().Format(time.RFC3339)
+			if t.After(latest) {
+				latest = t
+			}
 		}
-		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		var iso string
+		if !latest.IsZero() {
+			iso = latest.UTC().Format(time.RFC3339)
 		}
-		if body.Refresh < 1 {
-			http.Error(w, "refresh must be at least 1 second", http.StatusBadRequest)
-			return
+
+		// ?area=POOL narrows the response to a single area
+		if area := strings.ToUpper(strings.TrimSpace(req.URL.Query().Get("area"))); area != "" {
+			iso = areas[area]
+			areas = map[string]string{}
+			if iso != "" {
+				areas[area] = iso
+			}
 		}
-		r.probeRefreshInterval = body.Refresh
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
-			"refresh": r.probeRefreshInterval,
-			"status":  "updated",
+			"lastUpdated": iso,
+			"areas":       areas,
 		})
 		return
 	}
@@ -898,6 +2550,8 @@ func (r *router) handleProbeConfig(w http.ResponseWriter, req *http.Request) {
 }
 
 func (r *router) handleWebSocket(w http.ResponseWriter, req *http.Request) {
+	// Must happen before the upgrade, while the response controller can still reach the connection
+	clearDeadlines(w)
 	conn, err := r.upgrader.Upgrade(w, req, nil)
 	if err != nil {
 		log.Printf("websocket upgrade error: %v", err)
@@ -905,40 +2559,176 @@ func (r *router) handleWebSocket(w http.ResponseWriter, req *http.Request) {
 	}
 	defer conn.Close()
 
-	r.messageStore.clients[conn] = true
+	// A reconnecting client passes the last sequence it saw to be caught up
+	// Replay is bounded by the message store size; compare oldestSeq to detect unrecoverable gaps
+	var since int64
+	if sinceStr := req.URL.Query().Get("since"); sinceStr != "" {
+		if parsed, err := strconv.ParseInt(sinceStr, 10, 64); err == nil && parsed > 0 {
+			since = parsed
+		}
+	}
 
-	// Send initial messages
-	messages := r.messageStore.GetMessages()
-	if err := conn.WriteJSON(messages); err != nil {
+	// Register before taking the snapshot so no message is missed, and hold the write lock
+	// so live broadcasts queue up behind the initial frames
+	client := r.messageStore.addClient(conn)
+	client.writeMu.Lock()
+	messages, oldestSeq, latestSeq := r.messageStore.ReplaySince(since)
+
+	// Send the current sequence range, then the initial (or catch-up) messages
+	err = conn.WriteJSON(newWSEnvelope("sync", map[string]any{
+		"latestSeq": latestSeq,
+		"oldestSeq": oldestSeq,
+		"since":     since,
+	}))
+	if err == nil {
+		err = conn.WriteJSON(newWSEnvelope("snapshot", messages))
+	}
+	client.writeMu.Unlock()
+	if err != nil {
 		log.Printf("websocket write error: %v", err)
-		delete(r.messageStore.clients, conn)
+		r.messageStore.removeClient(conn)
 		return
 	}
 
+	// Ping on an interval and expect a pong (or any frame) before two intervals pass,
+	// so connections that died without a close are pruned instead of leaking
+	pingInterval := time.Duration(r.cfg.WSPingIntervalSeconds) * time.Second
+	if pingInterval <= 0 {
+		pingInterval = 30 * time.Second
+	}
+	pongWait := 2 * pingInterval
+	// Clients only send small control requests; a frame over the limit fails the read
+	// and gorilla/websocket closes the connection with 1009 (message too big)
+	conn.SetReadLimit(int64(r.cfg.WSMaxMessageBytes))
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// WriteControl may be called concurrently with the other writers
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					log.Printf("websocket ping error: %v", err)
+					client.close(websocket.CloseGoingAway, wsCloseReason{Reason: "ping failed"})
+					return
+				}
+			case <-stopPing:
+				return
+			}
+		}
+	}()
+
 	// Keep connection alive and handle incoming messages
+	// {"subscribe":["FLOOR16","POOL"]} limits broadcasts to those areas
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
+		if errors.Is(err, websocket.ErrReadLimit) {
+			log.Printf("websocket client %s sent a frame over %d bytes, disconnecting", req.RemoteAddr, r.cfg.WSMaxMessageBytes)
+			break
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			log.Printf("websocket client %s missed its pongs, disconnecting", req.RemoteAddr)
+			client.close(websocket.CloseGoingAway, wsCloseReason{Reason: "ping timeout"})
+			break
+		}
 		if err != nil {
 			log.Printf("websocket read error: %v", err)
 			break
 		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var request struct {
+			Subscribe *[]string `json:"subscribe"`
+		}
+		if err := json.Unmarshal(data, &request); err != nil || request.Subscribe == nil {
+			continue // Not a subscription request
+		}
+		areas := client.subscribe(*request.Subscribe, r.normalizer)
+		if err := client.writeJSON(newWSEnvelope("subscribed", map[string]any{
+			"areas": areas,
+		})); err != nil {
+			log.Printf("websocket write error: %v", err)
+			break
+		}
 	}
 
-	delete(r.messageStore.clients, conn)
+	r.messageStore.removeClient(conn)
 }
 
-func (r *router) handleBroadcast() {
-	for msg := range r.messageStore.broadcast {
-		clients := make([]*websocket.Conn, 0, len(r.messageStore.clients))
-		for conn := range r.messageStore.clients {
-			clients = append(clients, conn)
+// frameArea returns the area a broadcast frame belongs to for subscription filtering
+// Frames that aren't tied to an area report false and go to every client, including
+// messages whose probe ID can't be parsed
+func (r *router) frameArea(frame any) (string, bool) {
+	switch f := frame.(type) {
+	case ProbeMessage:
+		probeID, _, err := splitProbeID(f.Data, r.cfg.MaxProbeIDLength)
+		if err != nil {
+			return "", false
 		}
+		return r.probeArea(probeID), true
+	case ThresholdAlert:
+		return r.normalizer.normalizeArea(f.Area), true
+	case MessageRepeat:
+		return r.probeArea(f.ProbeID), true
+	case ProbeStatusEvent:
+		return r.probeArea(f.ProbeID), true
+	case BatteryAlert:
+		return r.normalizer.normalizeArea(f.Area), true
+	}
+	return "", false
+}
+
+// probeArea returns the normalized area a probe is assigned to, or would be assigned to by its ID
+func (r *router) probeArea(probeID string) string {
+	area, _, ok := r.areaStore.FindProbe(probeID)
+	if !ok {
+		area, _ = r.parseProbeID(probeID)
+	}
+	return r.normalizer.normalizeArea(area)
+}
 
-		for _, conn := range clients {
-			if err := conn.WriteJSON(msg); err != nil {
+func (r *router) handleBroadcast() {
+	defer r.broadcastRunning.Store(false)
+	for {
+		var msg any
+		select {
+		case msg = <-r.messageStore.broadcast:
+		case <-r.done:
+			return
+		}
+		var frame wsEnvelope
+		switch m := msg.(type) {
+		case ProbeMessage:
+			r.messageStore.publishStream(m)
+			frame = newWSEnvelope("message", m)
+		case MessageRepeat:
+			frame = newWSEnvelope("repeat", m)
+		case ThresholdAlert:
+			frame = newWSEnvelope("alert", m)
+		case ProbeStatusEvent:
+			frame = newWSEnvelope("probe_status", m)
+		case BatteryAlert:
+			frame = newWSEnvelope("low_battery", m)
+		default:
+			log.Printf("websocket broadcast: dropping frame of unknown type %T", msg)
+			continue
+		}
+		area, filtered := r.frameArea(msg)
+		for _, client := range r.messageStore.snapshotClients() {
+			if filtered && !client.wantsArea(area) {
+				continue
+			}
+			if err := client.writeJSON(frame); err != nil {
 				log.Printf("websocket broadcast error: %v", err)
-				delete(r.messageStore.clients, conn)
-				conn.Close()
+				r.messageStore.removeClient(client.conn)
+				client.close(websocket.CloseGoingAway, wsCloseReason{Reason: "write failed"})
 			}
 		}
 	}
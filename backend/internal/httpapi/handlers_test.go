@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+// gzipString compresses s for a Content-Encoding: gzip body
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestProbeDataContentEncoding(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.MaxDecompressedBytes = 1024
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		want     int
+	}{
+		{"plain", "F16R co2=454", "", http.StatusOK},
+		{"gzip", gzipString(t, "F16R co2=454"), "gzip", http.StatusOK},
+		{"gzip mixed case", gzipString(t, "F16R co2=454"), " GZip ", http.StatusOK},
+		{"invalid gzip", "F16R co2=454", "gzip", http.StatusBadRequest},
+		{"decompression bomb", gzipString(t, "F16R co2="+strings.Repeat("9", 4096)), "gzip", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Content-Type": "text/plain"}
+			if tt.encoding != "" {
+				headers["Content-Encoding"] = tt.encoding
+			}
+			rec := serve(rt, "POST", "/api/probedata", tt.body, headers)
+			expectStatus(t, rec, tt.want)
+			if tt.want != http.StatusOK {
+				return
+			}
+			var resp struct {
+				ProbeID string             `json:"probeId"`
+				Metrics map[string]float64 `json:"metrics"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if resp.ProbeID != "F16R" || resp.Metrics["co2"] != 454 {
+				t.Errorf("response = %s, want F16R with co2=454", rec.Body)
+			}
+		})
+	}
+}
+
+func TestLoadProbeAssignmentsMergesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assignments.json")
+	file := `{"f14r": {"area": "floor14", "location": "rotunda"}, "F16R": {"area": "LAB", "location": "BENCH"}, "BAD1": {"area": ""}}`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	assignments := loadProbeAssignments(path)
+	want := map[string]probeAssignment{
+		"F14R": {Area: "FLOOR14", Location: "ROTUNDA"}, // Added, normalized to upper case
+		"F16R": {Area: "LAB", Location: "BENCH"},       // Overrides the built-in entry
+		"F17R": fixedProbeAssignments["F17R"],          // Built-in entries are kept
+	}
+	for id, assignment := range want {
+		if assignments[id] != assignment {
+			t.Errorf("assignments[%s] = %+v, want %+v", id, assignments[id], assignment)
+		}
+	}
+	if _, ok := assignments["BAD1"]; ok {
+		t.Error("incomplete entry was loaded")
+	}
+}
+
+func TestLoadProbeAssignmentsFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{
+		"unset":   "",
+		"missing": filepath.Join(dir, "missing.json"),
+		"invalid": invalid,
+	} {
+		assignments := loadProbeAssignments(path)
+		if len(assignments) != len(fixedProbeAssignments) {
+			t.Errorf("%s: loaded %d assignments, want the %d built-in ones", name, len(assignments), len(fixedProbeAssignments))
+		}
+		for id, assignment := range fixedProbeAssignments {
+			if assignments[id] != assignment {
+				t.Errorf("%s: assignments[%s] = %+v, want %+v", name, id, assignments[id], assignment)
+			}
+		}
+	}
+}
+
+func TestRequireKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		accessKey string
+		method    string
+		target    string
+		key       string
+		want      int
+	}{
+		{"no key configured", "", "POST", "/api/clear", "", http.StatusOK},
+		{"missing key", "s3cret", "POST", "/api/clear", "", http.StatusUnauthorized},
+		{"wrong key", "s3cret", "POST", "/api/clear", "guess", http.StatusUnauthorized},
+		{"valid key", "s3cret", "POST", "/api/clear", "s3cret", http.StatusOK},
+		{"read on a write-protected route", "s3cret", "GET", "/api/thresholds/FLOOR16", "", http.StatusOK},
+		{"write on a write-protected route", "s3cret", "DELETE", "/api/probes/F16R", "", http.StatusUnauthorized},
+		{"read on a fully protected route", "s3cret", "GET", "/api/config", "", http.StatusUnauthorized},
+		{"unprotected ingestion", "s3cret", "POST", "/api/probedata", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := newTestRouter(t, func(cfg *config.Config) {
+				cfg.AccessKey = tt.accessKey
+			})
+			headers := map[string]string{}
+			if tt.key != "" {
+				headers["X-Access-Key"] = tt.key
+			}
+			body := ""
+			if tt.target == "/api/probedata" {
+				body = "F16R co2=454"
+			}
+			expectStatus(t, serve(rt, tt.method, tt.target, body, headers), tt.want)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// checkWritable reports whether the file at path can be written, creating it if needed
+// An existing file is opened without truncating it; a missing one is checked via its directory
+func checkWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".probemaster-healthz-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// handleReadiness reports whether every subsystem is able to serve traffic
+// Returns 503 if the broadcaster has stopped or a configured persistence file is unwritable
+func (r *router) handleReadiness(w http.ResponseWriter, req *http.Request) {
+	checks := map[string]string{}
+	healthy := true
+	fail := func(name, reason string) {
+		checks[name] = reason
+		healthy = false
+	}
+
+	if r.broadcastRunning.Load() {
+		checks["broadcast"] = "ok"
+	} else {
+		fail("broadcast", "not running")
+	}
+
+	persisted := map[string]string{
+		"messageLog":    r.cfg.MessageLogPath,
+		"areaStore":     r.cfg.AreaStorePath,
+		"assignmentLog": r.cfg.AssignmentLogPath,
+		"displayConfig": r.displayStore.path,
+		"areaOrder":     r.areaOrder.path,
+		"probeConfig":   r.probeConfig.path,
+	}
+	for name, path := range persisted {
+		if path == "" {
+			continue // Persistence disabled
+		}
+		if err := checkWritable(path); err != nil {
+			fail(name, err.Error())
+			continue
+		}
+		checks[name] = "ok"
+	}
+
+	status, code := "ok", http.StatusOK
+	if !healthy {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"checks": checks,
+	})
+}
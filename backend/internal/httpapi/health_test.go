@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+// readinessChecks returns the status code and checks reported by /healthz
+func readinessChecks(t *testing.T, rt *Router) (int, map[string]string) {
+	t.Helper()
+	rec := serve(rt, "GET", "/healthz", "", nil)
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return rec.Code, body.Checks
+}
+
+func TestReadinessChecksAssignmentLog(t *testing.T) {
+	dir := t.TempDir()
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AssignmentLogPath = filepath.Join(dir, "assignments.jsonl")
+	})
+	if code, checks := readinessChecks(t, rt); code != http.StatusOK || checks["assignmentLog"] != "ok" {
+		t.Errorf("healthz = %d %v, want 200 with assignmentLog ok", code, checks)
+	}
+
+	missing := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AssignmentLogPath = filepath.Join(dir, "missing", "assignments.jsonl")
+	})
+	if code, checks := readinessChecks(t, missing); code != http.StatusServiceUnavailable || checks["assignmentLog"] == "ok" {
+		t.Errorf("healthz = %d %v, want 503 with assignmentLog failing", code, checks)
+	}
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyEntry is the result originally returned for an idempotency key
+// done is closed once the upload holding the key has stored its messages or given the key up
+type idempotencyEntry struct {
+	results []batchResult // One per line; a single-line upload has one
+	expires time.Time
+	done    chan struct{}
+}
+
+// completed reports whether the upload holding the entry has finished
+func (entry *idempotencyEntry) completed() bool {
+	select {
+	case <-entry.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// idempotencyStore remembers recent Idempotency-Key values so probe retries
+// within the window return the original message instead of storing a duplicate
+type idempotencyStore struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]*idempotencyEntry // key -> original message
+	lastPrune time.Time
+}
+
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Reserve claims key for a new upload, returning reserved=true and a pending entry to
+// Complete or Release. If the key was already used within the window it returns the
+// original entry instead; a retry racing the original waits for it to finish first
+func (is *idempotencyStore) Reserve(key string, now time.Time) (entry *idempotencyEntry, reserved bool) {
+	for {
+		is.mu.Lock()
+		is.pruneLocked(now)
+		entry, ok := is.entries[key]
+		if !ok || entry.completed() && now.After(entry.expires) {
+			entry = &idempotencyEntry{done: make(chan struct{})}
+			is.entries[key] = entry
+			is.mu.Unlock()
+			return entry, true
+		}
+		is.mu.Unlock()
+
+		<-entry.done
+		is.mu.Lock()
+		stored := entry.results != nil
+		is.mu.Unlock()
+		if stored {
+			return entry, false
+		}
+		// The upload holding the key was rejected, so this one may claim it
+	}
+}
+
+// Complete records the results of the upload under a reserved key until the window elapses
+func (is *idempotencyStore) Complete(entry *idempotencyEntry, results []batchResult, now time.Time) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if entry.completed() {
+		return
+	}
+	entry.results = results
+	entry.expires = now.Add(is.window)
+	close(entry.done)
+}
+
+// Release gives up a reserved key whose upload stored nothing, so a corrected retry isn't
+// treated as a duplicate; it does nothing once the entry is completed
+func (is *idempotencyStore) Release(key string, entry *idempotencyEntry) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if entry.completed() {
+		return
+	}
+	if is.entries[key] == entry {
+		delete(is.entries, key)
+	}
+	close(entry.done)
+}
+
+// Original returns the results recorded for a completed entry
+func (is *idempotencyStore) Original(entry *idempotencyEntry) []batchResult {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return entry.results
+}
+
+// pruneLocked sweeps expired keys at most once per window so the map stays small
+// Pending reservations are kept however old they are
+func (is *idempotencyStore) pruneLocked(now time.Time) {
+	if now.Sub(is.lastPrune) < is.window {
+		return
+	}
+	for k, entry := range is.entries {
+		if entry.completed() && now.After(entry.expires) {
+			delete(is.entries, k)
+		}
+	}
+	is.lastPrune = now
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStoreDedupAndExpiry(t *testing.T) {
+	is := newIdempotencyStore(30 * time.Second)
+	now := time.Now()
+
+	entry, reserved := is.Reserve("key-1", now)
+	if !reserved {
+		t.Fatal("first Reserve was not reserved")
+	}
+	is.Complete(entry, []batchResult{{ID: "7", Timestamp: &now, Status: "received"}}, now)
+
+	original, reserved := is.Reserve("key-1", now.Add(10*time.Second))
+	if reserved {
+		t.Fatal("retry within the window was reserved again")
+	}
+	if results := is.Original(original); len(results) != 1 || results[0].ID != "7" {
+		t.Errorf("original results = %+v, want id 7", results)
+	}
+
+	if _, reserved := is.Reserve("key-1", now.Add(31*time.Second)); !reserved {
+		t.Error("key was not reusable after the window elapsed")
+	}
+}
+
+func TestIdempotencyStoreReleaseAllowsRetry(t *testing.T) {
+	is := newIdempotencyStore(30 * time.Second)
+	now := time.Now()
+
+	entry, _ := is.Reserve("key-1", now)
+	is.Release("key-1", entry)
+	if _, reserved := is.Reserve("key-1", now); !reserved {
+		t.Error("released key was treated as a duplicate")
+	}
+}
+
+func TestProbeDataConcurrentRetriesStoreOnce(t *testing.T) {
+	rt := newTestRouter(t, nil)
+
+	const retries = 20
+	ids := make([]string, retries)
+	var wg sync.WaitGroup
+	for i := range retries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := serve(rt, "POST", "/api/probedata", "F16R co2=454", map[string]string{"Idempotency-Key": "reading-1"})
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", rec.Code)
+				return
+			}
+			var resp struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			ids[i] = resp.ID
+		}()
+	}
+	wg.Wait()
+
+	if stored := len(rt.r.messageStore.GetMessages()); stored != 1 {
+		t.Errorf("stored %d messages, want 1", stored)
+	}
+	for i, id := range ids {
+		if id != ids[0] {
+			t.Errorf("retry %d got id %q, want %q", i, id, ids[0])
+		}
+	}
+}
+
+func TestProbeDataMultiLineIdempotency(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	headers := map[string]string{"Idempotency-Key": "batch-1"}
+	body := "F16R co2=454\nno-probe-id\nF17R co2=500\n"
+
+	first := serve(rt, "POST", "/api/probedata", body, headers)
+	expectStatus(t, first, http.StatusOK)
+	var original struct {
+		Results  []batchResult `json:"results"`
+		Received int           `json:"received"`
+	}
+	json.Unmarshal(first.Body.Bytes(), &original)
+	// Lines are stored as leniently as a single-line body, even without a probe ID
+	if original.Received != 3 {
+		t.Fatalf("received = %d, want 3: %s", original.Received, first.Body)
+	}
+
+	retry := serve(rt, "POST", "/api/probedata", body, headers)
+	expectStatus(t, retry, http.StatusOK)
+	var duplicate struct {
+		Results   []batchResult `json:"results"`
+		Duplicate bool          `json:"duplicate"`
+	}
+	json.Unmarshal(retry.Body.Bytes(), &duplicate)
+	if !duplicate.Duplicate || len(duplicate.Results) != 3 || duplicate.Results[0].ID != original.Results[0].ID {
+		t.Errorf("retry = %s, want the original results marked duplicate", retry.Body)
+	}
+	if stored := len(rt.r.messageStore.GetMessages()); stored != 3 {
+		t.Errorf("stored %d messages, want 3", stored)
+	}
+}
@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// Message ID schemes selectable with MESSAGE_ID_SCHEME
+const (
+	messageIDCounter = "counter" // <unix nanos>-<seq>, the original format
+	messageIDUUIDv7  = "uuidv7"  // Time-ordered RFC 9562 UUIDs
+)
+
+// uuidV7Generator produces UUIDv7 strings that sort in the order they were generated, even within
+// one millisecond or if the clock steps back
+// The 12 rand_a bits hold a counter that starts at a random value each millisecond and borrows
+// the next millisecond when it overflows (RFC 9562 section 6.2, method 1)
+type uuidV7Generator struct {
+	lastMs  int64
+	counter uint16
+}
+
+// next returns a new UUIDv7; callers serialize access (MessageStore holds ms.mu)
+func (g *uuidV7Generator) next(now time.Time) string {
+	var random [10]byte
+	rand.Read(random[:])
+
+	ms := now.UnixMilli()
+	switch {
+	case ms > g.lastMs:
+		// Start low enough in the counter space to leave room for more IDs this millisecond
+		g.counter = binary.BigEndian.Uint16(random[:2]) & 0x7ff
+	case g.counter < 0xfff:
+		ms = g.lastMs
+		g.counter++
+	default:
+		ms = g.lastMs + 1
+		g.counter = 0
+	}
+	g.lastMs = ms
+
+	var u [16]byte
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = 0x70 | byte(g.counter>>8) // Version 7
+	u[7] = byte(g.counter)
+	copy(u[8:], random[2:])
+	u[8] = 0x80 | u[8]&0x3f // RFC 9562 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// isUUID reports whether id has the canonical lowercase 8-4-4-4-12 UUID form
+func isUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
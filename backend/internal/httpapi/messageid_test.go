@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestUUIDv7Format(t *testing.T) {
+	var g uuidV7Generator
+	now := time.UnixMilli(1763076021254)
+	id := g.next(now)
+	if !isUUID(id) {
+		t.Fatalf("%q is not a UUID", id)
+	}
+	if id[14] != '7' {
+		t.Errorf("version nibble = %c, want 7", id[14])
+	}
+	if !strings.ContainsRune("89ab", rune(id[19])) {
+		t.Errorf("variant nibble = %c, want 8-b", id[19])
+	}
+	ms, err := strconv.ParseInt(strings.ReplaceAll(id[:13], "-", ""), 16, 64)
+	if err != nil || ms != now.UnixMilli() {
+		t.Errorf("timestamp = %d (%v), want %d", ms, err, now.UnixMilli())
+	}
+}
+
+func TestUUIDv7SortsInGenerationOrder(t *testing.T) {
+	var g uuidV7Generator
+	now := time.UnixMilli(1763076021254)
+	var ids []string
+	// Many IDs in one millisecond overflow the counter, and a clock step back must not reorder them
+	for i := range 10000 {
+		ids = append(ids, g.next(now))
+		if i == 5000 {
+			now = now.Add(-time.Second)
+		}
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatal("UUIDv7s are not in generation order")
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"019a7f4e-2b3c-7a1d-9e4f-0c2b5d6e7f80": true,
+		"019A7F4E-2B3C-7A1D-9E4F-0C2B5D6E7F80": false,
+		"019a7f4e2b3c7a1d9e4f0c2b5d6e7f80":     false,
+		"1763076021254509129-56":               false,
+		"019a7f4e-2b3c-7a1d-9e4f-0c2b5d6e7f8g": false,
+	} {
+		if got := isUUID(id); got != want {
+			t.Errorf("isUUID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestMessageStoreUUIDv7IDs(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.MessageIDScheme = "uuidv7"
+		cfg.MessageStoreSize = 3
+	})
+	ms := rt.r.messageStore
+	var sent []ProbeMessage
+	for i := range 5 {
+		sent = append(sent, ms.AddMessage("F16R co2="+strconv.Itoa(400+i)))
+	}
+	for i, msg := range sent {
+		if !isUUID(msg.ID) {
+			t.Errorf("message %d ID %q is not a UUID", i, msg.ID)
+		}
+		if msg.Seq != int64(i+1) {
+			t.Errorf("message %d seq = %d, want %d", i, msg.Seq, i+1)
+		}
+	}
+
+	// Pagination still works from a stored ID and from an evicted one
+	if got := ms.GetMessagesAfter(sent[3].ID, 10); len(got) != 1 || got[0].ID != sent[4].ID {
+		t.Errorf("after stored ID = %+v, want only %s", got, sent[4].ID)
+	}
+	if got := ms.GetMessagesAfter(sent[0].ID, 10); len(got) != 3 || got[0].ID != sent[2].ID {
+		t.Errorf("after evicted ID = %+v, want the 3 stored messages", got)
+	}
+	if got := ms.GetMessagesBefore(sent[3].ID, 10); len(got) != 1 || got[0].ID != sent[2].ID {
+		t.Errorf("before stored ID = %+v, want only %s", got, sent[2].ID)
+	}
+
+	// A deleted message's ID resolves to where it sat
+	if !ms.DeleteByID(sent[3].ID) {
+		t.Fatalf("DeleteByID(%s) = false", sent[3].ID)
+	}
+	if got := ms.GetMessagesAfter(sent[3].ID, 10); len(got) != 1 || got[0].ID != sent[4].ID {
+		t.Errorf("after deleted ID = %+v, want only %s", got, sent[4].ID)
+	}
+}
+
+func TestMessageStoreDefaultsToCounterIDs(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	msg := rt.r.messageStore.AddMessage("F16R co2=400")
+	if !strings.HasSuffix(msg.ID, "-"+strconv.FormatInt(msg.Seq, 10)) {
+		t.Errorf("ID %q doesn't end in -<seq>", msg.ID)
+	}
+}
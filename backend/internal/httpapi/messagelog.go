@@ -0,0 +1,184 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+)
+
+// messageLog appends probe messages to a JSON-lines file in the background
+// so that slow disks never block ingestion
+// A message appended again with the same seq (a repeat count update) replaces the earlier line on load
+type messageLog struct {
+	path string
+	ops  chan logOp    // Messages to append
+	wake chan struct{} // Signals a pending rewrite; buffered so Rewrite never blocks
+	done chan struct{} // Closed once the writer has flushed and exited
+
+	mu             sync.Mutex // Guards queued and the pending rewrite
+	queued         int64      // Appends queued since the log was opened
+	pending        []ProbeMessage
+	pendingThrough int64 // Appends the pending snapshot accounts for
+	hasPending     bool
+}
+
+// logOp is a queued append, numbered so a rewrite can skip the appends its snapshot covers
+type logOp struct {
+	msg ProbeMessage
+	num int64
+}
+
+// openMessageLog starts the background writer for the log at path
+func openMessageLog(path string) *messageLog {
+	ml := &messageLog{
+		path: path,
+		ops:  make(chan logOp, 1024),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go ml.run()
+	return ml
+}
+
+// Append queues a message for writing, dropping it if the writer is backed up
+// Appends and rewrites must be called in the order the store changed, e.g. under its lock
+func (ml *messageLog) Append(msg ProbeMessage) {
+	ml.mu.Lock()
+	ml.queued++
+	op := logOp{msg: msg, num: ml.queued}
+	ml.mu.Unlock()
+
+	select {
+	case ml.ops <- op:
+	default:
+		log.Printf("message log: writer backed up, dropping message %s", msg.ID)
+	}
+}
+
+// Rewrite schedules a replacement of the log contents, e.g. after the store is cleared
+// Appends queued before it are already reflected in the snapshot (or were deleted) and are skipped
+// It never blocks: a rewrite still pending when another arrives is replaced by the newer one
+func (ml *messageLog) Rewrite(snapshot []ProbeMessage) {
+	ml.mu.Lock()
+	ml.pending = snapshot
+	ml.pendingThrough = ml.queued
+	ml.hasPending = true
+	ml.mu.Unlock()
+
+	select {
+	case ml.wake <- struct{}{}:
+	default: // The writer has already been woken and will pick up the latest snapshot
+	}
+}
+
+// Close waits for queued writes to finish; no further ops may be queued
+func (ml *messageLog) Close() {
+	close(ml.ops)
+	<-ml.done
+}
+
+func (ml *messageLog) run() {
+	defer close(ml.done)
+	f, err := os.OpenFile(ml.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("message log: open %s: %v", ml.path, err)
+	} else {
+		defer f.Close()
+	}
+
+	// Appends at or below skipThrough are covered by the last rewrite
+	var skipThrough int64
+	for {
+		select {
+		case op, ok := <-ml.ops:
+			// A rewrite requested before this message was queued must be applied first
+			skipThrough = ml.applyRewrite(f, skipThrough)
+			if !ok {
+				return
+			}
+			if f == nil || op.num <= skipThrough {
+				continue
+			}
+			ml.write(f, op.msg)
+		case <-ml.wake:
+			skipThrough = ml.applyRewrite(f, skipThrough)
+		}
+	}
+}
+
+// applyRewrite writes the pending snapshot, if any, returning the new skipThrough
+func (ml *messageLog) applyRewrite(f *os.File, skipThrough int64) int64 {
+	ml.mu.Lock()
+	if !ml.hasPending {
+		ml.mu.Unlock()
+		return skipThrough
+	}
+	snapshot, through := ml.pending, ml.pendingThrough
+	ml.pending, ml.hasPending = nil, false
+	ml.mu.Unlock()
+
+	if f == nil {
+		return through
+	}
+	if err := f.Truncate(0); err != nil {
+		log.Printf("message log: truncate %s: %v", ml.path, err)
+		return skipThrough
+	}
+	for _, msg := range snapshot {
+		ml.write(f, msg)
+	}
+	return through
+}
+
+func (ml *messageLog) write(f *os.File, msg ProbeMessage) {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("message log: encode message %s: %v", msg.ID, err)
+		return
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("message log: write %s: %v", ml.path, err)
+	}
+}
+
+// loadMessageLog reads back the last maxSize messages from the log at path
+// A missing file is not an error; malformed lines are skipped
+func loadMessageLog(path string, maxSize int) ([]ProbeMessage, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	messages := make([]ProbeMessage, 0, maxSize)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg ProbeMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("message log: skipping malformed line: %v", err)
+			continue
+		}
+		// A line for a seq already read is a later repeat count for that message
+		if n := len(messages); n > 0 && msg.Seq <= messages[n-1].Seq {
+			for i := n - 1; i >= 0; i-- {
+				if messages[i].Seq == msg.Seq {
+					messages[i] = msg
+					break
+				}
+			}
+			continue
+		}
+		messages = append(messages, msg)
+		if len(messages) > maxSize {
+			messages = messages[1:]
+		}
+	}
+	return messages, scanner.Err()
+}
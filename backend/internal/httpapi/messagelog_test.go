@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageLogReloadRestoresOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+
+	ms := NewMessageStore(100, path, 16)
+	var want []ProbeMessage
+	for i := range 5 {
+		want = append(want, ms.AddMessage(fmt.Sprintf("F16R co2=%d", 400+i)))
+	}
+	ms.Close()
+
+	// A smaller store keeps only the most recent messages
+	reloaded := NewMessageStore(3, path, 16)
+	defer reloaded.Close()
+	got := reloaded.GetMessages()
+	want = want[2:]
+	if len(got) != len(want) {
+		t.Fatalf("reloaded %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Seq != want[i].Seq || got[i].Data != want[i].Data {
+			t.Errorf("message %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// New messages continue the sequence
+	if next := reloaded.AddMessage("F16R co2=500"); next.Seq != want[len(want)-1].Seq+1 {
+		t.Errorf("next seq = %d, want %d", next.Seq, want[len(want)-1].Seq+1)
+	}
+}
+
+func TestMessageLogDeleteRewritesLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+
+	ms := NewMessageStore(100, path, 16)
+	first := ms.AddMessage("F16R co2=1")
+	ms.AddMessage("F16R co2=2")
+	if !ms.DeleteByID(first.ID) {
+		t.Fatalf("DeleteByID(%s) = false", first.ID)
+	}
+	// Appends after the rewrite must still reach the file
+	ms.AddMessage("F16R co2=3")
+	ms.Close()
+
+	reloaded := NewMessageStore(100, path, 16)
+	defer reloaded.Close()
+	got := reloaded.GetMessages()
+	want := []string{"F16R co2=2", "F16R co2=3"}
+	if len(got) != len(want) {
+		t.Fatalf("reloaded %d messages, want %d: %+v", len(got), len(want), got)
+	}
+	for i, msg := range got {
+		if msg.Data != want[i] {
+			t.Errorf("message %d = %q, want %q", i, msg.Data, want[i])
+		}
+	}
+}
+
+func TestMessageLogReloadKeepsRepeatCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+
+	ms := NewMessageStore(100, path, 16)
+	ms.compact = true
+	ms.AddMessage("F16R co2=454")
+	ms.AddMessage("F17R co2=500")
+	ms.AddMessage("F16R co2=454")
+	ms.AddMessage("F16R co2=454")
+	ms.Close()
+
+	reloaded := NewMessageStore(100, path, 16)
+	defer reloaded.Close()
+	got := reloaded.GetMessages()
+	if len(got) != 2 {
+		t.Fatalf("reloaded %d messages, want 2: %+v", len(got), got)
+	}
+	if got[0].Data != "F16R co2=454" || got[0].Repeats != 2 {
+		t.Errorf("message 0 = %+v, want F16R with 2 repeats", got[0])
+	}
+	if next := reloaded.AddMessage("F16R co2=1"); next.Seq != 3 {
+		t.Errorf("next seq = %d, want 3", next.Seq)
+	}
+}
+
+func TestMessageLogRewriteSkipsQueuedRepeats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+
+	ms := NewMessageStore(100, path, 16)
+	ms.compact = true
+	first := ms.AddMessage("F16R co2=454")
+	ms.AddMessage("F16R co2=454")
+	// The queued repeat must not bring the deleted message back
+	ms.DeleteByID(first.ID)
+	ms.Close()
+
+	reloaded := NewMessageStore(100, path, 16)
+	defer reloaded.Close()
+	if got := reloaded.GetMessages(); len(got) != 0 {
+		t.Errorf("reloaded %+v, want nothing", got)
+	}
+}
@@ -1,8 +1,16 @@
 package httpapi
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,69 +24,356 @@ type AreaLocation struct {
 
 // AreaStore stores areas and their locations
 type AreaStore struct {
-	areas map[string][]AreaLocation // area -> locations
+	mu         sync.RWMutex
+	areas      map[string][]AreaLocation // area -> locations
+	version    uint64                    // Bumped on every change
+	normalizer *nameNormalizer           // Canonicalizes area and location names on the way in
+
+	path        string     // Optional JSON file the areas are persisted to
+	writeMu     sync.Mutex // Serializes writes of the file
+	saveMu      sync.Mutex // Guards saveTimer and savePending
+	saveTimer   *time.Timer
+	savePending bool
 }
 
 type ProbeMessage struct {
 	ID        string    `json:"id"`
+	Seq       int64     `json:"seq"` // Monotonic insertion sequence used for pagination
 	Data      string    `json:"data"`
+	Raw       string    `json:"raw,omitempty"`       // Payload as received, when KEEP_RAW_PROBE_DATA is on and sanitizing changed it
+	Truncated bool      `json:"truncated,omitempty"` // Data (or raw) was cut to MESSAGE_MAX_LENGTH
 	Timestamp time.Time `json:"timestamp"`
+
+	// Identical messages from the same probe collapsed into this one, when COMPACT_DUPLICATE_MESSAGES is on
+	Repeats      int       `json:"repeats,omitempty"`
+	LastRepeatAt time.Time `json:"lastRepeatAt,omitzero"` // Timestamp of the latest repeat
+}
+
+// MessageRepeat is sent in repeat WebSocket frames when a message is counted as a repeat
+// It refers to a message the client already has by ID and seq, so no new seq is sent
+type MessageRepeat struct {
+	ID           string    `json:"id"`
+	Seq          int64     `json:"seq"`
+	ProbeID      string    `json:"probeId"`
+	Repeats      int       `json:"repeats"`
+	LastRepeatAt time.Time `json:"lastRepeatAt"`
 }
 
 type MessageStore struct {
-	messages  []ProbeMessage
-	maxSize   int
-	clients   map[*websocket.Conn]bool
-	broadcast chan ProbeMessage
-	counter   int64 // Counter for unique ID generation
+	mu            sync.RWMutex // Guards messages and counter
+	messages      []ProbeMessage
+	maxSize       int
+	clientsMu     sync.Mutex // Guards clients and streamClients
+	clients       map[*websocket.Conn]*wsClient
+	streamClients map[*sseClient]struct{} // Server-sent events clients, which only receive probe messages
+	broadcast     chan any                // ProbeMessage or alert frames for WebSocket and SSE clients
+	counter       int64                   // Counter for unique ID generation and message sequence numbers
+	evictions     int64                   // Messages dropped from the front of the buffer since startup
+	expired       int64                   // Messages removed by PruneOlderThan since startup
+	log           *messageLog             // Optional on-disk message log
+	arrived       chan struct{}           // Closed and replaced whenever a message is added, waking long polls
+	idScheme      string                  // messageIDCounter or messageIDUUIDv7
+	uuids         uuidV7Generator         // Used when idScheme is messageIDUUIDv7
+	compact       bool                    // Collapse a message identical to its probe's previous one into a repeat
+	lastByProbe   map[string]int64        // probeID -> seq of its latest stored message, for compaction
+	maxDataLength int                     // Longer data is truncated to this many bytes; 0 for no limit
+
+	broadcastDropped atomic.Int64 // Frames dropped because the broadcast channel was full
+	lastDropWarning  atomic.Int64 // Unix nanos of the last dropped-frame warning
+}
+
+// wsClient is a connected WebSocket client
+type wsClient struct {
+	conn        *websocket.Conn
+	remoteAddr  string     // Peer address the connection came from
+	connectedAt time.Time  // When the client registered
+	writeMu     sync.Mutex // gorilla/websocket allows only one concurrent writer
+	subMu       sync.RWMutex
+	areas       map[string]bool // Subscribed areas; nil receives every frame
+}
+
+// subscribe replaces the client's area subscription; an empty list restores the firehose
+func (c *wsClient) subscribe(areas []string, normalizer *nameNormalizer) []string {
+	subscribed := make(map[string]bool, len(areas))
+	for _, area := range areas {
+		area = normalizer.normalizeArea(area)
+		if area != "" {
+			subscribed[area] = true
+		}
+	}
+	if len(subscribed) == 0 {
+		subscribed = nil
+	}
+
+	c.subMu.Lock()
+	c.areas = subscribed
+	c.subMu.Unlock()
+
+	return c.subscribedAreas()
+}
+
+// subscribedAreas returns the client's subscribed areas, sorted; empty means every area
+func (c *wsClient) subscribedAreas() []string {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	result := make([]string, 0, len(c.areas))
+	for area := range c.areas {
+		result = append(result, area)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// wantsArea reports whether a frame for the given area should be sent to the client
+func (c *wsClient) wantsArea(area string) bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return c.areas == nil || c.areas[area]
+}
+
+// wsWriteWait bounds how long a write to a single client may block the broadcaster
+const wsWriteWait = 10 * time.Second
+
+// wsProtocolVersion is sent in every frame envelope; bump it on incompatible frame changes
+// Version 1 was the unwrapped frames sent before envelopes were introduced
+const wsProtocolVersion = 2
+
+// wsEnvelope wraps every WebSocket frame so clients can switch on Type instead of sniffing the shape
+// Payloads don't repeat the type
+type wsEnvelope struct {
+	Type    string `json:"type"` // "sync", "snapshot", "message", "alert", "probe_status", "low_battery", or "subscribed"
+	Version int    `json:"version"`
+	Payload any    `json:"payload"`
+}
+
+func newWSEnvelope(frameType string, payload any) wsEnvelope {
+	return wsEnvelope{Type: frameType, Version: wsProtocolVersion, Payload: payload}
+}
+
+// wsCloseWait bounds how long sending a close frame may take, so shutdown isn't held up by a dead client
+const wsCloseWait = time.Second
+
+// wsCloseReason is the JSON sent as a close frame's reason so clients can tell why they were
+// disconnected; RetryAfter is set for planned shutdowns
+type wsCloseReason struct {
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // Seconds to wait before reconnecting
 }
 
-func NewMessageStore(maxSize int) *MessageStore {
-	return &MessageStore{
-		messages:  make([]ProbeMessage, 0, maxSize),
-		maxSize:   maxSize,
-		clients:   make(map[*websocket.Conn]bool),
-		broadcast: make(chan ProbeMessage, 256),
-		counter:   0,
+// close sends a close frame with the given code and reason, then closes the connection
+// The frame is best-effort: a client that stopped reading may never get it
+func (c *wsClient) close(code int, reason wsCloseReason) {
+	payload, _ := json.Marshal(reason)
+	// WriteControl may be called concurrently with the other writers
+	if err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, string(payload)), time.Now().Add(wsCloseWait)); err != nil && !errors.Is(err, websocket.ErrCloseSent) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("websocket close frame error: %v", err)
 	}
+	c.conn.Close()
+}
+
+// writeJSON writes a frame to the client, serialized with other writers
+func (c *wsClient) writeJSON(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(v)
+}
+
+// NewMessageStore creates a message store holding up to maxSize messages
+// If logPath is set, messages are appended to that file and the last maxSize are reloaded from it
+// broadcastBuffer is how many frames may queue for WebSocket clients before new ones are dropped
+func NewMessageStore(maxSize int, logPath string, broadcastBuffer int) *MessageStore {
+	ms := &MessageStore{
+		messages:      make([]ProbeMessage, 0, maxSize),
+		maxSize:       maxSize,
+		clients:       make(map[*websocket.Conn]*wsClient),
+		streamClients: make(map[*sseClient]struct{}),
+		broadcast:     make(chan any, broadcastBuffer),
+		counter:       0,
+		arrived:       make(chan struct{}),
+		lastByProbe:   make(map[string]int64),
+	}
+
+	if logPath != "" {
+		messages, err := loadMessageLog(logPath, maxSize)
+		if err != nil {
+			log.Printf("message log: load %s: %v", logPath, err)
+		}
+		ms.messages = append(ms.messages, messages...)
+		for _, msg := range ms.messages {
+			if probeID := messageProbeID(msg.Data); probeID != "" {
+				ms.lastByProbe[probeID] = msg.Seq
+			}
+		}
+		// Continue the sequence from the last persisted message
+		if len(ms.messages) > 0 {
+			ms.counter = ms.messages[len(ms.messages)-1].Seq
+		}
+		ms.log = openMessageLog(logPath)
+	}
+
+	return ms
 }
 
 func (ms *MessageStore) AddMessage(data string) ProbeMessage {
+	return ms.AddMessageAt(data, time.Time{})
+}
+
+// AddMessageAt is AddMessage with a caller-supplied timestamp, e.g. one reported by the probe
+// A zero timestamp means now; ordering and pagination always follow the insertion sequence
+func (ms *MessageStore) AddMessageAt(data string, timestamp time.Time) ProbeMessage {
+	return ms.AddRawMessageAt(data, "", timestamp)
+}
+
+// AddRawMessageAt is AddMessageAt that also keeps the payload as it was received
+func (ms *MessageStore) AddRawMessageAt(data, raw string, timestamp time.Time) ProbeMessage {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	data, truncated := truncateUTF8(data, ms.maxDataLength)
+	raw, rawTruncated := truncateUTF8(raw, ms.maxDataLength)
+	ms.mu.Lock()
+	if msg, ok := ms.addRepeatLocked(data, raw, timestamp); ok {
+		ms.mu.Unlock()
+		// Sent as its own frame so the message's seq isn't delivered twice; long polls aren't woken,
+		// as nothing new was stored
+		ms.Broadcast(MessageRepeat{
+			ID:           msg.ID,
+			Seq:          msg.Seq,
+			ProbeID:      messageProbeID(msg.Data),
+			Repeats:      msg.Repeats,
+			LastRepeatAt: msg.LastRepeatAt,
+		})
+		return msg
+	}
+	id := ms.generateID()
 	msg := ProbeMessage{
-		ID:        ms.generateID(),
+		ID:        id,
+		Seq:       ms.counter,
 		Data:      data,
-		Timestamp: time.Now(),
+		Raw:       raw,
+		Truncated: truncated || rawTruncated,
+		Timestamp: timestamp,
 	}
 
 	ms.messages = append(ms.messages, msg)
+	if probeID := messageProbeID(data); probeID != "" {
+		ms.lastByProbe[probeID] = msg.Seq
+	}
 	if len(ms.messages) > ms.maxSize {
+		ms.forgetLocked(ms.messages[0])
 		ms.messages = ms.messages[1:]
+		ms.evictions++
+	}
+	// Queue under the lock so log order matches rewrite snapshots
+	if ms.log != nil {
+		ms.log.Append(msg)
 	}
+	close(ms.arrived)
+	ms.arrived = make(chan struct{})
+	ms.mu.Unlock()
 
 	// Broadcast to WebSocket clients
+	ms.Broadcast(msg)
+
+	return msg
+}
+
+// addRepeatLocked counts a message as a repeat of its probe's previous message when compaction
+// is on and the two are identical, returning the updated message
+// Must be called with ms.mu held for writing
+func (ms *MessageStore) addRepeatLocked(data, raw string, timestamp time.Time) (ProbeMessage, bool) {
+	if !ms.compact {
+		return ProbeMessage{}, false
+	}
+	seq, ok := ms.lastByProbe[messageProbeID(data)]
+	if !ok {
+		return ProbeMessage{}, false
+	}
+	i := ms.indexAfterSeq(seq - 1)
+	if i >= len(ms.messages) || ms.messages[i].Seq != seq {
+		return ProbeMessage{}, false
+	}
+	prev := &ms.messages[i]
+	if prev.Data != data || prev.Raw != raw {
+		return ProbeMessage{}, false
+	}
+	prev.Repeats++
+	prev.LastRepeatAt = timestamp
+	// Logged again under the same seq; the later line wins on reload
+	if ms.log != nil {
+		ms.log.Append(*prev)
+	}
+	return *prev, true
+}
+
+// forgetLocked drops a removed message from the per-probe index if it was its probe's latest,
+// so a probe whose latest message is gone starts a new run
+// Must be called with ms.mu held for writing
+func (ms *MessageStore) forgetLocked(msg ProbeMessage) {
+	probeID := messageProbeID(msg.Data)
+	if seq, ok := ms.lastByProbe[probeID]; ok && seq == msg.Seq {
+		delete(ms.lastByProbe, probeID)
+	}
+}
+
+// messageProbeID returns the probe ID a message's data starts with, or "" if it has none
+func messageProbeID(data string) string {
+	probeID, _, _ := strings.Cut(data, " ")
+	return probeID
+}
+
+// messageArrived returns a channel that is closed when the next message is added
+// Take it before querying so a message added in between isn't missed
+func (ms *MessageStore) messageArrived() <-chan struct{} {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.arrived
+}
+
+// BroadcastDropped returns how many frames were dropped because the broadcast channel was full
+func (ms *MessageStore) BroadcastDropped() int64 {
+	return ms.broadcastDropped.Load()
+}
+
+// dropWarningInterval throttles the dropped-frame warning
+const dropWarningInterval = 10 * time.Second
+
+// Broadcast queues a frame for all WebSocket clients without blocking
+func (ms *MessageStore) Broadcast(frame any) {
 	select {
-	case ms.broadcast <- msg:
+	case ms.broadcast <- frame:
 	default:
-		// Channel full, skip broadcast
+		// Channel full, skip broadcast and warn at most every dropWarningInterval
+		dropped := ms.broadcastDropped.Add(1)
+		now := time.Now().UnixNano()
+		last := ms.lastDropWarning.Load()
+		if now-last >= int64(dropWarningInterval) && ms.lastDropWarning.CompareAndSwap(last, now) {
+			log.Printf("broadcast channel full, WebSocket clients are falling behind (%d frames dropped so far)", dropped)
+		}
 	}
-
-	return msg
 }
 
 func (ms *MessageStore) GetMessages() []ProbeMessage {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	// Return a copy
 	result := make([]ProbeMessage, len(ms.messages))
 	copy(result, ms.messages)
 	return result
 }
 
-// GetMessagesAfter returns messages with IDs greater than the given lastID
+// GetMessagesAfter returns messages stored after the given lastID (by sequence number)
 // If maxLength is > 0, limits results to that many messages (defaults to 10 if 0)
 func (ms *MessageStore) GetMessagesAfter(lastID string, maxLength int) []ProbeMessage {
 	if maxLength <= 0 {
 		maxLength = 10 // Default to 10 if not specified
 	}
 
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	if lastID == "" {
 		// Return last maxLength messages if no lastID provided
 		startIdx := len(ms.messages) - maxLength
@@ -90,17 +385,10 @@ func (ms *MessageStore) GetMessagesAfter(lastID string, maxLength int) []ProbeMe
 		return result
 	}
 
-	// Find the index of the lastID, or start from the beginning if not found
+	// Find the first message after lastID, or start from the beginning if it can't be resolved
 	startIdx := 0
-	for i, msg := range ms.messages {
-		if msg.ID == lastID {
-			startIdx = i + 1
-			break
-		}
-		// If we've passed where it should be (messages are in order), break
-		if msg.ID > lastID {
-			break
-		}
+	if lastSeq, ok := ms.resolveSeq(lastID); ok {
+		startIdx = ms.indexAfterSeq(lastSeq)
 	}
 
 	// Return messages after the lastID
@@ -119,7 +407,57 @@ func (ms *MessageStore) GetMessagesAfter(lastID string, maxLength int) []ProbeMe
 	return result
 }
 
-// GetMessagesBefore returns messages with IDs less than the given beforeID
+// GetMessagesAfterFiltered is GetMessagesAfter restricted to messages from a single probe
+// An empty probeID returns the unfiltered results
+func (ms *MessageStore) GetMessagesAfterFiltered(lastID, probeID string, maxLength int) []ProbeMessage {
+	probeID = strings.TrimSpace(probeID)
+	if probeID == "" {
+		return ms.GetMessagesAfter(lastID, maxLength)
+	}
+	if maxLength <= 0 {
+		maxLength = 10 // Default to 10 if not specified
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	startIdx := 0
+	if lastID != "" {
+		if lastSeq, ok := ms.resolveSeq(lastID); ok {
+			startIdx = ms.indexAfterSeq(lastSeq)
+		}
+	}
+
+	var matches []ProbeMessage
+	for _, msg := range ms.messages[startIdx:] {
+		if messageFromProbe(msg.Data, probeID) {
+			matches = append(matches, msg)
+		}
+	}
+
+	if len(matches) > maxLength {
+		if lastID == "" {
+			// Without a lastID, return the most recent maxLength matches
+			matches = matches[len(matches)-maxLength:]
+		} else {
+			matches = matches[:maxLength]
+		}
+	}
+	if matches == nil {
+		return []ProbeMessage{}
+	}
+	return matches
+}
+
+// messageFromProbe reports whether message data starts with the given probe ID token
+func messageFromProbe(data, probeID string) bool {
+	if !strings.HasPrefix(data, probeID) {
+		return false
+	}
+	return len(data) == len(probeID) || data[len(probeID)] == ' '
+}
+
+// GetMessagesBefore returns messages stored before the given beforeID (by sequence number)
 // Returns up to maxLength messages (defaults to 100 if 0)
 // Messages are returned in reverse chronological order (newest first)
 func (ms *MessageStore) GetMessagesBefore(beforeID string, maxLength int) []ProbeMessage {
@@ -127,6 +465,9 @@ func (ms *MessageStore) GetMessagesBefore(beforeID string, maxLength int) []Prob
 		maxLength = 100 // Default to 100 if not specified
 	}
 
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	if beforeID == "" {
 		// Return last maxLength messages if no beforeID provided
 		startIdx := len(ms.messages) - maxLength
@@ -138,18 +479,10 @@ func (ms *MessageStore) GetMessagesBefore(beforeID string, maxLength int) []Prob
 		return result
 	}
 
-	// Find the index of the beforeID
+	// Find the index of the beforeID, or use the end if it can't be resolved
 	endIdx := len(ms.messages)
-	for i, msg := range ms.messages {
-		if msg.ID == beforeID {
-			endIdx = i
-			break
-		}
-		// If we've passed where it should be (messages are in order), break
-		if msg.ID > beforeID {
-			endIdx = i
-			break
-		}
+	if beforeSeq, ok := ms.resolveSeq(beforeID); ok {
+		endIdx = ms.indexAfterSeq(beforeSeq - 1)
 	}
 
 	// Return messages before the beforeID
@@ -168,62 +501,313 @@ func (ms *MessageStore) GetMessagesBefore(beforeID string, maxLength int) []Prob
 	return result
 }
 
+// ReplaySince returns messages with a sequence greater than since, along with the
+// oldest retained and latest assigned sequence numbers
+// Replay is bounded by the store size: messages already evicted can't be returned
+func (ms *MessageStore) ReplaySince(since int64) (messages []ProbeMessage, oldestSeq, latestSeq int64) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	startIdx := ms.indexAfterSeq(since)
+	messages = make([]ProbeMessage, len(ms.messages)-startIdx)
+	copy(messages, ms.messages[startIdx:])
+	if len(ms.messages) > 0 {
+		oldestSeq = ms.messages[0].Seq
+	}
+	return messages, oldestSeq, ms.counter
+}
+
+// GetMessagesByTimeRange returns messages whose timestamp falls within [from, to], in chronological order
+// A zero from or to leaves that end of the range open
+func (ms *MessageStore) GetMessagesByTimeRange(from, to time.Time) []ProbeMessage {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	result := []ProbeMessage{}
+	for _, msg := range ms.messages {
+		if !from.IsZero() && msg.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && msg.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// resolveSeq returns the sequence number for a message ID
+// IDs no longer in the store (e.g. evicted) are resolved from their counter suffix, or for
+// UUIDv7 IDs, which carry no seq, from where they sort among the stored UUIDs
+// Must be called with ms.mu held
+func (ms *MessageStore) resolveSeq(id string) (int64, bool) {
+	for _, msg := range ms.messages {
+		if msg.ID == id {
+			return msg.Seq, true
+		}
+	}
+	if isUUID(id) {
+		// UUIDv7s sort in generation order, so the first later one follows the missing ID
+		for _, msg := range ms.messages {
+			if isUUID(msg.ID) && msg.ID > id {
+				return msg.Seq - 1, true
+			}
+		}
+		return ms.counter, true
+	}
+	idx := strings.LastIndex(id, "-")
+	if idx == -1 {
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(id[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+// indexAfterSeq returns the index of the first message with a sequence greater than seq
+// Must be called with ms.mu held
+func (ms *MessageStore) indexAfterSeq(seq int64) int {
+	return sort.Search(len(ms.messages), func(i int) bool {
+		return ms.messages[i].Seq > seq
+	})
+}
+
+// addClient registers a WebSocket connection for broadcasts
+func (ms *MessageStore) addClient(conn *websocket.Conn) *wsClient {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	client := &wsClient{conn: conn, remoteAddr: conn.RemoteAddr().String(), connectedAt: time.Now()}
+	ms.clients[conn] = client
+	return client
+}
+
+// removeClient unregisters a WebSocket connection
+func (ms *MessageStore) removeClient(conn *websocket.Conn) {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	delete(ms.clients, conn)
+}
+
+// ClientCount returns the number of connected WebSocket clients
+func (ms *MessageStore) ClientCount() int {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	return len(ms.clients)
+}
+
+// snapshotClients returns the currently registered connections
+func (ms *MessageStore) snapshotClients() []*wsClient {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	clients := make([]*wsClient, 0, len(ms.clients))
+	for _, client := range ms.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Search returns up to limit messages whose data contains q, newest first
+func (ms *MessageStore) Search(q string, ignoreCase bool, limit int) []ProbeMessage {
+	if ignoreCase {
+		q = strings.ToLower(q)
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	result := []ProbeMessage{}
+	for i := len(ms.messages) - 1; i >= 0 && len(result) < limit; i-- {
+		data := ms.messages[i].Data
+		if ignoreCase {
+			data = strings.ToLower(data)
+		}
+		if strings.Contains(data, q) {
+			result = append(result, ms.messages[i])
+		}
+	}
+	return result
+}
+
+// StoreStats describes the message buffer's occupancy
+type StoreStats struct {
+	Count     int        `json:"count"`
+	Capacity  int        `json:"capacity"`
+	Oldest    *time.Time `json:"oldest,omitempty"` // Timestamp of the oldest stored message, if any
+	Newest    *time.Time `json:"newest,omitempty"` // Timestamp of the newest stored message, if any
+	Evictions int64      `json:"evictions"`        // Messages dropped because the buffer was full; /api/clear doesn't count
+	Expired   int64      `json:"expired"`          // Messages removed by the age retention sweep
+
+	OldestAgeSeconds int64 `json:"oldestAgeSeconds"` // Age of the oldest stored message; 0 if empty
+}
+
+// Stats returns the buffer's current occupancy and eviction counts
+func (ms *MessageStore) Stats() StoreStats {
+	now := time.Now()
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	stats := StoreStats{
+		Count:     len(ms.messages),
+		Capacity:  ms.maxSize,
+		Evictions: ms.evictions,
+		Expired:   ms.expired,
+	}
+	if len(ms.messages) > 0 {
+		// Probe-supplied timestamps can be out of order, so scan rather than take the ends
+		oldest, newest := ms.messages[0].Timestamp, ms.messages[0].Timestamp
+		for _, msg := range ms.messages[1:] {
+			if msg.Timestamp.Before(oldest) {
+				oldest = msg.Timestamp
+			}
+			if msg.Timestamp.After(newest) {
+				newest = msg.Timestamp
+			}
+		}
+		stats.Oldest, stats.Newest = &oldest, &newest
+		stats.OldestAgeSeconds = int64(now.Sub(oldest).Seconds())
+	}
+	return stats
+}
+
+// PruneOlderThan removes messages timestamped before cutoff, returning how many were removed
+// The message log is rewritten when anything is removed so expired messages aren't reloaded
+func (ms *MessageStore) PruneOlderThan(cutoff time.Time) int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	kept := ms.messages[:0]
+	for _, msg := range ms.messages {
+		if !msg.Timestamp.Before(cutoff) {
+			kept = append(kept, msg)
+		} else {
+			ms.forgetLocked(msg)
+		}
+	}
+	removed := len(ms.messages) - len(kept)
+	if removed == 0 {
+		return 0
+	}
+	// Clear the tail so dropped messages can be collected
+	clear(ms.messages[len(kept):])
+	ms.messages = kept
+	ms.expired += int64(removed)
+
+	if ms.log != nil {
+		snapshot := make([]ProbeMessage, len(ms.messages))
+		copy(snapshot, ms.messages)
+		ms.log.Rewrite(snapshot)
+	}
+	return removed
+}
+
 func (ms *MessageStore) Clear() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	ms.messages = make([]ProbeMessage, 0, ms.maxSize)
+	clear(ms.lastByProbe)
+	if ms.log != nil {
+		ms.log.Rewrite(nil)
+	}
 }
 
+// Close flushes and closes the message log; messages added afterwards are kept in memory only
+func (ms *MessageStore) Close() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.log != nil {
+		ms.log.Close()
+		ms.log = nil
+	}
+}
+
+// DeleteByID removes the message with the given ID, reporting whether it was found
+// Remaining messages keep their sequence numbers so pagination is unaffected
+func (ms *MessageStore) DeleteByID(id string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i, msg := range ms.messages {
+		if msg.ID == id {
+			ms.forgetLocked(msg)
+			ms.messages = append(ms.messages[:i], ms.messages[i+1:]...)
+			if ms.log != nil {
+				snapshot := make([]ProbeMessage, len(ms.messages))
+				copy(snapshot, ms.messages)
+				ms.log.Rewrite(snapshot)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// generateID must be called with ms.mu held for writing
+// The counter advances under either scheme, since it is also the message's seq
 func (ms *MessageStore) generateID() string {
 	ms.counter++
+	if ms.idScheme == messageIDUUIDv7 {
+		return ms.uuids.next(time.Now())
+	}
 	// Use timestamp + counter for unique ID
 	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), ms.counter)
 }
 
-// NewAreaStore creates a new area store with predefined areas
-func NewAreaStore() *AreaStore {
+// NewAreaStore creates a new area store seeded with the predefined areas
+// If path is set, assignments saved there are loaded over the predefined areas
+// and every change is written back to it
+func NewAreaStore(path string, predefinedAreas []string, normalizer *nameNormalizer) *AreaStore {
 	as := &AreaStore{
-		areas: make(map[string][]AreaLocation),
+		areas:      make(map[string][]AreaLocation),
+		path:       path,
+		normalizer: normalizer,
 	}
-	// Initialize with predefined areas (empty locations initially)
-	predefinedAreas := []string{"FLOOR17", "FLOOR16", "FLOOR15", "FLOOR12", "FLOOR11", "TEAROOM", "POOL"}
+	// Initialize with predefined areas (empty locations initially), normalized the same
+	// way as an area assigned through POST /api/probes/{id}
 	for _, area := range predefinedAreas {
-		as.areas[area] = []AreaLocation{}
+		if area = normalizer.normalizeArea(area); area != "" {
+			as.areas[area] = []AreaLocation{}
+		}
+	}
+	if path != "" {
+		// Persisted areas that are no longer predefined are kept
+		persisted, err := loadAreaFile(path)
+		if err != nil {
+			log.Printf("area store: load %s: %v", path, err)
+		}
+		for area, locations := range persisted {
+			as.areas[area] = locations
+		}
 	}
 	return as
 }
 
 // AddLocation adds or updates a location for an area
 func (as *AreaStore) AddLocation(area, location, probeID string) {
-	// Normalize area name to uppercase
-	areaUpper := ""
-	if len(area) > 0 {
-		// Handle Floor17 -> FLOOR17, Tea_room -> TEAROOM, pool -> POOL
-		if len(area) > 5 && (area[:5] == "Floor" || area[:5] == "floor") {
-			areaUpper = "FLOOR" + area[5:]
-		} else if area == "Tea_room" || area == "tea_room" || area == "TEAROOM" {
-			areaUpper = "TEAROOM"
-		} else if area == "pool" || area == "Pool" || area == "POOL" {
-			areaUpper = "POOL"
-		} else {
-			// Already uppercase or other format
-			areaUpper = area
-		}
-	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.addLocationLocked(area, location, probeID)
+}
 
-	// Normalize location name
-	locationUpper := ""
-	if location == "Rotunda" || location == "rotunda" || location == "ROTUNDA" {
-		locationUpper = "ROTUNDA"
-	} else if location == "Hallway" || location == "hallway" || location == "HALLWAY" {
-		locationUpper = "HALLWAY"
-	} else if location == "Line" || location == "line" || location == "LINE" {
-		locationUpper = "LINE"
-	} else if location == "Location1" || location == "location1" || location == "LOCATION1" {
-		locationUpper = "LOCATION1"
-	} else if location == "Location2" || location == "location2" || location == "LOCATION2" {
-		locationUpper = "LOCATION2"
-	} else {
-		locationUpper = location
+// AssignIfUnassigned adds a location for a probe only if the probe isn't
+// assigned anywhere yet, checking and assigning under a single lock so
+// concurrent auto-assignment can't assign the same probe twice
+func (as *AreaStore) AssignIfUnassigned(area, location, probeID string) bool {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.probeAssignedLocked(probeID) {
+		return false
 	}
+	as.addLocationLocked(area, location, probeID)
+	return true
+}
+
+// addLocationLocked must be called with as.mu held for writing
+func (as *AreaStore) addLocationLocked(area, location, probeID string) {
+	areaUpper := as.normalizer.normalizeArea(area)
+	locationUpper := as.normalizer.normalizeLocation(location)
 
 	if areaUpper == "" || locationUpper == "" {
 		return // Invalid area or location
@@ -236,6 +820,7 @@ func (as *AreaStore) AddLocation(area, location, probeID string) {
 			// Update existing location with new probe ID
 			locations[i].ProbeID = probeID
 			as.areas[areaUpper] = locations
+			as.scheduleSave()
 			return
 		}
 	}
@@ -245,6 +830,7 @@ func (as *AreaStore) AddLocation(area, location, probeID string) {
 		Location: locationUpper,
 		ProbeID:  probeID,
 	})
+	as.scheduleSave()
 }
 
 // RemoveProbe removes a probe assignment from whichever area/location currently holds it
@@ -254,19 +840,62 @@ func (as *AreaStore) RemoveProbe(probeID string) {
 	}
 
 	trimmedID := strings.TrimSpace(probeID)
+	as.mu.Lock()
+	defer as.mu.Unlock()
 	for area, locations := range as.areas {
 		for i, loc := range locations {
 			if loc.ProbeID == trimmedID {
 				// Remove this location entry
 				as.areas[area] = append(locations[:i], locations[i+1:]...)
+				as.scheduleSave()
 				break
 			}
 		}
 	}
 }
 
+// RenameProbe changes the probe ID of an existing assignment, keeping its area and location
+// Returns false if the probe isn't assigned
+func (as *AreaStore) RenameProbe(oldID, newID string) bool {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	for _, locations := range as.areas {
+		for i, loc := range locations {
+			if strings.EqualFold(loc.ProbeID, oldID) {
+				locations[i].ProbeID = newID
+				as.scheduleSave()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ClearArea removes every location assigned to an area, keeping the area itself
+// Returns the locations removed and whether the area exists
+func (as *AreaStore) ClearArea(area string) ([]AreaLocation, bool) {
+	areaUpper := as.normalizer.normalizeArea(area)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	locations, exists := as.areas[areaUpper]
+	if !exists {
+		return nil, false
+	}
+	as.areas[areaUpper] = []AreaLocation{}
+	as.scheduleSave()
+	return locations, true
+}
+
 // ProbeAssigned checks if a probe ID is already assigned to any area/location
 func (as *AreaStore) ProbeAssigned(probeID string) bool {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.probeAssignedLocked(probeID)
+}
+
+// probeAssignedLocked must be called with as.mu held
+func (as *AreaStore) probeAssignedLocked(probeID string) bool {
 	if probeID == "" {
 		return false
 	}
@@ -281,8 +910,61 @@ func (as *AreaStore) ProbeAssigned(probeID string) bool {
 	return false
 }
 
+// FindProbe returns the area and location a probe is assigned to
+func (as *AreaStore) FindProbe(probeID string) (area, location string, ok bool) {
+	trimmedID := strings.TrimSpace(probeID)
+	if trimmedID == "" {
+		return "", "", false
+	}
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	for area, locations := range as.areas {
+		for _, loc := range locations {
+			if strings.EqualFold(loc.ProbeID, trimmedID) {
+				return area, loc.Location, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// GetLocations returns the locations assigned to a single area
+func (as *AreaStore) GetLocations(area string) ([]AreaLocation, bool) {
+	areaUpper := as.normalizer.normalizeArea(area)
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	locations, exists := as.areas[areaUpper]
+	if !exists {
+		return nil, false
+	}
+	// Return a copy
+	result := make([]AreaLocation, len(locations))
+	copy(result, locations)
+	return result, true
+}
+
+// ProbeCount returns the number of probes assigned across all areas
+func (as *AreaStore) ProbeCount() int {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	count := 0
+	for _, locations := range as.areas {
+		count += len(locations)
+	}
+	return count
+}
+
+// Version returns a counter that changes whenever the areas do
+func (as *AreaStore) Version() uint64 {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.version
+}
+
 // GetAreas returns all areas with their locations
 func (as *AreaStore) GetAreas() map[string][]AreaLocation {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
 	// Return a copy
 	result := make(map[string][]AreaLocation)
 	for area, locations := range as.areas {
@@ -310,7 +992,9 @@ type AreaStat struct {
 
 // StatsStore stores statistics for areas
 type StatsStore struct {
-	stats map[string]map[string]MetricStat // area -> metric -> stat
+	mu      sync.RWMutex
+	stats   map[string]map[string]MetricStat // area -> metric -> stat
+	version uint64                           // Bumped on every change
 }
 
 // NewStatsStore creates a new stats store
@@ -320,6 +1004,30 @@ func NewStatsStore() *StatsStore {
 	}
 }
 
+// GetStatsByMetric returns each area's stat for one metric, optionally limited to one area
+// Areas that don't report the metric are left out, so the result may be empty
+func (ss *StatsStore) GetStatsByMetric(areaFilter, metric string) []AreaStat {
+	areaFilterUpper := strings.ToUpper(strings.TrimSpace(areaFilter))
+	metricLower := strings.ToLower(strings.TrimSpace(metric))
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	result := []AreaStat{}
+	for area, metrics := range ss.stats {
+		if areaFilterUpper != "" && area != areaFilterUpper {
+			continue
+		}
+		if stat, ok := metrics[metricLower]; ok {
+			result = append(result, AreaStat{
+				Name:    area,
+				Metrics: []MetricStat{stat},
+			})
+		}
+	}
+	return result
+}
+
 // UpdateStat updates or creates a stat for an area and metric
 func (ss *StatsStore) UpdateStat(area, metric string, min, max, minO, maxO float64) {
 	// Normalize area name to uppercase
@@ -331,12 +1039,16 @@ func (ss *StatsStore) UpdateStat(area, metric string, min, max, minO, maxO float
 		return
 	}
 
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
 	// Get or create area map
 	if ss.stats[areaUpper] == nil {
 		ss.stats[areaUpper] = make(map[string]MetricStat)
 	}
 
 	// Update the metric stat
+	ss.version++
 	ss.stats[areaUpper][metricLower] = MetricStat{
 		Name: metricLower,
 		Min:  min,
@@ -346,6 +1058,35 @@ func (ss *StatsStore) UpdateStat(area, metric string, min, max, minO, maxO float
 	}
 }
 
+// Clear removes the stats for one area, or for every area if area is empty,
+// returning the areas that were cleared, sorted
+func (ss *StatsStore) Clear(area string) []string {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	cleared := []string{}
+	for name := range ss.stats {
+		if areaUpper == "" || name == areaUpper {
+			cleared = append(cleared, name)
+			delete(ss.stats, name)
+		}
+	}
+	if len(cleared) > 0 {
+		ss.version++
+	}
+	sort.Strings(cleared)
+	return cleared
+}
+
+// Version returns a counter that changes whenever the stats do
+func (ss *StatsStore) Version() uint64 {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.version
+}
+
 // GetStats returns all stats, optionally filtered by area
 func (ss *StatsStore) GetStats(areaFilter string) []AreaStat {
 	var result []AreaStat
@@ -356,6 +1097,9 @@ func (ss *StatsStore) GetStats(areaFilter string) []AreaStat {
 		areaFilterUpper = strings.ToUpper(strings.TrimSpace(areaFilter))
 	}
 
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
 	// Iterate through all areas
 	for area, metrics := range ss.stats {
 		// Skip if filter doesn't match
@@ -386,6 +1130,7 @@ type MetricThreshold struct {
 
 // ThresholdStore stores thresholds for areas
 type ThresholdStore struct {
+	mu         sync.RWMutex
 	thresholds map[string]map[string][]float64 // area -> metric -> values
 }
 
@@ -405,6 +1150,9 @@ func (ts *ThresholdStore) UpdateThresholds(area string, thresholds []MetricThres
 		return
 	}
 
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
 	// Get or create area map
 	if ts.thresholds[areaUpper] == nil {
 		ts.thresholds[areaUpper] = make(map[string][]float64)
@@ -430,6 +1178,50 @@ func (ts *ThresholdStore) UpdateThresholds(area string, thresholds []MetricThres
 	}
 }
 
+var (
+	errThresholdTarget     = errors.New("area and metric required")
+	errThresholdIncomplete = errors.New("metric has no thresholds yet; all 6 values are required")
+)
+
+// PatchThreshold sets only the non-nil positions of a metric's six threshold values
+// Positions left nil keep their current value; a metric with no thresholds yet
+// has nothing to keep, so its patch must set all six
+// Returns the merged values
+func (ts *ThresholdStore) PatchThreshold(area, metric string, patch [6]*float64) ([]float64, error) {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	metricLower := strings.ToLower(strings.TrimSpace(metric))
+	if areaUpper == "" || metricLower == "" {
+		return nil, errThresholdTarget
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	current, exists := ts.thresholds[areaUpper][metricLower]
+	if !exists {
+		for _, v := range patch {
+			if v == nil {
+				return nil, errThresholdIncomplete
+			}
+		}
+	}
+	if ts.thresholds[areaUpper] == nil {
+		ts.thresholds[areaUpper] = make(map[string][]float64)
+	}
+	values := make([]float64, 6)
+	copy(values, current)
+	for i, v := range patch {
+		if v != nil {
+			values[i] = *v
+		}
+	}
+	ts.thresholds[areaUpper][metricLower] = values
+
+	merged := make([]float64, 6)
+	copy(merged, values)
+	return merged, nil
+}
+
 // GetThresholds returns thresholds for an area
 func (ts *ThresholdStore) GetThresholds(area string) []MetricThreshold {
 	// Normalize area name to uppercase
@@ -439,6 +1231,9 @@ func (ts *ThresholdStore) GetThresholds(area string) []MetricThreshold {
 		return []MetricThreshold{}
 	}
 
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
 	metrics, exists := ts.thresholds[areaUpper]
 	if !exists {
 		return []MetricThreshold{}
@@ -458,45 +1253,220 @@ func (ts *ThresholdStore) GetThresholds(area string) []MetricThreshold {
 	return result
 }
 
+// AllThresholds returns every area's thresholds, with metrics sorted by name
+func (ts *ThresholdStore) AllThresholds() map[string][]MetricThreshold {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	result := make(map[string][]MetricThreshold, len(ts.thresholds))
+	for area, metrics := range ts.thresholds {
+		thresholds := make([]MetricThreshold, 0, len(metrics))
+		for metric, values := range metrics {
+			valuesCopy := make([]float64, len(values))
+			copy(valuesCopy, values)
+			thresholds = append(thresholds, MetricThreshold{Metric: metric, Values: valuesCopy})
+		}
+		sort.Slice(thresholds, func(i, j int) bool {
+			return thresholds[i].Metric < thresholds[j].Metric
+		})
+		result[area] = thresholds
+	}
+	return result
+}
+
+// ReplaceThresholds sets an area's thresholds to exactly the given metrics, dropping any others
+// Each threshold must already have six values
+func (ts *ThresholdStore) ReplaceThresholds(area string, thresholds []MetricThreshold) {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	if areaUpper == "" {
+		return
+	}
+
+	metrics := make(map[string][]float64, len(thresholds))
+	for _, threshold := range thresholds {
+		values := make([]float64, 6)
+		copy(values, threshold.Values)
+		metrics[strings.ToLower(strings.TrimSpace(threshold.Metric))] = values
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.thresholds[areaUpper] = metrics
+}
+
+// GetMetricThreshold returns the threshold values for a single area and metric
+func (ts *ThresholdStore) GetMetricThreshold(area, metric string) ([]float64, bool) {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	metricLower := strings.ToLower(strings.TrimSpace(metric))
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	values, exists := ts.thresholds[areaUpper][metricLower]
+	if !exists {
+		return nil, false
+	}
+	// Return a copy
+	valuesCopy := make([]float64, len(values))
+	copy(valuesCopy, values)
+	return valuesCopy, true
+}
+
 // PixelCount represents pixel count for an area
 type PixelCount struct {
 	Area   string `json:"area"`
-	Pixels string `json:"pixels"` // String format: "0" to "6" or "0*" to "6*"
+	Pixels string `json:"pixels"` // String format: "0" to PIXEL_MAX (default 6), optionally followed by "*"
 }
 
+// PixelSample is a pixel count recorded at a point in time
+type PixelSample struct {
+	Pixels    string    `json:"pixels"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Pixel history is kept for pixelHistoryWindow, capped at maxPixelHistory samples per area
+const (
+	pixelHistoryWindow = time.Hour
+	maxPixelHistory    = 1000
+)
+
 // PixelStore stores pixel counts for areas
 type PixelStore struct {
-	pixels map[string]string // area -> pixels (as string to preserve *)
+	mu      sync.RWMutex
+	pixels  map[string]string        // area -> pixels (as string to preserve *)
+	updated map[string]time.Time     // area -> last update time
+	changed map[string]time.Time     // area -> when its value last changed
+	history map[string][]PixelSample // area -> recent samples, oldest first
+	version uint64                   // Bumped on every change
+	max     int                      // Largest pixel value accepted
 }
 
-// NewPixelStore creates a new pixel store
-func NewPixelStore() *PixelStore {
+// NewPixelStore creates a new pixel store accepting values from 0 to max
+func NewPixelStore(max int) *PixelStore {
 	return &PixelStore{
-		pixels: make(map[string]string),
+		max:     max,
+		pixels:  make(map[string]string),
+		updated: make(map[string]time.Time),
+		changed: make(map[string]time.Time),
+		history: make(map[string][]PixelSample),
 	}
 }
 
-// UpdatePixels updates pixel counts for areas
-func (ps *PixelStore) UpdatePixels(pixelCounts []PixelCount) {
+// UpdatePixels updates pixel counts for areas, returning the entries whose value was invalid
+// Entries without an area are skipped
+func (ps *PixelStore) UpdatePixels(pixelCounts []PixelCount) []PixelCount {
+	now := time.Now()
+	invalid := []PixelCount{}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
 	for _, pc := range pixelCounts {
 		// Normalize area name to uppercase
 		areaUpper := strings.ToUpper(strings.TrimSpace(pc.Area))
-		if areaUpper != "" {
-			// Validate pixels format: should be "0" to "6" or "0*" to "6*"
-			pixelsStr := strings.TrimSpace(pc.Pixels)
-			if pixelsStr != "" {
-				// Remove * for validation, check if it's 0-6
-				pixelsClean := strings.TrimSuffix(pixelsStr, "*")
-				if len(pixelsClean) == 1 && pixelsClean[0] >= '0' && pixelsClean[0] <= '6' {
-					ps.pixels[areaUpper] = pixelsStr
-				}
-			}
+		if areaUpper == "" {
+			continue
+		}
+		pixelsStr := strings.TrimSpace(pc.Pixels)
+		if !validPixels(pixelsStr, ps.max) {
+			invalid = append(invalid, pc)
+			continue
+		}
+		if current, exists := ps.pixels[areaUpper]; !exists || current != pixelsStr {
+			ps.changed[areaUpper] = now
+		}
+		ps.pixels[areaUpper] = pixelsStr
+		ps.updated[areaUpper] = now
+		ps.version++
+		ps.appendHistory(areaUpper, PixelSample{Pixels: pixelsStr, Timestamp: now})
+	}
+	return invalid
+}
+
+// validPixels reports whether a pixel value is a number from 0 to max, optionally followed by "*"
+// Leading zeros are refused so each value has one spelling ("7", not "07")
+func validPixels(pixels string, max int) bool {
+	digits := strings.TrimSuffix(pixels, "*")
+	if digits == "" || (len(digits) > 1 && digits[0] == '0') {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
 		}
 	}
+	value, err := strconv.Atoi(digits)
+	return err == nil && value <= max
+}
+
+// appendHistory records a sample, dropping samples older than the window or over the cap
+// Must be called with ps.mu held for writing
+func (ps *PixelStore) appendHistory(area string, sample PixelSample) {
+	samples := append(ps.history[area], sample)
+	cutoff := sample.Timestamp.Add(-pixelHistoryWindow)
+	start := 0
+	for start < len(samples) && samples[start].Timestamp.Before(cutoff) {
+		start++
+	}
+	if len(samples)-start > maxPixelHistory {
+		start = len(samples) - maxPixelHistory
+	}
+	ps.history[area] = samples[start:]
+}
+
+// GetHistory returns the recent pixel samples for an area, oldest first
+func (ps *PixelStore) GetHistory(area string) []PixelSample {
+	areaUpper := strings.ToUpper(strings.TrimSpace(area))
+	cutoff := time.Now().Add(-pixelHistoryWindow)
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	result := []PixelSample{}
+	for _, sample := range ps.history[areaUpper] {
+		if !sample.Timestamp.Before(cutoff) {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// LastUpdated returns when each area's pixel count was last set
+func (ps *PixelStore) LastUpdated() map[string]time.Time {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	result := make(map[string]time.Time, len(ps.updated))
+	for area, t := range ps.updated {
+		result[area] = t
+	}
+	return result
+}
+
+// Version returns a counter that changes whenever the pixel counts do
+func (ps *PixelStore) Version() uint64 {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.version
+}
+
+// ChangedSince returns the pixel counts of areas whose value changed after since
+// Re-sending an unchanged value doesn't count as a change
+func (ps *PixelStore) ChangedSince(since time.Time) []PixelCount {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	result := []PixelCount{}
+	for area, changed := range ps.changed {
+		if changed.After(since) {
+			result = append(result, PixelCount{
+				Area:   area,
+				Pixels: ps.pixels[area],
+			})
+		}
+	}
+	return result
 }
 
 // GetPixels returns all pixel counts
 func (ps *PixelStore) GetPixels() []PixelCount {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
 	var result []PixelCount
 	for area, pixels := range ps.pixels {
 		result = append(result, PixelCount{
@@ -0,0 +1,345 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/probemaster2/internal/config"
+)
+
+func TestMessageStoreConcurrentAccess(t *testing.T) {
+	ms := NewMessageStore(50, "", 16)
+	defer ms.Close()
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				ms.AddMessage(fmt.Sprintf("F16R co2=%d", w*1000+i))
+			}
+		}()
+	}
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lastID := ""
+			for range 200 {
+				ms.GetMessages()
+				batch := ms.GetMessagesAfter(lastID, 10)
+				if len(batch) > 0 {
+					lastID = batch[len(batch)-1].ID
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := ms.GetMessages()
+	if len(got) != 50 {
+		t.Fatalf("stored %d messages, want the 50 most recent", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Seq != got[i-1].Seq+1 {
+			t.Fatalf("messages out of sequence at %d: %d after %d", i, got[i].Seq, got[i-1].Seq)
+		}
+	}
+}
+
+func TestMessagePagingAcrossDigitBoundary(t *testing.T) {
+	ms := NewMessageStore(100, "", 16)
+	defer ms.Close()
+	var added []ProbeMessage
+	for i := range 12 {
+		added = append(added, ms.AddMessage(fmt.Sprintf("F16R co2=%d", i)))
+	}
+	ninth, tenth := added[8], added[9]
+	if ninth.Seq != 9 || tenth.Seq != 10 {
+		t.Fatalf("seqs = %d, %d; want 9, 10", ninth.Seq, tenth.Seq)
+	}
+
+	after := ms.GetMessagesAfter(ninth.ID, 10)
+	if len(after) != 3 || after[0].Seq != 10 || after[2].Seq != 12 {
+		t.Errorf("after seq 9 = %v, want seqs 10 to 12", seqs(after))
+	}
+
+	before := ms.GetMessagesBefore(tenth.ID, 100)
+	if len(before) != 9 || before[0].Seq != 1 || before[8].Seq != 9 {
+		t.Errorf("before seq 10 = %v, want seqs 1 to 9", seqs(before))
+	}
+}
+
+// seqs lists the sequence numbers of messages, for failure output
+func seqs(messages []ProbeMessage) []int64 {
+	result := make([]int64, len(messages))
+	for i, msg := range messages {
+		result[i] = msg.Seq
+	}
+	return result
+}
+
+func TestCompactionCollapsesRepeatedMessages(t *testing.T) {
+	ms := NewMessageStore(100, "", 16)
+	ms.compact = true
+	defer ms.Close()
+
+	first := ms.AddMessage("F16R co2=454")
+	ms.AddMessage("F17R co2=500") // Another probe in between doesn't break the run
+	repeat := ms.AddMessage("F16R co2=454")
+	if repeat.ID != first.ID || repeat.Seq != first.Seq || repeat.Repeats != 1 {
+		t.Errorf("repeat = %+v, want message %s with 1 repeat", repeat, first.ID)
+	}
+	if repeat.LastRepeatAt.IsZero() {
+		t.Error("repeat has no lastRepeatAt")
+	}
+	ms.AddMessage("F16R co2=454")
+	ms.AddMessage("F16R co2=455")
+	ms.AddMessage("F16R co2=454") // Only the probe's latest message counts
+
+	got := ms.GetMessages()
+	want := []struct {
+		data    string
+		repeats int
+	}{
+		{"F16R co2=454", 2},
+		{"F17R co2=500", 0},
+		{"F16R co2=455", 0},
+		{"F16R co2=454", 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("stored %d messages, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Data != w.data || got[i].Repeats != w.repeats {
+			t.Errorf("message %d = %q with %d repeats, want %q with %d", i, got[i].Data, got[i].Repeats, w.data, w.repeats)
+		}
+	}
+}
+
+func TestCompactionOffStoresEveryMessage(t *testing.T) {
+	ms := NewMessageStore(100, "", 16)
+	defer ms.Close()
+
+	ms.AddMessage("F16R co2=454")
+	ms.AddMessage("F16R co2=454")
+	if got := ms.GetMessages(); len(got) != 2 || got[0].Repeats != 0 {
+		t.Errorf("messages = %+v, want both stored without repeats", got)
+	}
+}
+
+func TestCompactionComparesRawPayload(t *testing.T) {
+	ms := NewMessageStore(100, "", 16)
+	ms.compact = true
+	defer ms.Close()
+
+	ms.AddRawMessageAt("F16R co2=454", "F16R co2=454\x00", time.Time{})
+	ms.AddRawMessageAt("F16R co2=454", "F16R\tco2=454", time.Time{})
+	if got := ms.GetMessages(); len(got) != 2 {
+		t.Errorf("stored %d messages, want 2 since the received bytes differ", len(got))
+	}
+}
+
+func TestCompactionEnabledByConfig(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.CompactDuplicateMessages = true
+	})
+
+	for range 3 {
+		expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+	}
+	rec := serve(rt, "GET", "/api/poll", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Messages) != 1 {
+		t.Fatalf("got %d messages, want 1: %+v", len(body.Messages), body.Messages)
+	}
+	if repeats := body.Messages[0]["repeats"]; repeats != float64(2) {
+		t.Errorf("repeats = %v, want 2", repeats)
+	}
+	if _, ok := body.Messages[0]["lastRepeatAt"]; !ok {
+		t.Error("message has no lastRepeatAt")
+	}
+	// Every reading still updates the probe's history
+	if n := len(rt.r.historyStore.Series("F16R", "co2", 0)); n != 3 {
+		t.Errorf("history has %d points, want 3", n)
+	}
+}
+
+func TestMessageMaxLengthTruncates(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.MessageMaxLength = 16
+	})
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454,temp=25.5,hum=36.2", nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F17R co2=454", nil), http.StatusOK)
+	got := rt.r.messageStore.GetMessages()
+	if len(got) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(got))
+	}
+	if got[0].Data != "F16R co2=454,tem" || !got[0].Truncated {
+		t.Errorf("long message = %+v, want data cut to 16 bytes and flagged", got[0])
+	}
+	if got[1].Data != "F17R co2=454" || got[1].Truncated {
+		t.Errorf("short message = %+v, want it stored as is", got[1])
+	}
+	// Only the stored copy is cut; every metric in the line is still read
+	if reading, ok := rt.r.readingStore.GetReading("F16R"); !ok || reading.Metrics["hum"] != 36.2 {
+		t.Errorf("reading = %+v, want hum 36.2", reading)
+	}
+
+	// The flag appears in the message JSON
+	rec := serve(rt, "GET", "/api/poll", "", nil)
+	var body struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Messages) != 2 || body.Messages[0]["truncated"] != true {
+		t.Errorf("messages = %v, want the first flagged truncated", body.Messages)
+	}
+	if _, ok := body.Messages[1]["truncated"]; ok {
+		t.Errorf("short message JSON = %v, want no truncated field", body.Messages[1])
+	}
+}
+
+func TestMessageMaxLengthRejects(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.MessageMaxLength = 16
+		cfg.MessageOversize = "reject"
+	})
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454,temp=25.5,hum=36.2", nil), http.StatusRequestEntityTooLarge)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F17R co2=454", nil), http.StatusOK)
+
+	// In a multi-line body only the long line is refused
+	rec := serve(rt, "POST", "/api/probedata", "F15R co2=454,temp=25.5,hum=36.2\nF15R co2=455", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var batch struct {
+		Results  []batchResult `json:"results"`
+		Received int           `json:"received"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if batch.Received != 1 || batch.Results[0].Status != "error" || batch.Results[1].Status != "received" {
+		t.Errorf("batch = %+v, want the first line rejected and the second received", batch)
+	}
+
+	got := rt.r.messageStore.GetMessages()
+	if len(got) != 2 || got[0].Data != "F17R co2=454" || got[1].Data != "F15R co2=455" {
+		t.Errorf("messages = %+v, want only the short lines", got)
+	}
+	for _, msg := range got {
+		if msg.Truncated {
+			t.Errorf("message %s flagged truncated in reject mode", msg.ID)
+		}
+	}
+}
+
+func TestMessageMaxLengthZeroIsUnlimited(t *testing.T) {
+	t.Setenv("MESSAGE_MAX_LENGTH", "")
+	if cfg := config.Load(); cfg.MessageMaxLength != 0 {
+		t.Errorf("default MessageMaxLength = %d, want 0 for no limit", cfg.MessageMaxLength)
+	}
+
+	long := "F16R co2=454," + strings.Repeat("x", 2000) + "=1"
+	for _, mode := range []string{"truncate", "reject"} {
+		rt := newTestRouter(t, func(cfg *config.Config) {
+			cfg.MessageMaxLength = 0
+			cfg.MessageOversize = mode
+		})
+		expectStatus(t, serve(rt, "POST", "/api/probedata", long, nil), http.StatusOK)
+		if got := rt.r.messageStore.GetMessages(); len(got) != 1 || got[0].Data != long || got[0].Truncated {
+			t.Errorf("%s mode with no limit stored %+v, want the whole line", mode, got)
+		}
+	}
+}
+
+func TestCompactionIndexFollowsRemovals(t *testing.T) {
+	ms := NewMessageStore(2, "", 16)
+	ms.compact = true
+	defer ms.Close()
+
+	// Once the probe's latest message is deleted, an identical payload starts a new message
+	first := ms.AddMessage("F16R co2=454")
+	ms.DeleteByID(first.ID)
+	if again := ms.AddMessage("F16R co2=454"); again.ID == first.ID || again.Repeats != 0 {
+		t.Errorf("message after delete = %+v, want a new message", again)
+	}
+
+	// The same goes for a message evicted from a full store
+	ms.AddMessage("F17R co2=500")
+	ms.AddMessage("F18R co2=600") // Evicts F16R
+	if got := ms.AddMessage("F16R co2=454"); got.Repeats != 0 {
+		t.Errorf("message after eviction = %+v, want a new message", got)
+	}
+
+	ms.Clear()
+	if got := ms.AddMessage("F16R co2=454"); got.Repeats != 0 {
+		t.Errorf("message after clear = %+v, want a new message", got)
+	}
+	if got := ms.AddMessage("F16R co2=454"); got.Repeats != 1 {
+		t.Errorf("repeat after clear = %+v, want 1 repeat", got)
+	}
+}
+
+// A repeat keeps its message's seq, so it goes out as a repeat frame rather than a second message
+func TestCompactionBroadcastsRepeatFrame(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.CompactDuplicateMessages = true
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+	stream := rt.r.messageStore.addStreamClient()
+	defer rt.r.messageStore.removeStreamClient(stream)
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+
+	var message ProbeMessage
+	if err := json.Unmarshal(readFrameOfType(t, conn, "message").Payload, &message); err != nil {
+		t.Fatalf("decode message: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var next testFrame
+	if err := conn.ReadJSON(&next); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if next.Type != "repeat" {
+		t.Fatalf("frame after the message = %q, want repeat", next.Type)
+	}
+	var repeat MessageRepeat
+	if err := json.Unmarshal(next.Payload, &repeat); err != nil {
+		t.Fatalf("decode repeat: %v", err)
+	}
+	if repeat.ID != message.ID || repeat.Seq != message.Seq || repeat.ProbeID != "F16R" || repeat.Repeats != 1 || repeat.LastRepeatAt.IsZero() {
+		t.Errorf("repeat = %+v, want 1 repeat of message %d", repeat, message.Seq)
+	}
+
+	// SSE clients only saw the original message
+	if n := len(stream.messages); n != 1 {
+		t.Errorf("SSE client got %d messages, want 1", n)
+	}
+}
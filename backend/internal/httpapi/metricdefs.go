@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// MetricDefinition describes a known probe metric and its plausible range
+// Values outside [Min, Max] are physically unlikely and usually mean a sensor fault
+type MetricDefinition struct {
+	Name        string  `json:"name"`
+	Unit        string  `json:"unit"`
+	Description string  `json:"description"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+}
+
+// metricDefinitions is the registry of metrics reported by the probe firmware
+var metricDefinitions = map[string]MetricDefinition{
+	"co2":  {Name: "co2", Unit: "ppm", Description: "CO2 concentration", Min: 250, Max: 10000},
+	"temp": {Name: "temp", Unit: "°C", Description: "Air temperature", Min: -40, Max: 85},
+	"hum":  {Name: "hum", Unit: "%", Description: "Relative humidity", Min: 0, Max: 100},
+	"db":   {Name: "db", Unit: "dB", Description: "Sound level", Min: 0, Max: 140},
+	"rssi": {Name: "rssi", Unit: "dBm", Description: "WiFi signal strength", Min: -120, Max: 0},
+}
+
+// metricSuspect reports whether a value falls outside its metric's plausible range
+// Metrics without a definition are never suspect
+func metricSuspect(metric string, value float64) bool {
+	def, ok := metricDefinitions[metric]
+	if !ok {
+		return false
+	}
+	return value < def.Min || value > def.Max
+}
+
+func (r *router) handleMetricDefinitions(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	definitions := make([]MetricDefinition, 0, len(metricDefinitions))
+	for _, def := range metricDefinitions {
+		definitions = append(definitions, def)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"definitions": definitions,
+	})
+}
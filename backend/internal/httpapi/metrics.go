@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// serverMetrics holds the counters exported on /metrics
+type serverMetrics struct {
+	messagesReceived atomic.Int64
+	pixelUpdates     atomic.Int64
+	// Payloads whose probe ID doesn't resolve to an area/location
+	unrecognizedProbeIDs atomic.Int64
+	// Probe data requests rejected by the per-IP rate limit
+	rateLimited atomic.Int64
+}
+
+// writeMetric writes a single metric in the Prometheus text exposition format
+func writeMetric(w io.Writer, name, metricType, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+func (r *router) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "probemaster_messages_received_total", "counter",
+		"Total probe data messages received.", r.metrics.messagesReceived.Load())
+	writeMetric(w, "probemaster_probes_known", "gauge",
+		"Number of probes currently assigned to an area.", int64(r.areaStore.ProbeCount()))
+	writeMetric(w, "probemaster_websocket_clients", "gauge",
+		"Number of connected WebSocket clients.", int64(r.messageStore.ClientCount()))
+	writeMetric(w, "probemaster_stream_clients", "gauge",
+		"Number of connected server-sent events clients.", int64(r.messageStore.StreamClientCount()))
+	writeMetric(w, "probemaster_pixel_updates_total", "counter",
+		"Total pixel update requests received.", r.metrics.pixelUpdates.Load())
+	writeMetric(w, "probemaster_unrecognized_probe_ids_total", "counter",
+		"Total probe data payloads with an unrecognized probe ID.", r.metrics.unrecognizedProbeIDs.Load())
+	writeMetric(w, "probemaster_messages_evicted_total", "counter",
+		"Total probe messages dropped because the message store was full.", r.messageStore.Stats().Evictions)
+	writeMetric(w, "probemaster_rate_limited_total", "counter",
+		"Total probe data requests rejected by the per-IP rate limit.", r.metrics.rateLimited.Load())
+	writeMetric(w, "probemaster_commands_expired_total", "counter",
+		"Total commands that expired before a probe pulled them.", r.commandQueue.Expired())
+	writeMetric(w, "probemaster_broadcast_dropped_total", "counter",
+		"Total WebSocket frames dropped because the broadcast buffer was full.", r.messageStore.BroadcastDropped())
+}
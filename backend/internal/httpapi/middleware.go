@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets WebSocket upgrades work through the recorder
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	// Hijacked connections are reported as switching protocols
+	sr.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush lets streaming handlers push data through the recorder
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// logRequests logs each request with its status code, latency, and request ID
+// The ID is taken from a well-formed X-Request-ID header or generated, echoed back in
+// X-Request-ID, and carried in the request context for spans
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		id := req.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		req = req.WithContext(withRequestID(req.Context(), id))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, req)
+		slog.Info("request",
+			"request_id", id,
+			"method", req.Method,
+			"path", req.URL.Path,
+			"remote", req.RemoteAddr,
+			"status", rec.status,
+			"latency_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// originAllowed reports whether a browser origin may access the API
+// An empty allow-list permits every origin
+func (r *router) originAllowed(origin string) bool {
+	if len(r.cfg.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range r.cfg.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearDeadlines exempts a long-lived response from the server's ReadTimeout and WriteTimeout
+// net/http sets both deadlines once per request, so a WebSocket or SSE stream would be cut off
+// that long after connecting: the write deadline fails the next send, and the read deadline
+// fails the server's background read, which cancels the request context
+// Clearing them here leaves the handler to bound its own reads and writes (pong wait, wsWriteWait)
+// The deadlines are on the underlying connection, so clearing them also covers hijacked WebSockets
+func clearDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Warn("clear read deadline", "error", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Warn("clear write deadline", "error", err)
+	}
+}
+
+// limitBodies caps every request body at cfg.MaxBodyBytes so a huge upload can't exhaust memory
+// A declared Content-Length over the limit is refused up front; otherwise handlers see reads
+// past the limit fail with *http.MaxBytesError and answer 413 via writeBodyError
+func (r *router) limitBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ContentLength > r.cfg.MaxBodyBytes {
+			http.Error(w, fmt.Sprintf("request body too large (limit %d bytes)", r.cfg.MaxBodyBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if req.Body != nil {
+			req.Body = http.MaxBytesReader(w, req.Body, r.cfg.MaxBodyBytes)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// cors sets CORS headers for every response and answers preflight requests
+// With an allow-list configured, only listed origins are echoed back (with credentials allowed);
+// otherwise the wildcard origin is used
+func (r *router) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if len(r.cfg.AllowedOrigins) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin != "" && r.originAllowed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding, X-Access-Key, Idempotency-Key, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+
+		// Handle CORS preflight
+		if req.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/probemaster2/internal/config"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	allowList := []string{"https://dash.example.com", "http://localhost:5173"}
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"listed origin", allowList, "https://dash.example.com", true},
+		{"listed origin, other case", allowList, "HTTPS://Dash.Example.com", true},
+		{"unlisted origin", allowList, "https://evil.example.com", false},
+		{"wildcard", nil, "https://anything.example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &router{cfg: config.Config{AllowedOrigins: tt.allowed}}
+			if got := r.originAllowed(tt.origin); got != tt.want {
+				t.Errorf("originAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		origin     string
+		wantOrigin string
+	}{
+		{"wildcard", nil, "https://anything.example.com", "*"},
+		{"listed origin is echoed", []string{"https://dash.example.com"}, "https://dash.example.com", "https://dash.example.com"},
+		{"unlisted origin gets no header", []string{"https://dash.example.com"}, "https://evil.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := newTestRouter(t, func(cfg *config.Config) {
+				cfg.AllowedOrigins = tt.allowed
+			})
+			rec := serve(rt, "OPTIONS", "/api/probedata", "", map[string]string{"Origin": tt.origin})
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AllowedOrigins = []string{"https://dash.example.com"}
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"allowed origin", "https://dash.example.com", true},
+		{"other origin", "https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), header)
+			if conn != nil {
+				conn.Close()
+			}
+			if got := err == nil; got != tt.want {
+				status := 0
+				if resp != nil {
+					status = resp.StatusCode
+				}
+				t.Errorf("connected = %v (status %d, err %v), want %v", got, status, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOversizedBodiesGet413(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.MaxBodyBytes = 64
+	})
+	// Bodies are well-formed up to the cut, so only the size can fail them
+	padding := strings.Repeat("9", 100)
+	bodies := map[string]string{
+		"/api/probedata":          "F16R co2=" + padding,
+		"/api/stats":              "FLOOR16 co2=" + padding,
+		"/api/pixels":             "FLOOR16 " + padding,
+		"/api/thresholds/FLOOR16": `{"thresholds":[{"metric":"` + padding + `"}]}`,
+	}
+
+	for target, body := range bodies {
+		for _, declared := range []bool{true, false} {
+			req := httptest.NewRequest("POST", target, strings.NewReader(body))
+			if !declared {
+				// Chunked uploads have no Content-Length to refuse up front
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, req)
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("POST %s (declared length %v): status = %d, want 413", target, declared, rec.Code)
+			}
+		}
+	}
+
+	// Bodies within the limit are unaffected
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+}
+
+func TestProtectReads(t *testing.T) {
+	reads := []string{"/api/poll", "/api/areas", "/api/stats", "/api/messages", "/api/snapshot", "/api/probes/status", "/api/probes/F16R/assignments", "/api/version", "/metrics"}
+	// Health checks and the endpoints probes call stay open in both modes
+	open := []string{"/livez", "/healthz", "/api/probeconfig", "/api/sendcommand?probeId=F16R"}
+	key := map[string]string{"X-Access-Key": "s3cret"}
+
+	for _, protect := range []bool{false, true} {
+		rt := newTestRouter(t, func(cfg *config.Config) {
+			cfg.AccessKey = "s3cret"
+			cfg.ProtectReads = protect
+		})
+		for _, path := range reads {
+			want := http.StatusOK
+			if protect {
+				want = http.StatusUnauthorized
+			}
+			if rec := serve(rt, "GET", path, "", nil); rec.Code != want {
+				t.Errorf("PROTECT_READS=%v: GET %s without key = %d, want %d", protect, path, rec.Code, want)
+			}
+			if rec := serve(rt, "GET", path, "", key); rec.Code != http.StatusOK {
+				t.Errorf("PROTECT_READS=%v: GET %s with key = %d, want 200", protect, path, rec.Code)
+			}
+		}
+		for _, path := range open {
+			if rec := serve(rt, "GET", path, "", nil); rec.Code != http.StatusOK {
+				t.Errorf("PROTECT_READS=%v: GET %s without key = %d, want 200", protect, path, rec.Code)
+			}
+		}
+		// POST /api/poll is a read too, but probe data and heartbeats never need the key
+		wantPoll := http.StatusOK
+		if protect {
+			wantPoll = http.StatusUnauthorized
+		}
+		if rec := serve(rt, "POST", "/api/poll", "{}", nil); rec.Code != wantPoll {
+			t.Errorf("PROTECT_READS=%v: POST /api/poll without key = %d, want %d", protect, rec.Code, wantPoll)
+		}
+		expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+		expectStatus(t, serve(rt, "POST", "/api/probes/F16R/heartbeat", "", nil), http.StatusOK)
+	}
+}
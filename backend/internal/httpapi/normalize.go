@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"log"
+	"strings"
+)
+
+// defaultAreaAliases are the built-in area aliases; AREA_ALIASES entries are added over them
+var defaultAreaAliases = map[string]string{
+	"TEA_ROOM": "TEAROOM",
+}
+
+// nameNormalizer converts area and location names to their canonical stored form
+// A name is trimmed and uppercased, then replaced by its canonical name if it is an alias,
+// so Floor17 -> FLOOR17, Tea_room -> TEAROOM, pool -> POOL
+type nameNormalizer struct {
+	areas     map[string]string // Uppercased alias -> canonical area
+	locations map[string]string // Uppercased alias -> canonical location
+}
+
+// newNameNormalizer builds a normalizer from alias=canonical entries, such as "GYM=FITNESS"
+// Malformed entries are logged and skipped
+func newNameNormalizer(areaAliases, locationAliases []string) *nameNormalizer {
+	return &nameNormalizer{
+		areas:     parseAliases("area", defaultAreaAliases, areaAliases),
+		locations: parseAliases("location", nil, locationAliases),
+	}
+}
+
+// parseAliases merges alias=canonical entries over a copy of defaults, uppercasing both sides
+func parseAliases(kind string, defaults map[string]string, entries []string) map[string]string {
+	aliases := make(map[string]string, len(defaults)+len(entries))
+	for alias, canonical := range defaults {
+		aliases[alias] = canonical
+	}
+	for _, entry := range entries {
+		alias, canonical, ok := strings.Cut(entry, "=")
+		alias = strings.ToUpper(strings.TrimSpace(alias))
+		canonical = strings.ToUpper(strings.TrimSpace(canonical))
+		if !ok || alias == "" || canonical == "" {
+			log.Printf("%s aliases: skipping %q, want alias=name", kind, entry)
+			continue
+		}
+		aliases[alias] = canonical
+	}
+	return aliases
+}
+
+// normalizeArea returns the canonical form of an area name, or "" for a blank one
+func (n *nameNormalizer) normalizeArea(area string) string {
+	return normalizeName(area, n.areas)
+}
+
+// normalizeLocation returns the canonical form of a location name, or "" for a blank one
+func (n *nameNormalizer) normalizeLocation(location string) string {
+	return normalizeName(location, n.locations)
+}
+
+func normalizeName(name string, aliases map[string]string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if canonical, ok := aliases[name]; ok {
+		return canonical
+	}
+	return name
+}
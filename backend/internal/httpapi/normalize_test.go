@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestNameNormalizerBuiltInAliases(t *testing.T) {
+	n := newNameNormalizer(nil, nil)
+	areas := map[string]string{
+		"Floor17":  "FLOOR17",
+		"floor16":  "FLOOR16",
+		"FLOOR15":  "FLOOR15",
+		"Tea_room": "TEAROOM",
+		"tea_room": "TEAROOM",
+		"TEA_ROOM": "TEAROOM",
+		"TEAROOM":  "TEAROOM",
+		"pool":     "POOL",
+		"Pool":     "POOL",
+		" lobby  ": "LOBBY",
+		"":         "",
+		"   ":      "",
+	}
+	for in, want := range areas {
+		if got := n.normalizeArea(in); got != want {
+			t.Errorf("normalizeArea(%q) = %q, want %q", in, got, want)
+		}
+	}
+	locations := map[string]string{
+		"Rotunda":   "ROTUNDA",
+		"hallway":   "HALLWAY",
+		"Line":      "LINE",
+		"location1": "LOCATION1",
+		"Location2": "LOCATION2",
+		" desk ":    "DESK",
+	}
+	for in, want := range locations {
+		if got := n.normalizeLocation(in); got != want {
+			t.Errorf("normalizeLocation(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNameNormalizerCustomAliases(t *testing.T) {
+	n := newNameNormalizer(
+		[]string{"gym=Fitness", " Tea_Room = KITCHEN ", "broken", "=POOL", "SPA="},
+		[]string{"Front_Desk=DESK"},
+	)
+	for in, want := range map[string]string{
+		"gym":      "FITNESS",
+		"GYM":      "FITNESS",
+		"tea_room": "KITCHEN", // A configured alias overrides the built-in one
+		"broken":   "BROKEN",  // Malformed entries are skipped
+		"spa":      "SPA",
+	} {
+		if got := n.normalizeArea(in); got != want {
+			t.Errorf("normalizeArea(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := n.normalizeLocation("front_desk"); got != "DESK" {
+		t.Errorf("normalizeLocation(front_desk) = %q, want DESK", got)
+	}
+	// Area and location aliases are separate tables
+	if got := n.normalizeLocation("gym"); got != "GYM" {
+		t.Errorf("normalizeLocation(gym) = %q, want GYM", got)
+	}
+}
+
+func TestProbeAssignmentUsesAliases(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AreaAliases = []string{"GYM=FITNESS"}
+		cfg.LocationAliases = []string{"FRONT_DESK=DESK"}
+	})
+
+	expectStatus(t, serve(rt, "POST", "/api/probes/G1", `{"area": "gym", "location": "front_desk"}`, nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probes/T1", `{"area": "Tea_room", "location": "rotunda"}`, nil), http.StatusOK)
+
+	for probeID, want := range map[string][2]string{"G1": {"FITNESS", "DESK"}, "T1": {"TEAROOM", "ROTUNDA"}} {
+		area, location, ok := rt.r.areaStore.FindProbe(probeID)
+		if !ok || area != want[0] || location != want[1] {
+			t.Errorf("FindProbe(%s) = %q, %q, %v, want %s/%s", probeID, area, location, ok, want[0], want[1])
+		}
+	}
+
+	// Lookups go through the same table
+	if _, ok := rt.r.areaStore.GetLocations("gym"); !ok {
+		t.Error("GetLocations(gym) didn't find FITNESS")
+	}
+	// The assignment log records the canonical names
+	events := rt.r.assignmentLog.ForProbe("G1")
+	if len(events) != 1 || events[0].Area != "FITNESS" || events[0].Location != "DESK" {
+		t.Errorf("assignment log = %+v, want FITNESS/DESK", events)
+	}
+}
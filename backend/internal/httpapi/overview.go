@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AreaOverview summarizes one area for the overview screen
+type AreaOverview struct {
+	Area        string `json:"area"`
+	ProbeCount  int    `json:"probeCount"`       // Probes assigned to the area
+	StaleProbes int    `json:"staleProbes"`      // Assigned probes that haven't reported recently (or ever)
+	Pixels      string `json:"pixels,omitempty"` // Current pixel value, omitted if never set
+}
+
+func (r *router) handleOverview(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	staleAfter := time.Duration(r.cfg.ProbeStaleSeconds) * time.Second
+
+	// Area store and pixel store keys can differ in case, so join on the normalized name
+	overview := make(map[string]*AreaOverview)
+	entry := func(area string) *AreaOverview {
+		key := r.normalizer.normalizeArea(area)
+		if o, ok := overview[key]; ok {
+			return o
+		}
+		o := &AreaOverview{Area: key}
+		overview[key] = o
+		return o
+	}
+
+	for area, locations := range r.areaStore.GetAreas() {
+		o := entry(area)
+		for _, loc := range locations {
+			if loc.ProbeID == "" {
+				continue
+			}
+			o.ProbeCount++
+			if lastSeen, ok := r.lastSeenStore.LastSeen(loc.ProbeID); !ok || now.Sub(lastSeen) > staleAfter {
+				o.StaleProbes++
+			}
+		}
+	}
+	// Areas with a pixel value but no probes are still shown
+	for _, pc := range r.pixelStore.GetPixels() {
+		entry(pc.Area).Pixels = pc.Pixels
+	}
+
+	areas := make([]AreaOverview, 0, len(overview))
+	for _, o := range overview {
+		areas = append(areas, *o)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i].Area < areas[j].Area
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(areas)
+}
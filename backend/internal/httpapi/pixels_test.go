@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestPixelStoreChangedSince(t *testing.T) {
+	ps := NewPixelStore(6)
+	ps.UpdatePixels([]PixelCount{{Area: "pool", Pixels: "3"}, {Area: "FLOOR16", Pixels: "5"}})
+	mark := time.Now()
+
+	if changed := ps.ChangedSince(mark); len(changed) != 0 {
+		t.Errorf("changed before any update = %+v, want none", changed)
+	}
+
+	// POOL is re-sent unchanged, so only FLOOR16 counts as changed
+	ps.UpdatePixels([]PixelCount{{Area: "POOL", Pixels: "3"}, {Area: "FLOOR16", Pixels: "6*"}})
+	changed := ps.ChangedSince(mark)
+	if len(changed) != 1 || changed[0] != (PixelCount{Area: "FLOOR16", Pixels: "6*"}) {
+		t.Errorf("changed = %+v, want only FLOOR16 at 6*", changed)
+	}
+}
+
+func TestPixelsSinceEndpoint(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	expectStatus(t, serve(rt, "POST", "/api/pixels", `[{"area":"POOL","pixels":"3"}]`, nil), http.StatusOK)
+
+	rec := serve(rt, "GET", "/api/pixels?since=2000-01-01T00:00:00Z", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var resp struct {
+		PixelCount []PixelCount `json:"pixelCount"`
+		Timestamp  time.Time    `json:"timestamp"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.PixelCount) != 1 || resp.PixelCount[0].Area != "POOL" {
+		t.Fatalf("pixelCount = %+v, want POOL", resp.PixelCount)
+	}
+
+	// Nothing has changed since the returned timestamp
+	rec = serve(rt, "GET", "/api/pixels?since="+url.QueryEscape(resp.Timestamp.Format(time.RFC3339Nano)), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"pixelCount":[]`) {
+		t.Errorf("response = %s, want an empty pixelCount list", rec.Body)
+	}
+
+	expectStatus(t, serve(rt, "GET", "/api/pixels?since=yesterday", "", nil), http.StatusBadRequest)
+}
+
+func TestPixelsUnknownAreas(t *testing.T) {
+	body := `[{"area":"pool","pixels":"3"},{"area":"POOLL","pixels":"4"},{"area":"Lobby","pixels":"1"},{"area":"lobby","pixels":"2"}]`
+
+	// Lenient by default: everything is stored, and the unknown areas are flagged
+	rt := newTestRouter(t, nil)
+	rec := serve(rt, "POST", "/api/pixels", body, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var resp struct {
+		UnknownAreas []string `json:"unknownAreas"`
+		Rejected     []string `json:"rejected"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if strings.Join(resp.UnknownAreas, ",") != "POOLL,LOBBY" || resp.Rejected != nil {
+		t.Errorf("response = %s, want POOLL and LOBBY flagged", rec.Body)
+	}
+	if got := len(rt.r.pixelStore.GetPixels()); got != 3 {
+		t.Errorf("stored %d areas, want POOL, POOLL, and LOBBY", got)
+	}
+
+	rt = newTestRouter(t, func(cfg *config.Config) {
+		cfg.StrictPixelAreas = true
+	})
+	rec = serve(rt, "POST", "/api/pixels", body, nil)
+	expectStatus(t, rec, http.StatusOK)
+	resp.UnknownAreas, resp.Rejected = nil, nil
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if strings.Join(resp.Rejected, ",") != "POOLL,LOBBY" || resp.UnknownAreas != nil {
+		t.Errorf("response = %s, want POOLL and LOBBY rejected", rec.Body)
+	}
+	pixels := rt.r.pixelStore.GetPixels()
+	if len(pixels) != 1 || pixels[0] != (PixelCount{Area: "POOL", Pixels: "3"}) {
+		t.Errorf("stored %+v, want only POOL", pixels)
+	}
+
+	// A known area gets an empty rejected list
+	rec = serve(rt, "POST", "/api/pixels", `[{"area":"FLOOR16","pixels":"2"}]`, nil)
+	if !strings.Contains(rec.Body.String(), `"rejected":[]`) {
+		t.Errorf("response = %s, want an empty rejected list", rec.Body)
+	}
+}
+
+func TestValidPixels(t *testing.T) {
+	tests := []struct {
+		pixels string
+		max    int
+		want   bool
+	}{
+		{"0", 6, true},
+		{"6", 6, true},
+		{"6*", 6, true},
+		{"7", 6, false},
+		{"10", 12, true},
+		{"12*", 12, true},
+		{"13", 12, false},
+		{"13*", 12, false},
+		{"07", 12, false},
+		{"*", 12, false},
+		{"1**", 12, false},
+		{"*1", 12, false},
+		{"-1", 12, false},
+		{"1.5", 12, false},
+		{"", 12, false},
+	}
+	for _, tt := range tests {
+		if got := validPixels(tt.pixels, tt.max); got != tt.want {
+			t.Errorf("validPixels(%q, %d) = %v, want %v", tt.pixels, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestPixelsTwoDigitValues(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.PixelMax = 12
+	})
+
+	rec := serve(rt, "POST", "/api/pixels", `[{"area":"POOL","pixels":"12*"},{"area":"FLOOR16","pixels":10},{"area":"FLOOR17","pixels":"13"}]`, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var resp struct {
+		Invalid []PixelCount `json:"invalid"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Invalid) != 1 || resp.Invalid[0] != (PixelCount{Area: "FLOOR17", Pixels: "13"}) {
+		t.Errorf("invalid = %+v, want only FLOOR17 at 13", resp.Invalid)
+	}
+
+	got := map[string]string{}
+	for _, pc := range rt.r.pixelStore.GetPixels() {
+		got[pc.Area] = pc.Pixels
+	}
+	if len(got) != 2 || got["POOL"] != "12*" || got["FLOOR16"] != "10" {
+		t.Errorf("stored %v, want POOL at 12* and FLOOR16 at 10", got)
+	}
+
+	// The default range still stops at 6
+	rt = newTestRouter(t, nil)
+	rec = serve(rt, "POST", "/api/pixels", `[{"area":"POOL","pixels":"7"}]`, nil)
+	if !strings.Contains(rec.Body.String(), `"invalid":[{"area":"POOL","pixels":"7"}]`) || len(rt.r.pixelStore.GetPixels()) != 0 {
+		t.Errorf("response = %s, want 7 rejected with the default PIXEL_MAX", rec.Body)
+	}
+}
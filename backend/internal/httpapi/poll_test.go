@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+// pollResult decodes a /api/poll response
+func pollResult(t *testing.T, rec *httptest.ResponseRecorder) []ProbeMessage {
+	t.Helper()
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Messages []ProbeMessage `json:"messages"`
+		Count    int            `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode poll response: %v", err)
+	}
+	if body.Count != len(body.Messages) {
+		t.Errorf("count = %d, want %d", body.Count, len(body.Messages))
+	}
+	return body.Messages
+}
+
+func TestPollWaitReturnsOnNewMessage(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	first := rt.r.messageStore.AddMessage("F16R co2=400")
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	start := time.Now()
+	go func() {
+		done <- serve(rt, "GET", "/api/poll?wait=10&lastId="+first.ID, "", nil)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	next := rt.r.messageStore.AddMessage("F16R co2=410")
+
+	select {
+	case rec := <-done:
+		got := pollResult(t, rec)
+		if len(got) != 1 || got[0].ID != next.ID {
+			t.Fatalf("messages = %+v, want only %s", got, next.ID)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("poll returned after %v, want soon after the message", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll didn't return after a new message")
+	}
+}
+
+func TestPollWaitIgnoresOtherProbes(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	first := rt.r.messageStore.AddMessage("F16R co2=400")
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		body := `{"lastId": "` + first.ID + `", "probeId": "F17R", "wait": 10}`
+		done <- serve(rt, "POST", "/api/poll", body, nil)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	rt.r.messageStore.AddMessage("F16R co2=410")
+	select {
+	case rec := <-done:
+		t.Fatalf("poll for F17R returned on an F16R message: %s", rec.Body.String())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	want := rt.r.messageStore.AddMessage("F17R co2=420")
+	select {
+	case rec := <-done:
+		got := pollResult(t, rec)
+		if len(got) != 1 || got[0].ID != want.ID {
+			t.Fatalf("messages = %+v, want only %s", got, want.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll didn't return after a matching message")
+	}
+}
+
+func TestPollWaitTimesOut(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	first := rt.r.messageStore.AddMessage("F16R co2=400")
+
+	start := time.Now()
+	got := pollResult(t, serve(rt, "GET", "/api/poll?wait=0.2&lastId="+first.ID, "", nil))
+	if len(got) != 0 {
+		t.Fatalf("messages = %+v, want none", got)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("poll returned after %v, want it to wait 200ms", elapsed)
+	}
+
+	// Without wait, an empty poll returns straight away
+	start = time.Now()
+	pollResult(t, serve(rt, "GET", "/api/poll?lastId="+first.ID, "", nil))
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("poll without wait took %v", elapsed)
+	}
+}
+
+func TestPollWaitReturnsPendingMessagesImmediately(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	first := rt.r.messageStore.AddMessage("F16R co2=400")
+	rt.r.messageStore.AddMessage("F16R co2=410")
+
+	start := time.Now()
+	got := pollResult(t, serve(rt, "GET", "/api/poll?wait=10&lastId="+first.ID, "", nil))
+	if len(got) != 1 {
+		t.Fatalf("messages = %+v, want 1", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("poll with pending messages took %v", elapsed)
+	}
+}
+
+func TestPollWaitIsCapped(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.PollMaxWaitSeconds = 1
+	})
+	if got := rt.r.pollWait(60); got != time.Second {
+		t.Errorf("pollWait(60) = %v, want 1s", got)
+	}
+	if got := rt.r.pollWait(0.5); got != 500*time.Millisecond {
+		t.Errorf("pollWait(0.5) = %v, want 500ms", got)
+	}
+
+	first := rt.r.messageStore.AddMessage("F16R co2=400")
+	start := time.Now()
+	pollResult(t, serve(rt, "GET", "/api/poll?wait=60&lastId="+first.ID, "", nil))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("capped poll took %v, want about 1s", elapsed)
+	}
+}
+
+func TestPollWaitRejectsInvalidValue(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	for _, wait := range []string{"soon", "-1"} {
+		rec := serve(rt, "GET", "/api/poll?wait="+wait, "", nil)
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+}
+
+func TestPollWaitEndsOnShutdown(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	first := rt.r.messageStore.AddMessage("F16R co2=400")
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serve(rt, "GET", "/api/poll?wait=10&lastId="+first.ID, "", nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	rt.Stop()
+
+	select {
+	case rec := <-done:
+		if got := pollResult(t, rec); len(got) != 0 {
+			t.Fatalf("messages = %+v, want none", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll didn't end on shutdown")
+	}
+}
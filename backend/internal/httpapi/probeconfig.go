@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// probeConfigPath places the probe config next to the area file,
+// e.g. /data/areas.json -> /data/areas.probeconfig.json
+func probeConfigPath(areaStorePath string) string {
+	if areaStorePath == "" {
+		return ""
+	}
+	ext := filepath.Ext(areaStorePath)
+	return strings.TrimSuffix(areaStorePath, ext) + ".probeconfig.json"
+}
+
+// probeConfig is the settings probes fetch from GET /api/probeconfig
+type probeConfig struct {
+	Refresh int `json:"refresh"` // Seconds between probe reports
+}
+
+// ProbeConfigStore holds the probe config, persisting changes made at runtime
+type ProbeConfigStore struct {
+	mu     sync.RWMutex
+	config probeConfig
+	path   string // Optional JSON file the config is persisted to
+}
+
+// NewProbeConfigStore creates a probe config store defaulting to defaultRefresh seconds,
+// loading a saved config from path if set
+func NewProbeConfigStore(path string, defaultRefresh int) *ProbeConfigStore {
+	ps := &ProbeConfigStore{
+		config: probeConfig{Refresh: defaultRefresh},
+		path:   path,
+	}
+	if path == "" {
+		return ps
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ps
+	}
+	if err != nil {
+		log.Printf("probe config: read %s: %v", path, err)
+		return ps
+	}
+	var saved probeConfig
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("probe config: parse %s: %v", path, err)
+		return ps
+	}
+	if saved.Refresh < 1 {
+		log.Printf("probe config: %s has refresh %d, using %d", path, saved.Refresh, defaultRefresh)
+		return ps
+	}
+	ps.config = saved
+	return ps
+}
+
+// Refresh returns the probe refresh interval in seconds
+func (ps *ProbeConfigStore) Refresh() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.config.Refresh
+}
+
+// SetRefresh writes the config with a new probe refresh interval to disk and then applies it
+// If the write fails probes keep getting the previous value
+func (ps *ProbeConfigStore) SetRefresh(seconds int) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	updated := ps.config
+	updated.Refresh = seconds
+	if ps.path != "" {
+		if err := writeJSONFile(ps.path, updated); err != nil {
+			return err
+		}
+	}
+	ps.config = updated
+	return nil
+}
+
+func (r *router) handleProbeConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"refresh": r.probeConfig.Refresh(),
+		})
+		return
+	}
+
+	if req.Method == "POST" || req.Method == "PUT" {
+		var body struct {
+			Refresh int `json:"refresh"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if body.Refresh < 1 {
+			http.Error(w, "refresh must be at least 1 second", http.StatusBadRequest)
+			return
+		}
+		if err := r.probeConfig.SetRefresh(body.Refresh); err != nil {
+			log.Printf("probe config: save %s: %v", r.probeConfig.path, err)
+			http.Error(w, "failed to save probe config", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"refresh": body.Refresh,
+			"status":  "updated",
+		})
+		return
+	}
+
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+// probeRefresh fetches the refresh interval from GET /api/probeconfig
+func probeRefresh(t *testing.T, rt *Router) int {
+	t.Helper()
+	rec := serve(rt, "GET", "/api/probeconfig", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Refresh int `json:"refresh"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return body.Refresh
+}
+
+func TestProbeConfigDefault(t *testing.T) {
+	if got := probeRefresh(t, newTestRouter(t, nil)); got != 60 {
+		t.Errorf("default refresh = %d, want 60", got)
+	}
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.ProbeRefreshDefault = 15
+	})
+	if got := probeRefresh(t, rt); got != 15 {
+		t.Errorf("refresh = %d, want PROBE_REFRESH_DEFAULT 15", got)
+	}
+}
+
+func TestProbeConfigPersistsAcrossRestart(t *testing.T) {
+	areaPath := filepath.Join(t.TempDir(), "areas.json")
+	configure := func(cfg *config.Config) {
+		cfg.AreaStorePath = areaPath
+		cfg.ProbeRefreshDefault = 15
+	}
+
+	rt := newTestRouter(t, configure)
+	expectStatus(t, serve(rt, "POST", "/api/probeconfig", `{"refresh": 5}`, nil), http.StatusOK)
+	if got := probeRefresh(t, rt); got != 5 {
+		t.Fatalf("refresh after update = %d, want 5", got)
+	}
+	rt.Shutdown()
+
+	// The saved value wins over the configured default
+	if got := probeRefresh(t, newTestRouter(t, configure)); got != 5 {
+		t.Errorf("refresh after restart = %d, want 5", got)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(areaPath), "areas.probeconfig.json")); err != nil {
+		t.Errorf("probe config file: %v", err)
+	}
+}
+
+func TestProbeConfigIgnoresBadSavedValue(t *testing.T) {
+	areaPath := filepath.Join(t.TempDir(), "areas.json")
+	if err := os.WriteFile(probeConfigPath(areaPath), []byte(`{"refresh": 0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AreaStorePath = areaPath
+		cfg.ProbeRefreshDefault = 20
+	})
+	if got := probeRefresh(t, rt); got != 20 {
+		t.Errorf("refresh = %d, want the default 20", got)
+	}
+}
+
+func TestProbeConfigRejectsInvalidRefresh(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	for _, body := range []string{`{"refresh": 0}`, `{"refresh": -5}`, `{}`} {
+		expectStatus(t, serve(rt, "PUT", "/api/probeconfig", body, nil), http.StatusBadRequest)
+	}
+	if got := probeRefresh(t, rt); got != 60 {
+		t.Errorf("refresh = %d after rejected updates, want 60", got)
+	}
+	expectStatus(t, serve(rt, "DELETE", "/api/probeconfig", "", nil), http.StatusMethodNotAllowed)
+}
+
+func TestProbeConfigKeptWhenSaveFails(t *testing.T) {
+	areaPath := filepath.Join(t.TempDir(), "areas.json")
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AreaStorePath = areaPath
+		cfg.ProbeRefreshDefault = 15
+	})
+	if code, checks := readinessChecks(t, rt); code != http.StatusOK || checks["probeConfig"] != "ok" {
+		t.Errorf("healthz = %d %v, want 200 with probeConfig ok", code, checks)
+	}
+
+	// A directory in the file's place makes the write fail
+	if err := os.Mkdir(probeConfigPath(areaPath), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	expectStatus(t, serve(rt, "POST", "/api/probeconfig", `{"refresh": 5}`, nil), http.StatusInternalServerError)
+	if got := probeRefresh(t, rt); got != 15 {
+		t.Errorf("refresh after a failed save = %d, want the previous 15", got)
+	}
+	if code, checks := readinessChecks(t, rt); code != http.StatusServiceUnavailable || checks["probeConfig"] == "ok" {
+		t.Errorf("healthz = %d %v, want 503 with probeConfig failing", code, checks)
+	}
+}
@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+)
+
+// probeIDRule maps a family of probe IDs onto areas, like the built-in F<num><R|H> floor pattern
+// A matching ID is Prefix, then one or more digits, then a location code from LocationMap
+// e.g. {"prefix":"B","areaTemplate":"BASEMENT{num}","locationMap":{"N":"NORTH","":"MAIN"}}
+// maps B2N to BASEMENT2/NORTH and B2 to BASEMENT2/MAIN
+type probeIDRule struct {
+	Prefix       string            `json:"prefix"`
+	AreaTemplate string            `json:"areaTemplate"` // {num} is replaced with the digits
+	LocationMap  map[string]string `json:"locationMap"`  // Location code after the digits -> location; "" for no code
+}
+
+// match returns the area and location for an uppercased probe ID, if the rule applies
+func (rule probeIDRule) match(upperID string) (area, location string, ok bool) {
+	rest, found := strings.CutPrefix(upperID, rule.Prefix)
+	if !found {
+		return "", "", false
+	}
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return "", "", false
+	}
+	location, ok = rule.LocationMap[rest[i:]]
+	if !ok {
+		return "", "", false
+	}
+	return strings.ReplaceAll(rule.AreaTemplate, "{num}", rest[:i]), location, true
+}
+
+// loadProbeIDRules reads probe ID parsing rules from a JSON array, normalized to uppercase
+// Rules are tried in file order; incomplete rules are logged and skipped
+func loadProbeIDRules(path string) []probeIDRule {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("probe ID rules: %s not found, using built-in patterns only", path)
+		return nil
+	}
+	if err != nil {
+		log.Printf("probe ID rules: read %s: %v", path, err)
+		return nil
+	}
+
+	var fromFile []probeIDRule
+	if err := json.Unmarshal(data, &fromFile); err != nil {
+		log.Printf("probe ID rules: parse %s: %v", path, err)
+		return nil
+	}
+
+	rules := make([]probeIDRule, 0, len(fromFile))
+	for _, rule := range fromFile {
+		normalized := probeIDRule{
+			Prefix: strings.ToUpper(strings.TrimSpace(rule.Prefix)),
+			// Uppercasing the template turns {num} into {NUM}, so restore the placeholder
+			AreaTemplate: strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(rule.AreaTemplate)), "{NUM}", "{num}"),
+			LocationMap:  make(map[string]string, len(rule.LocationMap)),
+		}
+		for code, location := range rule.LocationMap {
+			code = strings.ToUpper(strings.TrimSpace(code))
+			location = strings.ToUpper(strings.TrimSpace(location))
+			if location != "" {
+				normalized.LocationMap[code] = location
+			}
+		}
+		if normalized.Prefix == "" || normalized.AreaTemplate == "" || len(normalized.LocationMap) == 0 {
+			log.Printf("probe ID rules: skipping incomplete rule for prefix %q", rule.Prefix)
+			continue
+		}
+		rules = append(rules, normalized)
+	}
+	return rules
+}
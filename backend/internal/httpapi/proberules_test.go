@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestCustomProbeIDRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `[
+		{"prefix": "b", "areaTemplate": "basement{num}", "locationMap": {"n": "north", "": "main"}},
+		{"prefix": "", "areaTemplate": "INCOMPLETE", "locationMap": {"": "X"}}
+	]`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.ProbeIDRulesPath = path
+	})
+	if n := len(rt.r.probeIDRules); n != 1 {
+		t.Fatalf("loaded %d rules, want 1 (the incomplete one skipped)", n)
+	}
+
+	tests := []struct {
+		probeID, area, location string
+	}{
+		{"B2N", "BASEMENT2", "NORTH"},
+		{"b12n", "BASEMENT12", "NORTH"},
+		{"B2", "BASEMENT2", "MAIN"},
+		{"B2S", "", ""},                // Unknown location code
+		{"BN", "", ""},                 // No digits
+		{"F16R", "FLOOR16", "ROTUNDA"}, // Built-in patterns still apply
+	}
+	for _, tt := range tests {
+		area, location := rt.r.parseProbeID(tt.probeID)
+		if area != tt.area || location != tt.location {
+			t.Errorf("parseProbeID(%q) = %q, %q; want %q, %q", tt.probeID, area, location, tt.area, tt.location)
+		}
+	}
+
+	// A reporting probe is auto-assigned through the rule
+	serve(rt, "POST", "/api/probedata", "B3N co2=454", nil)
+	if area, location, ok := rt.r.areaStore.FindProbe("B3N"); !ok || area != "BASEMENT3" || location != "NORTH" {
+		t.Errorf("B3N assigned to %s/%s (%v), want BASEMENT3/NORTH", area, location, ok)
+	}
+}
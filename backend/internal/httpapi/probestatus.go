@@ -0,0 +1,144 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ProbeStatusEvent is broadcast over the WebSocket when a probe goes stale or starts reporting again
+type ProbeStatusEvent struct {
+	ProbeID   string    `json:"probeId"`
+	Online    bool      `json:"online"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Timestamp time.Time `json:"timestamp"` // When the transition was detected
+}
+
+// probeState is the watcher's view of one probe
+type probeState struct {
+	online       bool
+	pendingSince time.Time // When the probe first looked like it had changed state; zero if it hasn't
+}
+
+// probeStatusWatcher turns last-seen times into online/offline transitions
+// A probe must stay in its new state for the hysteresis before the transition is reported,
+// so a probe hovering around the stale window doesn't flap
+// Only the watcher goroutine touches it, so it needs no lock
+type probeStatusWatcher struct {
+	hysteresis time.Duration
+	states     map[string]*probeState // probeID -> last reported state
+}
+
+func newProbeStatusWatcher(hysteresis time.Duration) *probeStatusWatcher {
+	return &probeStatusWatcher{
+		hysteresis: hysteresis,
+		states:     make(map[string]*probeState),
+	}
+}
+
+// check compares every probe's staleness with its last reported state, returning the transitions to report
+func (pw *probeStatusWatcher) check(statuses []ProbeStatus, now time.Time) []ProbeStatusEvent {
+	var events []ProbeStatusEvent
+	present := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		present[status.ProbeID] = true
+		online := !status.Stale
+		state, ok := pw.states[status.ProbeID]
+		if !ok {
+			// A probe seen for the first time has no previous state to transition from
+			pw.states[status.ProbeID] = &probeState{online: online}
+			continue
+		}
+		if online == state.online {
+			state.pendingSince = time.Time{}
+			continue
+		}
+		if state.pendingSince.IsZero() {
+			state.pendingSince = now
+		}
+		if now.Sub(state.pendingSince) < pw.hysteresis {
+			continue
+		}
+		state.online = online
+		state.pendingSince = time.Time{}
+		events = append(events, ProbeStatusEvent{
+			ProbeID:   status.ProbeID,
+			Online:    online,
+			LastSeen:  status.LastSeen,
+			Timestamp: now,
+		})
+	}
+	// Probes that were renamed away are forgotten without an event
+	for probeID := range pw.states {
+		if !present[probeID] {
+			delete(pw.states, probeID)
+		}
+	}
+	return events
+}
+
+// runProbeStatusWatcher broadcasts probe online/offline transitions until shutdown
+func (r *router) runProbeStatusWatcher() {
+	interval := time.Duration(r.cfg.ProbeStatusCheckSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	staleAfter := time.Duration(r.cfg.ProbeStaleSeconds) * time.Second
+	watcher := newProbeStatusWatcher(time.Duration(r.cfg.ProbeStatusHysteresisSeconds) * time.Second)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, event := range watcher.check(r.lastSeenStore.Statuses(now, staleAfter), now) {
+				r.messageStore.Broadcast(event)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// probeRoutes guards /api/probes/ writes with the access key, except heartbeats,
+// which probes send without a key the same way they post probe data
+func (r *router) probeRoutes() http.HandlerFunc {
+	guarded := r.protectReads(r.requireKeyForWrites(r.handleProbes))
+	heartbeat := r.rateLimit(r.handleProbes)
+	return func(w http.ResponseWriter, req *http.Request) {
+		// Split the way handleProbes does, so a probe whose ID is "heartbeat" is still guarded
+		probeID, action, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/api/probes/"), "/")
+		if probeID != "" && action == "heartbeat" {
+			heartbeat(w, req)
+			return
+		}
+		guarded(w, req)
+	}
+}
+
+// handleProbeHeartbeat marks a probe as seen without recording a message or reading,
+// so low-duty-cycle probes stay online between data posts
+func (r *router) handleProbeHeartbeat(w http.ResponseWriter, req *http.Request, probeID string) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// The ID must be one the probe could also post data under
+	probeID = strings.TrimSpace(probeID)
+	if _, _, err := splitProbeID(probeID+" ", r.cfg.MaxProbeIDLength); err != nil || strings.ContainsFunc(probeID, unicode.IsSpace) {
+		http.Error(w, "invalid probe ID", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	r.lastSeenStore.Touch(probeID, now)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   "ok",
+		"probeId":  probeID,
+		"lastSeen": now,
+	})
+}
@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestProbeHeartbeatUpdatesLastSeenOnly(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "s3cret"
+	})
+
+	before := time.Now()
+	// Probes send heartbeats without the access key
+	rec := serve(rt, "POST", "/api/probes/F16R/heartbeat", "", nil)
+	expectStatus(t, rec, 200)
+	var got struct {
+		ProbeID  string    `json:"probeId"`
+		LastSeen time.Time `json:"lastSeen"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.ProbeID != "F16R" || got.LastSeen.Before(before) {
+		t.Errorf("response = %+v, want F16R seen after %v", got, before)
+	}
+
+	lastSeen, ok := rt.r.lastSeenStore.LastSeen("F16R")
+	if !ok || !lastSeen.Equal(got.LastSeen) {
+		t.Errorf("LastSeen = %v, %v; want %v", lastSeen, ok, got.LastSeen)
+	}
+	if msgs := rt.r.messageStore.GetMessages(); len(msgs) != 0 {
+		t.Errorf("heartbeat stored messages: %+v", msgs)
+	}
+	if readings := rt.r.readingStore.AllReadings(); len(readings) != 0 {
+		t.Errorf("heartbeat stored readings: %+v", readings)
+	}
+}
+
+func TestProbeHeartbeatRejects(t *testing.T) {
+	rt := newTestRouter(t, nil)
+
+	expectStatus(t, serve(rt, "GET", "/api/probes/F16R/heartbeat", "", nil), 405)
+	expectStatus(t, serve(rt, "POST", "/api/probes/F16RABCDEF/heartbeat", "", nil), 400)
+	if _, ok := rt.r.lastSeenStore.LastSeen("F16RABCDEF"); ok {
+		t.Error("rejected heartbeat updated last-seen")
+	}
+}
+
+// Only the heartbeat action skips the key; a probe whose ID is "heartbeat" is guarded like any other
+func TestProbeNamedHeartbeatNeedsKey(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "s3cret"
+		cfg.MaxProbeIDLength = 16
+	})
+
+	body := `{"area":"POOL","location":"NORTH"}`
+	expectStatus(t, serve(rt, "POST", "/api/probes/heartbeat", body, nil), 401)
+	expectStatus(t, serve(rt, "DELETE", "/api/probes/heartbeat", "", nil), 401)
+	if _, _, ok := rt.r.areaStore.FindProbe("heartbeat"); ok {
+		t.Error("unauthenticated request assigned probe heartbeat")
+	}
+
+	key := map[string]string{"X-Access-Key": "s3cret"}
+	expectStatus(t, serve(rt, "POST", "/api/probes/heartbeat", body, key), 200)
+	// The probe can still send its own heartbeat without the key
+	expectStatus(t, serve(rt, "POST", "/api/probes/heartbeat/heartbeat", "", nil), 200)
+}
@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds the tokens left for one source IP
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // When tokens was last refilled
+}
+
+// rateLimiter is a per-IP token bucket limiter for probe ingestion
+// Each IP may spend up to burst requests at once, refilled at rate per second
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket // source IP -> bucket
+	trusted   []*net.IPNet            // Networks that are never limited
+	lastPrune time.Time
+}
+
+// newRateLimiter creates a limiter allowing rate requests per second with the given burst
+// trusted entries are CIDRs or bare IPs; malformed entries are logged and ignored
+func newRateLimiter(rate, burst int, trusted []string) *rateLimiter {
+	rl := &rateLimiter{
+		rate:    float64(rate),
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+	for _, entry := range trusted {
+		if !strings.Contains(entry, "/") {
+			// A bare IP trusts just that address
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				rl.trusted = append(rl.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("rate limit: ignoring invalid trusted CIDR %q: %v", entry, err)
+			continue
+		}
+		rl.trusted = append(rl.trusted, network)
+	}
+	return rl
+}
+
+// isTrusted reports whether ip falls in a trusted network
+func (rl *rateLimiter) isTrusted(ip net.IP) bool {
+	for _, network := range rl.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow spends a token for ip, reporting false if its bucket is empty
+func (rl *rateLimiter) Allow(ip string, now time.Time) bool {
+	if parsed := net.ParseIP(ip); parsed != nil && rl.isTrusted(parsed) {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Buckets idle long enough to refill completely carry no state, so drop them at most once a minute
+	if now.Sub(rl.lastPrune) >= time.Minute {
+		refill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+		for key, bucket := range rl.buckets {
+			if now.Sub(bucket.last) >= refill {
+				delete(rl.buckets, key)
+			}
+		}
+		rl.lastPrune = now
+	}
+
+	bucket, ok := rl.buckets[ip]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[ip] = bucket
+	} else if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(rl.burst, bucket.tokens+elapsed.Seconds()*rl.rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// clientIP returns the IP of the peer that sent the request
+// X-Forwarded-For is ignored since a flooding client could set it to anything
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// rateLimit rejects requests with 429 once the source IP has used up its bucket
+// A nil limiter (rate limiting disabled) passes everything through
+func (r *router) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if r.ingestLimiter == nil || req.Method == "OPTIONS" {
+			next(w, req)
+			return
+		}
+		if !r.ingestLimiter.Allow(clientIP(req), time.Now()) {
+			r.metrics.rateLimited.Add(1)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, req)
+	}
+}
@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl := newRateLimiter(2, 3, []string{"10.0.0.0/8", "192.168.1.5"})
+	now := time.Now()
+
+	for i := range 3 {
+		if !rl.Allow("203.0.113.7", now) {
+			t.Fatalf("request %d within the burst was limited", i+1)
+		}
+	}
+	if rl.Allow("203.0.113.7", now) {
+		t.Fatal("request past the burst was allowed")
+	}
+	// Other IPs have their own bucket
+	if !rl.Allow("203.0.113.8", now) {
+		t.Error("a different IP was limited")
+	}
+
+	// At 2 per second, half a second refills one token
+	later := now.Add(500 * time.Millisecond)
+	if !rl.Allow("203.0.113.7", later) {
+		t.Error("request after the refill was limited")
+	}
+	if rl.Allow("203.0.113.7", later) {
+		t.Error("refill granted more than one token")
+	}
+
+	for _, ip := range []string{"10.1.2.3", "192.168.1.5"} {
+		for i := range 10 {
+			if !rl.Allow(ip, now) {
+				t.Errorf("trusted %s limited on request %d", ip, i+1)
+				break
+			}
+		}
+	}
+}
+
+func TestProbeDataRateLimit(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.IngestRateLimit = 20
+		cfg.IngestRateBurst = 2
+	})
+
+	for range 2 {
+		expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+	}
+	rec := serve(rt, "POST", "/api/probedata", "F16R co2=454", nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+
+	// 20 per second refills a token every 50ms
+	time.Sleep(100 * time.Millisecond)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+}
@@ -0,0 +1,510 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Reading represents the latest parsed metric values reported by a probe
+type Reading struct {
+	ProbeID   string             `json:"probeId"`
+	Metrics   map[string]float64 `json:"metrics"`
+	Suspect   []string           `json:"suspect"`   // Metrics outside their plausible range
+	Anomalous []string           `json:"anomalous"` // Metrics far outside their recent history
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// ReadingStore stores the latest reading for each probe
+type ReadingStore struct {
+	mu       sync.RWMutex
+	readings map[string]Reading // probeID -> latest reading
+	version  uint64             // Bumped on every change
+}
+
+// NewReadingStore creates a new reading store
+func NewReadingStore() *ReadingStore {
+	return &ReadingStore{
+		readings: make(map[string]Reading),
+	}
+}
+
+// UpdateReading replaces the latest reading for a probe
+// suspect lists the metrics that are outside their plausible range, and anomalous the ones
+// far outside their recent history
+func (rs *ReadingStore) UpdateReading(probeID string, metrics map[string]float64, suspect, anomalous []string, timestamp time.Time) {
+	probeID = strings.TrimSpace(probeID)
+	if probeID == "" {
+		return
+	}
+
+	// Keep our own copy so callers can't mutate stored metrics
+	metricsCopy := make(map[string]float64, len(metrics))
+	for k, v := range metrics {
+		metricsCopy[k] = v
+	}
+	suspectCopy := append([]string{}, suspect...)
+	anomalousCopy := append([]string{}, anomalous...)
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.version++
+	rs.readings[probeID] = Reading{
+		ProbeID:   probeID,
+		Metrics:   metricsCopy,
+		Suspect:   suspectCopy,
+		Anomalous: anomalousCopy,
+		Timestamp: timestamp,
+	}
+}
+
+// GetReading returns the latest reading for a probe
+func (rs *ReadingStore) GetReading(probeID string) (Reading, bool) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	reading, ok := rs.readings[strings.TrimSpace(probeID)]
+	if !ok {
+		return Reading{}, false
+	}
+
+	// Return a copy
+	metricsCopy := make(map[string]float64, len(reading.Metrics))
+	for k, v := range reading.Metrics {
+		metricsCopy[k] = v
+	}
+	reading.Metrics = metricsCopy
+	reading.Suspect = append([]string{}, reading.Suspect...)
+	reading.Anomalous = append([]string{}, reading.Anomalous...)
+	return reading, true
+}
+
+// Rename moves a probe's latest reading to a new probe ID
+func (rs *ReadingStore) Rename(oldID, newID string) {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	reading, ok := rs.readings[oldID]
+	if !ok {
+		return
+	}
+	delete(rs.readings, oldID)
+	reading.ProbeID = newID
+	rs.readings[newID] = reading
+	rs.version++
+}
+
+// AllReadings returns the latest reading for every probe, keyed by probe ID
+func (rs *ReadingStore) AllReadings() map[string]Reading {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	result := make(map[string]Reading, len(rs.readings))
+	for probeID, reading := range rs.readings {
+		result[probeID] = reading
+	}
+	return result
+}
+
+// Version returns a counter that changes whenever the readings do
+func (rs *ReadingStore) Version() uint64 {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.version
+}
+
+// ParsedProbeData is the result of parsing a probe data message
+type ParsedProbeData struct {
+	ProbeID  string
+	Metrics  map[string]float64
+	Warnings []string // Tokens that could not be parsed as key=number
+	Suspect  []string // Metrics outside their plausible range, sorted
+}
+
+// defaultMaxProbeIDLength is the longest probe ID ParseMetrics accepts, matching MAX_PROBE_ID_LENGTH's default
+const defaultMaxProbeIDLength = 8
+
+// ParseMetrics parses a probe data message into its probe ID and metric values
+// Format: "F16R co2=454,temp=25.5,hum=36.2,db=67,rssi=-57"
+// Probe IDs longer than 8 characters are rejected
+// Malformed key=value pairs are skipped; the remaining metrics are still returned
+func ParseMetrics(data string) (probeID string, metrics map[string]float64, err error) {
+	return parseMetrics(data, defaultMaxProbeIDLength)
+}
+
+// parseMetrics is ParseMetrics with a configurable probe ID limit; 0 or less means no limit
+func parseMetrics(data string, maxIDLength int) (probeID string, metrics map[string]float64, err error) {
+	parsed, err := parseProbeData(data, maxIDLength)
+	return parsed.ProbeID, parsed.Metrics, err
+}
+
+// splitProbeID splits a probe data message into its probe ID token and the data after it
+// The probe ID runs up to the first whitespace
+func splitProbeID(data string, maxIDLength int) (probeID, rest string, err error) {
+	end := strings.IndexFunc(data, unicode.IsSpace)
+	if end <= 0 {
+		return "", "", fmt.Errorf("probe ID not found in message")
+	}
+	if maxIDLength > 0 && end > maxIDLength {
+		return "", "", fmt.Errorf("probe ID longer than %d characters", maxIDLength)
+	}
+	return data[:end], data[end+1:], nil
+}
+
+// probeDataJSON is the structured probe data form sent by newer gateways
+type probeDataJSON struct {
+	ProbeID string             `json:"probeId"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// probeDataFromJSON converts a structured probe data body into the canonical text form
+// {"probeId":"F16R","metrics":{"co2":454,"temp":25.5}} -> "F16R co2=454,temp=25.5"
+// Metrics are written in name order so the stored data is deterministic
+func probeDataFromJSON(body []byte) (string, error) {
+	var payload probeDataJSON
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("invalid JSON body: %v", err)
+	}
+	probeID := strings.TrimSpace(payload.ProbeID)
+	if probeID == "" || strings.ContainsFunc(probeID, unicode.IsSpace) {
+		return "", fmt.Errorf("probeId required, without spaces")
+	}
+
+	names := make([]string, 0, len(payload.Metrics))
+	for name := range payload.Metrics {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "=,") || strings.ContainsFunc(name, unicode.IsSpace) {
+			return "", fmt.Errorf("invalid metric name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.FormatFloat(payload.Metrics[name], 'f', -1, 64)
+	}
+	return probeID + " " + strings.Join(pairs, ","), nil
+}
+
+// splitProbeTimestamp removes a leading ts token from a probe data message
+// e.g. "F16R ts=1763076021,co2=454" -> "F16R co2=454"
+// The value may be RFC3339 or a Unix epoch in seconds (milliseconds if above 1e11)
+// found reports whether a ts token was present; err is set if its value didn't parse,
+// in which case the token is still removed so it isn't stored as a metric
+func splitProbeTimestamp(data string, maxIDLength int) (stripped string, ts time.Time, found bool, err error) {
+	probeID, rest, splitErr := splitProbeID(data, maxIDLength)
+	if splitErr != nil {
+		return data, time.Time{}, false, nil
+	}
+	token, remaining, _ := strings.Cut(strings.TrimLeftFunc(rest, unicode.IsSpace), ",")
+	key, value, ok := strings.Cut(token, "=")
+	if !ok || strings.ToLower(strings.TrimSpace(key)) != "ts" {
+		return data, time.Time{}, false, nil
+	}
+	stripped = probeID + " " + strings.TrimLeftFunc(remaining, unicode.IsSpace)
+
+	value = strings.TrimSpace(value)
+	if parsed, parseErr := time.Parse(time.RFC3339Nano, value); parseErr == nil {
+		return stripped, parsed, true, nil
+	}
+	epoch, parseErr := strconv.ParseFloat(value, 64)
+	// ParseFloat accepts "NaN" and "Inf", which would overflow the conversion to time below
+	if parseErr != nil || math.IsNaN(epoch) || math.IsInf(epoch, 0) || epoch <= 0 {
+		return stripped, time.Time{}, true, fmt.Errorf("invalid ts %q", value)
+	}
+	if epoch > 1e11 {
+		return stripped, time.UnixMilli(int64(epoch)), true, nil
+	}
+	sec, frac := math.Modf(epoch)
+	return stripped, time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// parseProbeData is ParseMetrics that also reports the tokens it skipped
+func parseProbeData(data string, maxIDLength int) (ParsedProbeData, error) {
+	parsed := ParsedProbeData{
+		Metrics:  make(map[string]float64),
+		Warnings: []string{},
+		Suspect:  []string{},
+	}
+
+	// Probe ID, followed by whitespace, then data
+	probeID, rest, err := splitProbeID(data, maxIDLength)
+	if err != nil {
+		return parsed, err
+	}
+	parsed.ProbeID = probeID
+
+	for _, token := range strings.Split(rest, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		key, value, found := strings.Cut(token, "=")
+		if !found {
+			parsed.Warnings = append(parsed.Warnings, fmt.Sprintf("%q is not a key=value pair", token))
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			parsed.Warnings = append(parsed.Warnings, fmt.Sprintf("%q has an empty metric name", token))
+			continue
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			parsed.Warnings = append(parsed.Warnings, fmt.Sprintf("%q has a non-numeric value", token))
+			continue
+		}
+		// ParseFloat accepts "NaN" and "Inf", but JSON can't encode them, so storing one
+		// would break every endpoint that returns the reading
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			parsed.Warnings = append(parsed.Warnings, fmt.Sprintf("%q has a non-finite value", token))
+			continue
+		}
+		parsed.Metrics[key] = number
+	}
+
+	// Flag implausible values so sensor faults stand out; they are still stored
+	for key, number := range parsed.Metrics {
+		if metricSuspect(key, number) {
+			parsed.Suspect = append(parsed.Suspect, key)
+		}
+	}
+	sort.Strings(parsed.Suspect)
+
+	return parsed, nil
+}
+
+// validateProbeData checks that a probe data message is a probe ID followed by
+// comma-separated name=number pairs, returning an error naming the first offending token
+func validateProbeData(data string, maxIDLength int) error {
+	parsed, err := parseProbeData(data, maxIDLength)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Warnings) > 0 {
+		return fmt.Errorf("invalid probe data: %s", parsed.Warnings[0])
+	}
+	if len(parsed.Metrics) == 0 {
+		return fmt.Errorf("invalid probe data: no metrics after probe ID")
+	}
+	return nil
+}
+
+// LastSeenStore tracks when each probe last reported
+type LastSeenStore struct {
+	mu       sync.RWMutex
+	lastSeen map[string]time.Time // probeID -> last report time
+}
+
+// NewLastSeenStore creates a new last-seen store
+func NewLastSeenStore() *LastSeenStore {
+	return &LastSeenStore{
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// Touch records that a probe reported at the given time
+func (ls *LastSeenStore) Touch(probeID string, t time.Time) {
+	probeID = strings.TrimSpace(probeID)
+	if probeID == "" {
+		return
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.lastSeen[probeID] = t
+}
+
+// LastSeen returns when a probe last reported
+func (ls *LastSeenStore) LastSeen(probeID string) (time.Time, bool) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	t, ok := ls.lastSeen[strings.TrimSpace(probeID)]
+	return t, ok
+}
+
+// Rename moves a probe's last-seen time to a new probe ID
+func (ls *LastSeenStore) Rename(oldID, newID string) {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	t, ok := ls.lastSeen[oldID]
+	if !ok {
+		return
+	}
+	delete(ls.lastSeen, oldID)
+	ls.lastSeen[newID] = t
+}
+
+// ProbeStatus describes how recently a probe reported
+type ProbeStatus struct {
+	ProbeID    string    `json:"probeID"`
+	LastSeen   time.Time `json:"lastSeen"`
+	SecondsAgo int64     `json:"secondsAgo"`
+	Stale      bool      `json:"stale"`
+	Battery    *float64  `json:"battery,omitempty"` // Latest bat= level; only filled in by the status endpoint
+	LowBattery bool      `json:"lowBattery"`
+}
+
+// Statuses returns the status of every probe, sorted by probe ID
+// A probe is stale if it hasn't reported within staleAfter of now
+func (ls *LastSeenStore) Statuses(now time.Time, staleAfter time.Duration) []ProbeStatus {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	result := make([]ProbeStatus, 0, len(ls.lastSeen))
+	for probeID, lastSeen := range ls.lastSeen {
+		ago := now.Sub(lastSeen)
+		result = append(result, ProbeStatus{
+			ProbeID:    probeID,
+			LastSeen:   lastSeen,
+			SecondsAgo: int64(ago.Seconds()),
+			Stale:      ago > staleAfter,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ProbeID < result[j].ProbeID
+	})
+	return result
+}
+
+// Point is a single timestamped metric value
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Anomalous bool      `json:"anomalous,omitempty"` // The value was far outside the metric's recent history
+	ZScore    float64   `json:"zScore,omitempty"`    // Set on anomalous points
+}
+
+// pointRing is a ring buffer of up to max points, oldest evicted first
+// It grows as points arrive, so a metric reported once doesn't hold a full ring
+type pointRing struct {
+	points []Point
+	max    int
+	next   int // Index the next point is written to
+	count  int
+}
+
+func (pr *pointRing) append(p Point) {
+	if len(pr.points) < pr.max {
+		// Still growing, so the points are in order and next is the end
+		pr.points = append(pr.points, p)
+		pr.next = len(pr.points) % pr.max
+		pr.count++
+		return
+	}
+	pr.points[pr.next] = p
+	pr.next = (pr.next + 1) % len(pr.points)
+}
+
+// last returns up to limit of the most recent points in chronological order
+func (pr *pointRing) last(limit int) []Point {
+	if limit <= 0 || limit > pr.count {
+		limit = pr.count
+	}
+	result := make([]Point, limit)
+	start := pr.next - limit
+	if start < 0 {
+		start += len(pr.points)
+	}
+	for i := 0; i < limit; i++ {
+		result[i] = pr.points[(start+i)%len(pr.points)]
+	}
+	return result
+}
+
+// HistoryStore keeps a bounded history of values per probe and metric
+type HistoryStore struct {
+	mu         sync.RWMutex
+	maxSize    int
+	maxMetrics int                              // Most distinct metrics kept per probe
+	series     map[string]map[string]*pointRing // probeID -> metric -> points
+	detector   anomalyDetector
+}
+
+// NewHistoryStore creates a history store keeping up to maxSize points for each of up to
+// maxMetrics metrics per probe, flagging appended values the detector finds anomalous
+func NewHistoryStore(maxSize, maxMetrics int, detector anomalyDetector) *HistoryStore {
+	return &HistoryStore{
+		maxSize:    maxSize,
+		maxMetrics: maxMetrics,
+		series:     make(map[string]map[string]*pointRing),
+		detector:   detector,
+	}
+}
+
+// Append records a metric value for a probe, evicting the oldest point once full
+// It returns the stored point, flagged if the value is anomalous against the points before it
+// ok is false if the probe already has maxMetrics other metrics, in which case nothing is stored
+func (hs *HistoryStore) Append(probeID, metric string, t time.Time, v float64) (point Point, ok bool) {
+	probeID = strings.TrimSpace(probeID)
+	metric = strings.ToLower(strings.TrimSpace(metric))
+	point = Point{Timestamp: t, Value: v}
+	if probeID == "" || metric == "" {
+		return point, true
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.series[probeID] == nil {
+		hs.series[probeID] = make(map[string]*pointRing)
+	}
+	ring := hs.series[probeID][metric]
+	if ring == nil {
+		if len(hs.series[probeID]) >= hs.maxMetrics {
+			return point, false
+		}
+		ring = &pointRing{max: hs.maxSize}
+		hs.series[probeID][metric] = ring
+	}
+	if z, anomalous := hs.detector.score(ring.last(hs.detector.window), v); anomalous {
+		point.Anomalous, point.ZScore = true, z
+	}
+	ring.append(point)
+	return point, true
+}
+
+// Rename moves all of a probe's history to a new probe ID
+func (hs *HistoryStore) Rename(oldID, newID string) {
+	oldID, newID = strings.TrimSpace(oldID), strings.TrimSpace(newID)
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	series, ok := hs.series[oldID]
+	if !ok {
+		return
+	}
+	delete(hs.series, oldID)
+	hs.series[newID] = series
+}
+
+// Metrics returns the metrics with recorded history for a probe, sorted
+func (hs *HistoryStore) Metrics(probeID string) []string {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	series := hs.series[strings.TrimSpace(probeID)]
+	metrics := make([]string, 0, len(series))
+	for metric := range series {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+// Series returns up to limit of the most recent points for a probe metric in chronological order
+// A limit of 0 or less returns the full history
+func (hs *HistoryStore) Series(probeID, metric string, limit int) []Point {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	ring := hs.series[strings.TrimSpace(probeID)][strings.ToLower(strings.TrimSpace(metric))]
+	if ring == nil {
+		return []Point{}
+	}
+	return ring.last(limit)
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestSplitProbeID(t *testing.T) {
+	tests := []struct {
+		data      string
+		maxLength int
+		wantID    string
+		wantErr   bool
+	}{
+		{"F16R co2=454", 8, "F16R", false},
+		{"F16RA co2=454", 8, "F16RA", false},
+		{"F16RAB co2=454", 8, "F16RAB", false},
+		{"F16RAB co2=454", 5, "", true},
+		{"F16RABCDE co2=454", 0, "F16RABCDE", false},
+		{" co2=454", 8, "", true},
+		{"F16R", 8, "", true},
+	}
+	for _, tt := range tests {
+		probeID, _, err := splitProbeID(tt.data, tt.maxLength)
+		if (err != nil) != tt.wantErr || probeID != tt.wantID {
+			t.Errorf("splitProbeID(%q, %d) = %q, %v; want %q, error %v", tt.data, tt.maxLength, probeID, err, tt.wantID, tt.wantErr)
+		}
+	}
+}
+
+func TestParseMetricsDefaultLimit(t *testing.T) {
+	if probeID, metrics, err := ParseMetrics("F16RAB co2=454"); err != nil || probeID != "F16RAB" || metrics["co2"] != 454 {
+		t.Errorf("ParseMetrics = %q, %v, %v; want F16RAB with co2=454", probeID, metrics, err)
+	}
+	if _, _, err := ParseMetrics("F16RABCDE co2=454"); err == nil {
+		t.Error("ParseMetrics accepted a 9 character probe ID")
+	}
+}
+
+func TestParseProbeDataRejectsNonFinite(t *testing.T) {
+	parsed, err := parseProbeData("F16R co2=NaN,temp=+Inf,hum=-inf,db=67", 8)
+	if err != nil {
+		t.Fatalf("parseProbeData: %v", err)
+	}
+	if len(parsed.Metrics) != 1 || parsed.Metrics["db"] != 67 {
+		t.Errorf("metrics = %v, want only db=67", parsed.Metrics)
+	}
+	if len(parsed.Warnings) != 3 {
+		t.Errorf("warnings = %v, want one per non-finite value", parsed.Warnings)
+	}
+}
+
+func TestSplitProbeTimestampRejectsNonFinite(t *testing.T) {
+	for _, value := range []string{"NaN", "Inf", "+Inf"} {
+		stripped, _, found, err := splitProbeTimestamp("F16R ts="+value+",co2=454", 8)
+		if !found || err == nil {
+			t.Errorf("ts=%s: found=%v err=%v, want found with an error", value, found, err)
+		}
+		if stripped != "F16R co2=454" {
+			t.Errorf("ts=%s: stripped = %q, want the token removed", value, stripped)
+		}
+	}
+}
+
+func TestHistoryStoreGrowsRings(t *testing.T) {
+	hs := NewHistoryStore(3, 10, anomalyDetector{})
+	now := time.Now()
+
+	// A metric reported once holds one point, not a full ring
+	hs.Append("F16R", "co2", now, 1)
+	if ring := hs.series["F16R"]["co2"]; len(ring.points) != 1 {
+		t.Errorf("ring holds %d points after one append, want 1", len(ring.points))
+	}
+
+	for i := 2; i <= 5; i++ {
+		hs.Append("F16R", "co2", now.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	series := hs.Series("F16R", "co2", 0)
+	if len(series) != 3 || series[0].Value != 3 || series[1].Value != 4 || series[2].Value != 5 {
+		t.Errorf("series = %+v, want the last 3 values in order", series)
+	}
+	if last := hs.Series("F16R", "co2", 2); len(last) != 2 || last[0].Value != 4 || last[1].Value != 5 {
+		t.Errorf("Series limit 2 = %+v, want 4 and 5", last)
+	}
+}
+
+func TestHistoryStoreCapsMetricsPerProbe(t *testing.T) {
+	hs := NewHistoryStore(10, 2, anomalyDetector{})
+	now := time.Now()
+
+	for _, metric := range []string{"co2", "temp"} {
+		if _, ok := hs.Append("F16R", metric, now, 1); !ok {
+			t.Fatalf("Append(%s) refused under the limit", metric)
+		}
+	}
+	if _, ok := hs.Append("F16R", "hum", now, 1); ok {
+		t.Error("Append accepted a third metric over the limit of 2")
+	}
+	// Known metrics and other probes are unaffected
+	if _, ok := hs.Append("F16R", "CO2", now, 2); !ok {
+		t.Error("Append refused a metric the probe already has")
+	}
+	if _, ok := hs.Append("F17R", "hum", now, 1); !ok {
+		t.Error("Append refused another probe's first metric")
+	}
+	if metrics := hs.Metrics("F16R"); len(metrics) != 2 {
+		t.Errorf("Metrics = %v, want co2 and temp", metrics)
+	}
+}
+
+func TestIngestSkipsMetricsOverLimit(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.HistoryMaxMetrics = 2
+	})
+
+	rec := serve(rt, "POST", "/api/probedata", "F16R m2=2,m0=0,m1=1", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var resp struct {
+		Metrics  map[string]float64 `json:"metrics"`
+		Warnings []string           `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// The first names in order are kept
+	if len(resp.Metrics) != 2 || resp.Metrics["m0"] != 0 || resp.Metrics["m1"] != 1 {
+		t.Errorf("metrics = %v, want m0 and m1", resp.Metrics)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "1 metrics skipped") {
+		t.Errorf("warnings = %v, want one naming the skipped count", resp.Warnings)
+	}
+	if reading, _ := rt.r.readingStore.GetReading("F16R"); len(reading.Metrics) != 2 {
+		t.Errorf("reading metrics = %v, want only the kept ones", reading.Metrics)
+	}
+}
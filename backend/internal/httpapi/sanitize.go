@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sanitizeProbeData cleans up a probe data line before it is checked and stored
+// Control characters (NULs, DEL, escape codes) are removed, every run of whitespace, including
+// CR and LF, becomes a single space, and the ends are trimmed; invalid UTF-8 becomes U+FFFD
+// With aggressive set, every other non-printable rune (zero-width and other format characters,
+// private-use and unassigned code points, invalid UTF-8) is dropped as well
+func sanitizeProbeData(data string, aggressive bool) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	pendingSpace := false
+	for i, c := range data {
+		switch {
+		case c == utf8.RuneError && !strings.HasPrefix(data[i:], "\uFFFD"):
+			// An invalid byte rather than a literal U+FFFD
+			if aggressive {
+				continue
+			}
+		case unicode.IsSpace(c):
+			pendingSpace = true
+			continue
+		case unicode.IsControl(c):
+			continue
+		case aggressive && !unicode.IsPrint(c):
+			continue
+		}
+		if pendingSpace && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// truncateUTF8 cuts s to at most maxBytes without splitting a UTF-8 sequence,
+// reporting whether anything was cut; a maxBytes of 0 or less leaves s alone
+func truncateUTF8(s string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s, false
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
+
+// sanitizeProbeLine applies sanitizeProbeData with the configured strictness, returning the
+// cleaned line and, when KEEP_RAW_PROBE_DATA is on and cleaning changed it, the original
+func (r *router) sanitizeProbeLine(data string) (clean, raw string) {
+	clean = sanitizeProbeData(data, r.cfg.StripNonPrintable)
+	if r.cfg.KeepRawProbeData && clean != data {
+		raw = data
+	}
+	return clean, raw
+}
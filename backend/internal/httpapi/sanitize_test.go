@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestSanitizeProbeData(t *testing.T) {
+	tests := []struct {
+		data       string
+		aggressive bool
+		want       string
+	}{
+		{"F16R co2=454\x00\x00\x00", false, "F16R co2=454"},
+		{"F16R co2=4\x0054,temp=25", false, "F16R co2=454,temp=25"},
+		{"F16R\tco2=454,\r\ntemp=25\r\n", false, "F16R co2=454, temp=25"},
+		{"  F16R   co2=454  ", false, "F16R co2=454"},
+		{"F16R co2=454\x1b[0m", false, "F16R co2=454[0m"},
+		{"F16R co2=\u200b454", false, "F16R co2=\u200b454"},
+		{"F16R co2=\u200b454", true, "F16R co2=454"},
+		{"F16R co2=454\xff", false, "F16R co2=454\uFFFD"},
+		{"F16R co2=454\xff", true, "F16R co2=454"},
+		{"F16R loc=café", true, "F16R loc=café"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeProbeData(tt.data, tt.aggressive); got != tt.want {
+			t.Errorf("sanitizeProbeData(%q, %v) = %q, want %q", tt.data, tt.aggressive, got, tt.want)
+		}
+	}
+}
+
+func TestProbeDataSanitizedBeforeStoring(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.KeepRawProbeData = true
+	})
+
+	// A stray CR mid-line and trailing NULs and CRLF, as some serial gateways send
+	rec := serve(rt, "POST", "/api/probedata", "F16R co2=454,\rtemp=25.5\x00\x00\r\n", nil)
+	expectStatus(t, rec, 200)
+	var got struct {
+		Metrics  map[string]float64 `json:"metrics"`
+		Warnings []string           `json:"warnings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got.Metrics) != 2 || got.Metrics["temp"] != 25.5 || len(got.Warnings) != 0 {
+		t.Errorf("parsed %v with warnings %v, want co2 and temp cleanly", got.Metrics, got.Warnings)
+	}
+
+	// A clean payload keeps no raw copy
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F15R co2=500", nil), 200)
+
+	msgs := rt.r.messageStore.GetMessages()
+	if len(msgs) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(msgs))
+	}
+	if msgs[0].Data != "F16R co2=454, temp=25.5" || msgs[0].Raw != "F16R co2=454,\rtemp=25.5\x00\x00\r\n" {
+		t.Errorf("message = %q (raw %q), want the sanitized data with the original kept", msgs[0].Data, msgs[0].Raw)
+	}
+	if msgs[1].Raw != "" {
+		t.Errorf("clean message kept raw %q", msgs[1].Raw)
+	}
+}
+
+func TestProbeDataLinesSanitized(t *testing.T) {
+	rt := newTestRouter(t, nil)
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454\x00\r\nF15R\x00 co2=500\r\n", nil), 200)
+	msgs := rt.r.messageStore.GetMessages()
+	if len(msgs) != 2 || msgs[0].Data != "F16R co2=454" || msgs[1].Data != "F15R co2=500" {
+		t.Fatalf("stored %+v, want both lines without the NULs", msgs)
+	}
+	// Raw copies are only kept with KEEP_RAW_PROBE_DATA
+	if msgs[0].Raw != "" || msgs[1].Raw != "" {
+		t.Errorf("raw kept without KEEP_RAW_PROBE_DATA: %q, %q", msgs[0].Raw, msgs[1].Raw)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s        string
+		maxBytes int
+		want     string
+		wantCut  bool
+	}{
+		{"F16R co2=454", 20, "F16R co2=454", false},
+		{"F16R co2=454", 12, "F16R co2=454", false},
+		{"F16R co2=454", 8, "F16R co2", true},
+		{"F16R é", 6, "F16R ", true}, // Doesn't split the two-byte é
+		{"F16R co2=454", 0, "F16R co2=454", false},
+	}
+	for _, tt := range tests {
+		got, cut := truncateUTF8(tt.s, tt.maxBytes)
+		if got != tt.want || cut != tt.wantCut {
+			t.Errorf("truncateUTF8(%q, %d) = %q, %v; want %q, %v", tt.s, tt.maxBytes, got, cut, tt.want, tt.wantCut)
+		}
+	}
+}
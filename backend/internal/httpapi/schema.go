@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaTypes are the response types described by GET /api/schema, each becoming a definition
+// Struct types they reference are added too, so every $ref resolves
+var schemaTypes = []struct {
+	value       any
+	description string
+}{
+	{ProbeMessage{}, "A stored probe data message"},
+	{AreaLocation{}, "A location in an area and the probe assigned to it"},
+	{AreaStat{}, "Display ranges for every metric in an area"},
+	{MetricThreshold{}, "The six ascending threshold values for one metric in an area"},
+	{PixelCount{}, "The pixel count shown for an area"},
+	{Reading{}, "The latest metrics reported by a probe"},
+	{Point{}, "One point of a probe metric's history"},
+	{ProbeStatus{}, "When a probe last reported and whether it is stale"},
+	{ThresholdEvaluation{}, "The current band of one probe metric against its area's thresholds"},
+	{ThresholdAlert{}, "Sent in alert WebSocket frames when a reading enters a breach band"},
+	{MessageRepeat{}, "Sent in repeat WebSocket frames when a message is counted as a repeat of a stored one"},
+	{ProbeStatusEvent{}, "Sent in probe_status WebSocket frames when a probe goes stale or reports again"},
+	{BatteryAlert{}, "Sent in low_battery WebSocket frames when a probe's battery drops below the threshold"},
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schemaBuilder collects JSON Schema definitions for Go types, following their json tags
+type schemaBuilder struct {
+	defs map[string]map[string]any
+}
+
+// apiSchema builds the schema document once; the types can't change while the server runs
+var apiSchema = sync.OnceValue(func() map[string]any {
+	b := &schemaBuilder{defs: make(map[string]map[string]any)}
+	for _, st := range schemaTypes {
+		t := reflect.TypeOf(st.value)
+		b.schemaFor(t)
+		b.defs[t.Name()]["description"] = st.description
+	}
+	return map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$defs":   b.defs,
+	}
+})
+
+// schemaFor returns the schema for a type, adding a definition for a named struct and referencing it
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.defs[t.Name()]; !ok {
+			// Registered before walking the fields so a self-referencing type terminates
+			b.defs[t.Name()] = map[string]any{}
+			for k, v := range b.structSchema(t) {
+				b.defs[t.Name()][k] = v
+			}
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	// Interfaces and anything else can hold any value
+	return map[string]any{}
+}
+
+// structSchema describes a struct's exported fields the way encoding/json writes them
+// Fields tagged omitempty or omitzero may be left out, so they aren't required
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+		flags := strings.Split(options, ",")
+		if !slices.Contains(flags, "omitempty") && !slices.Contains(flags, "omitzero") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// handleSchema returns JSON Schema definitions for the API's response types,
+// generated from the Go types so they can't drift from what the server sends
+func (r *router) handleSchema(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiSchema())
+}
@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fetchSchemaDefs returns the $defs of GET /api/schema
+func fetchSchemaDefs(t *testing.T) map[string]map[string]any {
+	t.Helper()
+	rec := serve(newTestRouter(t, nil), "GET", "/api/schema", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var doc struct {
+		Defs map[string]map[string]any `json:"$defs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return doc.Defs
+}
+
+func TestSchemaDescribesResponseTypes(t *testing.T) {
+	defs := fetchSchemaDefs(t)
+
+	for _, name := range []string{"ProbeMessage", "AreaStat", "MetricStat", "MetricThreshold", "PixelCount", "Reading", "Point"} {
+		if _, ok := defs[name]; !ok {
+			t.Errorf("schema has no %s definition", name)
+		}
+	}
+
+	property := func(def, name string) map[string]any {
+		props, _ := defs[def]["properties"].(map[string]any)
+		prop, _ := props[name].(map[string]any)
+		if prop == nil {
+			t.Fatalf("%s has no %s property", def, name)
+		}
+		return prop
+	}
+	if prop := property("ProbeMessage", "timestamp"); prop["type"] != "string" || prop["format"] != "date-time" {
+		t.Errorf("ProbeMessage.timestamp = %v, want a date-time string", prop)
+	}
+	if prop := property("ProbeMessage", "seq"); prop["type"] != "integer" {
+		t.Errorf("ProbeMessage.seq = %v, want an integer", prop)
+	}
+	if items, _ := property("AreaStat", "metrics")["items"].(map[string]any); items["$ref"] != "#/$defs/MetricStat" {
+		t.Errorf("AreaStat.metrics items = %v, want a MetricStat reference", items)
+	}
+	if values, _ := property("Reading", "metrics")["additionalProperties"].(map[string]any); values["type"] != "number" {
+		t.Errorf("Reading.metrics values = %v, want numbers", values)
+	}
+	if items, _ := property("MetricThreshold", "values")["items"].(map[string]any); items["type"] != "number" {
+		t.Errorf("MetricThreshold.values items = %v, want numbers", items)
+	}
+
+	required, _ := defs["ProbeMessage"]["required"].([]any)
+	for _, name := range []string{"id", "seq", "data", "timestamp"} {
+		if !slices.Contains(required, any(name)) {
+			t.Errorf("ProbeMessage.%s isn't required", name)
+		}
+	}
+	for _, name := range []string{"raw", "repeats", "lastRepeatAt", "truncated"} {
+		if slices.Contains(required, any(name)) {
+			t.Errorf("omitted-when-empty ProbeMessage.%s is required", name)
+		}
+	}
+
+	expectStatus(t, serve(newTestRouter(t, nil), "POST", "/api/schema", "{}", nil), http.StatusMethodNotAllowed)
+}
+
+func TestSchemaRefsResolve(t *testing.T) {
+	defs := fetchSchemaDefs(t)
+
+	var walk func(path string, node any)
+	walk = func(path string, node any) {
+		switch n := node.(type) {
+		case map[string]any:
+			if ref, ok := n["$ref"].(string); ok {
+				if _, found := defs[strings.TrimPrefix(ref, "#/$defs/")]; !found || !strings.HasPrefix(ref, "#/$defs/") {
+					t.Errorf("%s: unresolved $ref %q", path, ref)
+				}
+			}
+			for key, child := range n {
+				walk(path+"."+key, child)
+			}
+		case []any:
+			for _, child := range n {
+				walk(path, child)
+			}
+		}
+	}
+	for name, def := range defs {
+		walk(name, def)
+	}
+}
+
+// The schema must list exactly the fields encoding/json writes, so a renamed or added field can't drift
+func TestSchemaMatchesEncodedFields(t *testing.T) {
+	defs := fetchSchemaDefs(t)
+
+	for _, st := range schemaTypes {
+		name := reflect.TypeOf(st.value).Name()
+		encoded, err := json.Marshal(st.value)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", name, err)
+		}
+		var keys map[string]any
+		if err := json.Unmarshal(encoded, &keys); err != nil {
+			t.Fatalf("unmarshal %s: %v", name, err)
+		}
+
+		props, _ := defs[name]["properties"].(map[string]any)
+		required, _ := defs[name]["required"].([]any)
+		for key := range keys {
+			if _, ok := props[key]; !ok {
+				t.Errorf("%s encodes %q, which the schema doesn't describe", name, key)
+			}
+		}
+		// A zero value leaves out exactly the optional fields
+		for _, key := range required {
+			if _, ok := keys[key.(string)]; !ok {
+				t.Errorf("%s.%s is required but left out of the zero value", name, key)
+			}
+		}
+		if len(required) != len(keys) {
+			t.Errorf("%s requires %d fields, but the zero value encodes %d", name, len(required), len(keys))
+		}
+	}
+}
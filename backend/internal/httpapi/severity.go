@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// bandOrder lists the threshold bands from lowest to highest value
+var bandOrder = []string{BandCritLow, BandWarnLow, BandNormal, BandWarnHigh, BandCritHigh}
+
+// bandStyle is how a UI should present a threshold band
+type bandStyle struct {
+	Band  string `json:"band"`
+	Label string `json:"label"`
+	Color string `json:"color"` // CSS color, e.g. "#d62728"
+	Level int    `json:"level"` // 0 for normal, 1 for warnings, 2 for critical
+}
+
+// defaultBandStyles are used for any band the severity map file doesn't override
+var defaultBandStyles = map[string]bandStyle{
+	BandCritLow:  {Band: BandCritLow, Label: "Critical low", Color: "#d62728", Level: 2},
+	BandWarnLow:  {Band: BandWarnLow, Label: "Warning low", Color: "#ff7f0e", Level: 1},
+	BandNormal:   {Band: BandNormal, Label: "Normal", Color: "#2ca02c", Level: 0},
+	BandWarnHigh: {Band: BandWarnHigh, Label: "Warning high", Color: "#ff7f0e", Level: 1},
+	BandCritHigh: {Band: BandCritHigh, Label: "Critical high", Color: "#d62728", Level: 2},
+}
+
+// loadSeverityMap reads band labels and colors from a JSON file keyed by band name,
+// e.g. {"crit-high": {"label": "Too hot", "color": "red"}}, over the defaults
+// Unknown bands are skipped, and a label or color left out keeps its default; levels are fixed
+func loadSeverityMap(path string) map[string]bandStyle {
+	styles := make(map[string]bandStyle, len(defaultBandStyles))
+	for band, style := range defaultBandStyles {
+		styles[band] = style
+	}
+	if path == "" {
+		return styles
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("severity map: %s not found, using the default colors", path)
+		return styles
+	}
+	if err != nil {
+		log.Printf("severity map: read %s: %v", path, err)
+		return styles
+	}
+
+	var fromFile map[string]struct {
+		Label string `json:"label"`
+		Color string `json:"color"`
+	}
+	if err := json.Unmarshal(data, &fromFile); err != nil {
+		log.Printf("severity map: parse %s: %v", path, err)
+		return styles
+	}
+	for band, override := range fromFile {
+		band = strings.ToLower(strings.TrimSpace(band))
+		style, ok := styles[band]
+		if !ok {
+			log.Printf("severity map: skipping unknown band %q", band)
+			continue
+		}
+		if label := strings.TrimSpace(override.Label); label != "" {
+			style.Label = label
+		}
+		if color := strings.TrimSpace(override.Color); color != "" {
+			style.Color = color
+		}
+		styles[band] = style
+	}
+	return styles
+}
+
+// handleSeverityMap returns the label and color of every threshold band, lowest band first
+// The band names match those in evaluations, alerts, and breach counts
+func (r *router) handleSeverityMap(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bands := make([]bandStyle, 0, len(bandOrder))
+	for _, band := range bandOrder {
+		bands = append(bands, r.severityMap[band])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"bands": bands,
+	})
+}
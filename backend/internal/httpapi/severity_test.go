@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestSeverityMapDefaults(t *testing.T) {
+	rt := newTestRouter(t, nil)
+
+	rec := serve(rt, "GET", "/api/thresholds/severity-map", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Bands []bandStyle `json:"bands"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Bands) != len(bandOrder) {
+		t.Fatalf("got %d bands, want %d", len(body.Bands), len(bandOrder))
+	}
+	for i, band := range bandOrder {
+		if body.Bands[i] != defaultBandStyles[band] {
+			t.Errorf("band %d = %+v, want %+v", i, body.Bands[i], defaultBandStyles[band])
+		}
+	}
+
+	expectStatus(t, serve(rt, "POST", "/api/thresholds/severity-map", "{}", nil), http.StatusMethodNotAllowed)
+}
+
+func TestSeverityMapFileOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "severity.json")
+	file := `{
+		"crit-high": {"label": "Too high", "color": "#800000"},
+		"Warn-Low": {"color": "yellow"},
+		"extreme": {"label": "Off the scale", "color": "black"}
+	}`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	styles := loadSeverityMap(path)
+	if len(styles) != len(defaultBandStyles) {
+		t.Errorf("loaded %d bands, want %d (the unknown one skipped)", len(styles), len(defaultBandStyles))
+	}
+	if got := styles[BandCritHigh]; got.Label != "Too high" || got.Color != "#800000" || got.Level != 2 {
+		t.Errorf("crit-high = %+v, want the file's label and color at level 2", got)
+	}
+	if got := styles[BandWarnLow]; got.Label != defaultBandStyles[BandWarnLow].Label || got.Color != "yellow" {
+		t.Errorf("warn-low = %+v, want the default label with the file's color", got)
+	}
+	if got := styles[BandNormal]; got != defaultBandStyles[BandNormal] {
+		t.Errorf("normal = %+v, want the default", got)
+	}
+}
+
+func TestSeverityMapFallsBackToDefaults(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"", filepath.Join(dir, "missing.json"), invalid} {
+		styles := loadSeverityMap(path)
+		for band, want := range defaultBandStyles {
+			if styles[band] != want {
+				t.Errorf("loadSeverityMap(%q)[%s] = %+v, want %+v", path, band, styles[band], want)
+			}
+		}
+	}
+}
+
+func TestThresholdEvaluateIncludesBandColor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "severity.json")
+	if err := os.WriteFile(path, []byte(`{"crit-high": {"label": "Too high", "color": "#800000"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.SeverityMapPath = path
+	})
+
+	expectStatus(t, serve(rt, "POST", "/api/thresholds/FLOOR16",
+		`{"thresholds":[{"metric":"co2","values":[300,350,400,800,1000,1200]}]}`, nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=1250", nil), http.StatusOK)
+
+	rec := serve(rt, "GET", "/api/thresholds/FLOOR16/evaluate", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var evaluations []ThresholdEvaluation
+	if err := json.Unmarshal(rec.Body.Bytes(), &evaluations); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(evaluations) != 1 {
+		t.Fatalf("got %d evaluations, want 1: %+v", len(evaluations), evaluations)
+	}
+	if got := evaluations[0]; got.Band != BandCritHigh || got.Label != "Too high" || got.Color != "#800000" {
+		t.Errorf("evaluation = %+v, want crit-high labelled from the severity map", got)
+	}
+}
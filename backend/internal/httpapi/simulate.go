@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// minSimulateInterval keeps a simulated probe from flooding the message store
+const minSimulateInterval = 10 * time.Millisecond
+
+// SimulationRequest describes a synthetic probe feeding randomized readings
+type SimulationRequest struct {
+	ProbeID    string  `json:"probeId"`
+	Metric     string  `json:"metric"`
+	Count      int     `json:"count"`      // Readings to send; 0 runs until stopped
+	IntervalMs int     `json:"intervalMs"` // Delay between readings, default 1000
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+}
+
+// simulation is a running simulated probe
+type simulation struct {
+	SimulationRequest
+	Sent    int64     `json:"sent"`
+	Started time.Time `json:"started"`
+	stop    chan struct{}
+}
+
+// simulator runs simulated probes, at most one per probe ID
+type simulator struct {
+	mu   sync.Mutex
+	runs map[string]*simulation // probe ID -> running simulation
+}
+
+func newSimulator() *simulator {
+	return &simulator{
+		runs: make(map[string]*simulation),
+	}
+}
+
+// start launches a simulation, returning false if one is already running for the probe
+func (s *simulator) start(req SimulationRequest, ingest func(data string), done <-chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, running := s.runs[req.ProbeID]; running {
+		return false
+	}
+	run := &simulation{SimulationRequest: req, Started: time.Now(), stop: make(chan struct{})}
+	s.runs[req.ProbeID] = run
+	go s.run(run, ingest, done)
+	return true
+}
+
+// run feeds readings until the count is reached, the simulation is stopped, or the server shuts down
+func (s *simulator) run(run *simulation, ingest func(data string), done <-chan struct{}) {
+	defer func() {
+		s.mu.Lock()
+		if s.runs[run.ProbeID] == run {
+			delete(s.runs, run.ProbeID)
+		}
+		s.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(time.Duration(run.IntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for sent := 0; run.Count == 0 || sent < run.Count; sent++ {
+		value := run.Min + rand.Float64()*(run.Max-run.Min)
+		ingest(fmt.Sprintf("%s %s=%s", run.ProbeID, run.Metric, strconv.FormatFloat(value, 'f', 2, 64)))
+		s.mu.Lock()
+		run.Sent++
+		s.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-run.stop:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// stop ends the simulation for a probe, returning false if none is running
+func (s *simulator) stop(probeID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[probeID]
+	if !ok {
+		return false
+	}
+	delete(s.runs, probeID)
+	close(run.stop)
+	return true
+}
+
+// list returns the running simulations, sorted by probe ID
+func (s *simulator) list() []simulation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]simulation, 0, len(s.runs))
+	for _, run := range s.runs {
+		result = append(result, *run)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ProbeID < result[j].ProbeID
+	})
+	return result
+}
+
+func (r *router) handleSimulate(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"simulations": r.simulator.list(),
+		})
+	case "POST":
+		var body SimulationRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		body.ProbeID = strings.TrimSpace(body.ProbeID)
+		body.Metric = strings.ToLower(strings.TrimSpace(body.Metric))
+		// Readings go through the normal parser, so the probe ID and metric must survive it
+		if _, _, err := splitProbeID(body.ProbeID+" ", r.cfg.MaxProbeIDLength); err != nil || strings.ContainsFunc(body.ProbeID, unicode.IsSpace) {
+			http.Error(w, "probeId required, without spaces and within the probe ID length limit", http.StatusBadRequest)
+			return
+		}
+		if body.Metric == "" || strings.ContainsAny(body.Metric, "=,") || strings.ContainsFunc(body.Metric, unicode.IsSpace) {
+			http.Error(w, "metric required, without spaces, commas, or '='", http.StatusBadRequest)
+			return
+		}
+		if body.Count < 0 {
+			http.Error(w, "count must not be negative", http.StatusBadRequest)
+			return
+		}
+		if body.IntervalMs == 0 {
+			body.IntervalMs = 1000
+		}
+		if time.Duration(body.IntervalMs)*time.Millisecond < minSimulateInterval {
+			http.Error(w, fmt.Sprintf("intervalMs must be at least %d", minSimulateInterval.Milliseconds()), http.StatusBadRequest)
+			return
+		}
+		if body.Min > body.Max {
+			http.Error(w, "min must not be greater than max", http.StatusBadRequest)
+			return
+		}
+
+		ingest := func(data string) { r.ingestProbeData(context.Background(), data, "") }
+		if !r.simulator.start(body, ingest, r.done) {
+			http.Error(w, "simulation already running for probe", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":     "started",
+			"simulation": body,
+		})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *router) handleSimulateStop(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "DELETE" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /api/simulate/{probeId}
+	probeID := strings.TrimSpace(strings.TrimPrefix(req.URL.Path, "/api/simulate/"))
+	if probeID == "" {
+		http.Error(w, "probe ID required", http.StatusBadRequest)
+		return
+	}
+	if !r.simulator.stop(probeID) {
+		http.Error(w, "no simulation running for probe", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":  "stopped",
+		"probeId": probeID,
+	})
+}
@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Snapshot is everything a dashboard renders, in one cacheable document
+type Snapshot struct {
+	Areas    map[string][]AreaLocation `json:"areas"`
+	Readings map[string]Reading        `json:"readings"` // probe ID -> latest reading
+	Pixels   []PixelCount              `json:"pixels"`   // Sorted by area
+	Stats    []AreaStat                `json:"stats"`    // Sorted by area, metrics by name
+}
+
+// snapshotVersions identifies the store contents a snapshot was built from
+type snapshotVersions struct {
+	areas, readings, pixels, stats uint64
+}
+
+// snapshotCache holds the last encoded snapshot so unchanged data isn't re-encoded and re-hashed
+type snapshotCache struct {
+	mu       sync.Mutex
+	built    bool
+	versions snapshotVersions
+	body     []byte
+	etag     string
+}
+
+// currentSnapshot returns the encoded snapshot and its ETag, rebuilding only if a store has changed
+func (r *router) currentSnapshot() ([]byte, string, error) {
+	// Versions are read before the data, so a change that lands mid-build leaves
+	// the cache looking stale and the next request rebuilds it
+	versions := snapshotVersions{
+		areas:    r.areaStore.Version(),
+		readings: r.readingStore.Version(),
+		pixels:   r.pixelStore.Version(),
+		stats:    r.statsStore.Version(),
+	}
+
+	cache := r.snapshotCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.built && cache.versions == versions {
+		return cache.body, cache.etag, nil
+	}
+
+	snapshot := Snapshot{
+		Areas:    r.areaStore.GetAreas(),
+		Readings: r.readingStore.AllReadings(),
+		Pixels:   r.pixelStore.GetPixels(),
+		Stats:    r.statsStore.GetStats(""),
+	}
+	// The stores return map-ordered slices; sort them so equal data always hashes the same
+	if snapshot.Pixels == nil {
+		snapshot.Pixels = []PixelCount{}
+	}
+	sort.Slice(snapshot.Pixels, func(i, j int) bool {
+		return snapshot.Pixels[i].Area < snapshot.Pixels[j].Area
+	})
+	if snapshot.Stats == nil {
+		snapshot.Stats = []AreaStat{}
+	}
+	sort.Slice(snapshot.Stats, func(i, j int) bool {
+		return snapshot.Stats[i].Name < snapshot.Stats[j].Name
+	})
+	for _, stat := range snapshot.Stats {
+		sort.Slice(stat.Metrics, func(i, j int) bool {
+			return stat.Metrics[i].Name < stat.Metrics[j].Name
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(snapshot); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	cache.built = true
+	cache.versions = versions
+	cache.body = buf.Bytes()
+	cache.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	return cache.body, cache.etag, nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag (or is "*")
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *router) handleSnapshot(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, etag, err := r.currentSnapshot()
+	if err != nil {
+		log.Printf("snapshot encode error: %v", err)
+		http.Error(w, "failed to build snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	// Clients may cache the snapshot but must revalidate it on every use
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if req.Method == "HEAD" {
+		return
+	}
+	w.Write(body)
+}
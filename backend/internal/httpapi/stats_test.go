@@ -0,0 +1,80 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+)
+
+func TestGetStatsByMetric(t *testing.T) {
+	ss := NewStatsStore()
+	ss.UpdateStat("FLOOR16", "co2", 400, 600, 350, 650)
+	ss.UpdateStat("FLOOR16", "temp", 20, 25, 18, 27)
+	ss.UpdateStat("FLOOR17", "CO2", 420, 610, 360, 660)
+	ss.UpdateStat("POOL", "temp", 26, 28, 25, 29)
+
+	stats := ss.GetStatsByMetric("", " Co2 ")
+	if len(stats) != 2 {
+		t.Fatalf("co2 stats = %+v, want FLOOR16 and FLOOR17", stats)
+	}
+	for _, stat := range stats {
+		if stat.Name == "POOL" || len(stat.Metrics) != 1 || stat.Metrics[0].Name != "co2" {
+			t.Errorf("stat = %+v, want only co2", stat)
+		}
+	}
+
+	if stats := ss.GetStatsByMetric("floor17", "co2"); len(stats) != 1 || stats[0].Name != "FLOOR17" || stats[0].Metrics[0].Min != 420 {
+		t.Errorf("FLOOR17 co2 = %+v, want the FLOOR17 stat", stats)
+	}
+	if stats := ss.GetStatsByMetric("", "hum"); stats == nil || len(stats) != 0 {
+		t.Errorf("hum stats = %#v, want an empty slice", stats)
+	}
+}
+
+func TestStatsEndpointMetricFilter(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	rec := serve(rt, "GET", "/api/stats?metric=co2", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"stats":[]`) {
+		t.Errorf("response = %s, want an empty stats list", rec.Body)
+	}
+}
+
+func TestStatsReset(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "s3cret"
+	})
+	ss := rt.r.statsStore
+	ss.UpdateStat("FLOOR16", "co2", 400, 600, 350, 650)
+	ss.UpdateStat("FLOOR17", "co2", 420, 610, 360, 660)
+	ss.UpdateStat("POOL", "temp", 26, 28, 25, 29)
+	key := map[string]string{"X-Access-Key": "s3cret"}
+
+	expectStatus(t, serve(rt, "DELETE", "/api/stats?area=FLOOR16", "", nil), http.StatusUnauthorized)
+
+	before := ss.Version()
+	rec := serve(rt, "DELETE", "/api/stats?area=floor16", "", key)
+	expectStatus(t, rec, 200)
+	if body := rec.Body.String(); !strings.Contains(body, `"cleared":["FLOOR16"]`) {
+		t.Errorf("body = %s, want FLOOR16 cleared", body)
+	}
+	if stats := ss.GetStats("FLOOR16"); len(stats) != 0 {
+		t.Errorf("FLOOR16 stats = %+v after reset", stats)
+	}
+	if len(ss.GetStats("")) != 2 || ss.Version() == before {
+		t.Errorf("other areas or version changed wrongly: %+v, version %d", ss.GetStats(""), ss.Version())
+	}
+
+	expectStatus(t, serve(rt, "DELETE", "/api/stats?area=FLOOR16", "", key), http.StatusNotFound)
+
+	rec = serve(rt, "DELETE", "/api/stats", "", key)
+	expectStatus(t, rec, 200)
+	if body := rec.Body.String(); !strings.Contains(body, `"cleared":["FLOOR17","POOL"]`) {
+		t.Errorf("body = %s, want FLOOR17 and POOL cleared", body)
+	}
+	if stats := ss.GetStats(""); len(stats) != 0 {
+		t.Errorf("stats = %+v after clearing everything", stats)
+	}
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseClientBuffer is how many messages may queue for one SSE client before new ones are dropped
+const sseClientBuffer = 64
+
+// sseKeepAliveInterval is how often an idle stream sends a comment so proxies keep it open
+const sseKeepAliveInterval = 30 * time.Second
+
+// sseClient is a connected server-sent events client
+type sseClient struct {
+	messages chan ProbeMessage
+}
+
+// addStreamClient registers an SSE client for broadcasts
+func (ms *MessageStore) addStreamClient() *sseClient {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	client := &sseClient{messages: make(chan ProbeMessage, sseClientBuffer)}
+	ms.streamClients[client] = struct{}{}
+	return client
+}
+
+// removeStreamClient unregisters an SSE client
+func (ms *MessageStore) removeStreamClient(client *sseClient) {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	delete(ms.streamClients, client)
+}
+
+// StreamClientCount returns the number of connected SSE clients
+func (ms *MessageStore) StreamClientCount() int {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	return len(ms.streamClients)
+}
+
+// publishStream hands a message to every SSE client without blocking the broadcaster
+// A client whose buffer is full misses the message rather than stalling the others
+func (ms *MessageStore) publishStream(msg ProbeMessage) {
+	ms.clientsMu.Lock()
+	defer ms.clientsMu.Unlock()
+	for client := range ms.streamClients {
+		select {
+		case client.messages <- msg:
+		default:
+		}
+	}
+}
+
+func (r *router) handleStream(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's timeouts, so each write gets its own deadline instead
+	clearDeadlines(w)
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := r.messageStore.addStreamClient()
+	defer r.messageStore.removeStreamClient(client)
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg := <-client.messages:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				log.Printf("stream encode error: %v", err)
+				continue
+			}
+			rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			// The message ID lets EventSource report Last-Event-ID on reconnect
+			if _, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", msg.ID, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			// Client disconnected
+			return
+		case <-r.done:
+			return
+		}
+	}
+}
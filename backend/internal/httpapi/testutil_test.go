@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/probemaster2/internal/config"
+)
+
+// newTestRouter builds a router on the default config, adjusted by configure if set
+// It is shut down when the test ends
+func newTestRouter(t *testing.T, configure func(cfg *config.Config)) *Router {
+	t.Helper()
+	cfg := config.Load()
+	if configure != nil {
+		configure(&cfg)
+	}
+	rt := NewRouter(cfg)
+	t.Cleanup(rt.Shutdown)
+	return rt
+}
+
+// serve sends a request through the router and returns the recorded response
+func serve(rt *Router, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, req)
+	return rec
+}
+
+// wsURL converts an httptest server URL and path into a WebSocket URL
+func wsURL(srv *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + path
+}
+
+// testFrame is a received WebSocket envelope with its payload left encoded
+type testFrame struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// readFrameOfType reads frames until one of the wanted type arrives, failing after a few seconds
+func readFrameOfType(t *testing.T, conn *websocket.Conn, frameType string) testFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame testFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for a %q frame: %v", frameType, err)
+		}
+		if frame.Type == frameType {
+			return frame
+		}
+	}
+}
+
+// expectStatus fails the test if a response doesn't have the wanted status
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d (body %q)", rec.Code, want, rec.Body.String())
+	}
+}
@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestPatchThresholdRequiresAllValuesForNewMetric(t *testing.T) {
+	ts := NewThresholdStore()
+	v := 900.0
+	var partial [6]*float64
+	partial[4] = &v
+	if _, err := ts.PatchThreshold("FLOOR16", "co2", partial); !errors.Is(err, errThresholdIncomplete) {
+		t.Fatalf("partial patch of a new metric: err = %v, want errThresholdIncomplete", err)
+	}
+	if got := ts.GetThresholds("FLOOR16"); len(got) != 0 {
+		t.Errorf("rejected patch stored thresholds: %+v", got)
+	}
+
+	var full [6]*float64
+	for i := range full {
+		value := float64(i * 100)
+		full[i] = &value
+	}
+	if _, err := ts.PatchThreshold("FLOOR16", "co2", full); err != nil {
+		t.Fatalf("full patch: %v", err)
+	}
+	values, err := ts.PatchThreshold("FLOOR16", "co2", partial)
+	if err != nil {
+		t.Fatalf("partial patch of an existing metric: %v", err)
+	}
+	want := []float64{0, 100, 200, 300, 900, 500}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Fatalf("values = %v, want %v", values, want)
+		}
+	}
+}
+
+func TestThresholdPatchEndpointRejectsPartialNewMetric(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	rec := serve(rt, "PATCH", "/api/thresholds/floor16", `{"metric":"co2","index":4,"value":900}`, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestStatsAndThresholdStoresConcurrentAccess(t *testing.T) {
+	ss := NewStatsStore()
+	ts := NewThresholdStore()
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		area := fmt.Sprintf("FLOOR1%d", w)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				v := float64(i)
+				ss.UpdateStat(area, "co2", v, v+10, v, v+10)
+				ts.UpdateThresholds(area, []MetricThreshold{{Metric: "co2", Values: []float64{v, v + 1, v + 2, v + 3, v + 4, v + 5}}})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				// Writing to the returned copies must not touch the stores
+				for _, stat := range ss.GetStats("") {
+					for i := range stat.Metrics {
+						stat.Metrics[i].Min = -1
+					}
+				}
+				for _, threshold := range ts.GetThresholds(area) {
+					threshold.Values[0] = -1
+				}
+				ts.AllThresholds()
+				ts.GetMetricThreshold(area, "co2")
+			}
+		}()
+	}
+	wg.Wait()
+
+	for w := range 4 {
+		area := fmt.Sprintf("FLOOR1%d", w)
+		values, ok := ts.GetMetricThreshold(area, "co2")
+		if !ok || values[0] != 199 {
+			t.Errorf("%s co2 thresholds = %v, want the last update", area, values)
+		}
+		stats := ss.GetStats(area)
+		if len(stats) != 1 || len(stats[0].Metrics) != 1 || stats[0].Metrics[0].Min != 199 {
+			t.Errorf("%s stats = %+v, want the last update", area, stats)
+		}
+	}
+}
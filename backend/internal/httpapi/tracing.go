@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+)
+
+// requestIDKey is the context key holding a request's ID
+type requestIDKey struct{}
+
+// maxRequestIDLength bounds an X-Request-ID accepted from a client, so it can't bloat every log line
+const maxRequestIDLength = 64
+
+// newRequestID returns a random 16-character hex ID
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether a client-supplied X-Request-ID is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID returns ctx carrying the request ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the request ID carried by ctx, or "" if there is none
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// span times one step of handling a request, logging its start and end with the request ID
+// A nil span (TRACE_SPANS off) does nothing, so callers can always defer end
+type span struct {
+	name      string
+	requestID string
+	start     time.Time
+}
+
+// startSpan begins a span named name when TRACE_SPANS is on
+func (r *router) startSpan(ctx context.Context, name string) *span {
+	if !r.cfg.TraceSpans {
+		return nil
+	}
+	s := &span{name: name, requestID: requestID(ctx), start: time.Now()}
+	slog.Info("span start", "span", s.name, "request_id", s.requestID)
+	return s
+}
+
+// end logs the span's duration
+func (s *span) end() {
+	if s == nil {
+		return
+	}
+	slog.Info("span end",
+		"span", s.name,
+		"request_id", s.requestID,
+		"duration_us", time.Since(s.start).Microseconds(),
+	)
+}
@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/probemaster2/internal/config"
+	"github.com/probemaster2/internal/logging"
+)
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of background goroutines
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.Write(p)
+}
+
+func (lb *lockedBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.String()
+}
+
+// captureLogs sends the default logger to a buffer until the test ends
+func captureLogs(t *testing.T) *lockedBuffer {
+	t.Helper()
+	var buf lockedBuffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	rt := newTestRouter(t, nil)
+
+	generated := serve(rt, "GET", "/livez", "", nil).Header().Get("X-Request-ID")
+	if len(generated) != 16 {
+		t.Errorf("generated X-Request-ID = %q, want 16 hex characters", generated)
+	}
+	if again := serve(rt, "GET", "/livez", "", nil).Header().Get("X-Request-ID"); again == generated {
+		t.Errorf("two requests got the same ID %q", again)
+	}
+
+	if got := serve(rt, "GET", "/livez", "", map[string]string{"X-Request-ID": "edge-42.a_b"}).Header().Get("X-Request-ID"); got != "edge-42.a_b" {
+		t.Errorf("X-Request-ID = %q, want the client's ID echoed", got)
+	}
+	for _, bad := range []string{"has space", "quote\"d", strings.Repeat("a", 65)} {
+		if got := serve(rt, "GET", "/livez", "", map[string]string{"X-Request-ID": bad}).Header().Get("X-Request-ID"); got == bad || len(got) != 16 {
+			t.Errorf("X-Request-ID %q came back as %q, want a generated ID", bad, got)
+		}
+	}
+}
+
+func TestProbeDataSpansCarryRequestID(t *testing.T) {
+	logs := captureLogs(t)
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.TraceSpans = true
+	})
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", map[string]string{"X-Request-ID": "trace-1"}), 200)
+
+	ended := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			Msg       string `json:"msg"`
+			Span      string `json:"span"`
+			RequestID string `json:"request_id"`
+		}
+		if json.Unmarshal([]byte(line), &entry) != nil {
+			continue
+		}
+		if entry.Msg == "request" && entry.RequestID != "trace-1" {
+			t.Errorf("request log line has request_id %q, want trace-1", entry.RequestID)
+		}
+		if entry.Msg == "span end" {
+			if entry.RequestID != "trace-1" {
+				t.Errorf("span %s has request_id %q, want trace-1", entry.Span, entry.RequestID)
+			}
+			ended[entry.Span] = true
+		}
+	}
+	for _, name := range []string{"probedata.read", "probedata.ingest", "probedata.store", "probedata.parse", "probedata.readings"} {
+		if !ended[name] {
+			t.Errorf("no span end logged for %s; logs:\n%s", name, logs.String())
+		}
+	}
+}
+
+func TestSpansOffByDefault(t *testing.T) {
+	logs := captureLogs(t)
+	rt := newTestRouter(t, nil)
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), 200)
+	if strings.Contains(logs.String(), "span") {
+		t.Errorf("spans logged with TRACE_SPANS off:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,274 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/probemaster2/internal/config"
+)
+
+func TestWebSocketClientsConcurrentConnectAndBroadcast(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			serve(rt, "POST", "/api/probedata", fmt.Sprintf("F16R co2=%d", i), nil)
+		}
+	}()
+
+	var clients sync.WaitGroup
+	for range 8 {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			for range 5 {
+				conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+				if err != nil {
+					t.Errorf("dial: %v", err)
+					return
+				}
+				// Read the sync and snapshot frames and maybe a broadcast before hanging up
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				for range 3 {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						break
+					}
+				}
+				conn.Close()
+			}
+		}()
+	}
+	clients.Wait()
+	close(stop)
+	wg.Wait()
+
+	// Disconnected clients are unregistered once their read loop notices the close
+	deadline := time.Now().Add(2 * time.Second)
+	for rt.r.messageStore.ClientCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := rt.r.messageStore.ClientCount(); n != 0 {
+		t.Errorf("%d clients still registered after disconnecting", n)
+	}
+}
+
+func TestLiveFeedAuthentication(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "s3cret"
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+	// Open streams must end before the server can close
+	defer rt.Stop()
+
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   int
+	}{
+		{"no key", "", "", http.StatusUnauthorized},
+		{"wrong query key", "?access_key=guess", "", http.StatusUnauthorized},
+		{"query key", "?access_key=s3cret", "", http.StatusOK},
+		{"header key", "", "s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.header != "" {
+			header.Set("X-Access-Key", tt.header)
+		}
+
+		t.Run("ws "+tt.name, func(t *testing.T) {
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"+tt.query), header)
+			if conn != nil {
+				conn.Close()
+			}
+			status := http.StatusOK
+			if err != nil {
+				status = 0
+				if resp != nil {
+					status = resp.StatusCode
+				}
+			}
+			if status != tt.want {
+				t.Errorf("handshake status = %d (err %v), want %d", status, err, tt.want)
+			}
+		})
+
+		t.Run("stream "+tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", srv.URL+"/api/stream"+tt.query, nil)
+			req.Header = header
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET /api/stream: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketOversizedFrameClosesClient(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.WSMaxMessageBytes = 64
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+
+	// Frames within the limit are still handled
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"subscribe":["FLOOR16"]}`)); err != nil {
+		t.Fatalf("write subscribe: %v", err)
+	}
+	readFrameOfType(t, conn, "subscribed")
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"subscribe":["`+strings.Repeat("A", 100)+`"]}`)); err != nil {
+		t.Fatalf("write oversized frame: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Errorf("read error = %v, want close 1009", err)
+		}
+		break
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for rt.r.messageStore.ClientCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := rt.r.messageStore.ClientCount(); n != 0 {
+		t.Errorf("%d clients still registered after an oversized frame", n)
+	}
+}
+
+// readCloseFrame reads until the server closes the connection, returning the close code and decoded reason
+func readCloseFrame(t *testing.T, conn *websocket.Conn, timeout time.Duration) (int, wsCloseReason) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("read error = %v, want a close frame", err)
+		}
+		var reason wsCloseReason
+		if err := json.Unmarshal([]byte(closeErr.Text), &reason); err != nil {
+			t.Fatalf("close reason %q is not JSON: %v", closeErr.Text, err)
+		}
+		return closeErr.Code, reason
+	}
+}
+
+func TestWebSocketShutdownSendsCloseFrame(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.WSRetryAfterSeconds = 7
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+
+	rt.Stop()
+	code, reason := readCloseFrame(t, conn, 5*time.Second)
+	if code != websocket.CloseServiceRestart {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseServiceRestart)
+	}
+	if reason.Reason != "server shutting down" || reason.RetryAfter != 7 {
+		t.Errorf("close reason = %+v, want server shutting down with retryAfter 7", reason)
+	}
+}
+
+func TestWebSocketPingTimeoutSendsCloseFrame(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.WSPingIntervalSeconds = 1
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	// Swallow pings so the server never sees a pong
+	conn.SetPingHandler(func(string) error { return nil })
+	readFrameOfType(t, conn, "snapshot")
+
+	code, reason := readCloseFrame(t, conn, 10*time.Second)
+	if code != websocket.CloseGoingAway {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+	if reason.Reason != "ping timeout" || reason.RetryAfter != 0 {
+		t.Errorf("close reason = %+v, want ping timeout without retryAfter", reason)
+	}
+}
+
+// A message whose probe ID can't be parsed belongs to no area, so subscribed clients get it too
+func TestWebSocketSubscriptionGetsUnparsableMessages(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+	if err := conn.WriteJSON(map[string]any{"subscribe": []string{"POOL"}}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	readFrameOfType(t, conn, "subscribed")
+
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16R co2=454", nil), http.StatusOK)
+	expectStatus(t, serve(rt, "POST", "/api/probedata", "F16RTOOLONGID co2=454", nil), http.StatusOK)
+
+	// The FLOOR16 message is filtered out, so the next message is the unparsable one
+	var msg ProbeMessage
+	if err := json.Unmarshal(readFrameOfType(t, conn, "message").Payload, &msg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if msg.Data != "F16RTOOLONGID co2=454" {
+		t.Errorf("subscribed client got %q, want the unparsable message", msg.Data)
+	}
+}
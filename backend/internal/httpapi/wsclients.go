@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// handleWSClients lists the connected WebSocket clients, oldest connection first
+// Remote addresses are only included for requests carrying a valid X-Access-Key, and never
+// when no ACCESS_KEY is configured, since anyone could then read them
+func (r *router) handleWSClients(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type clientEntry struct {
+		RemoteAddr  string    `json:"remoteAddr,omitempty"`
+		ConnectedAt time.Time `json:"connectedAt"`
+		Areas       []string  `json:"areas"` // Empty when the client receives every area
+	}
+
+	redacted := !r.validKey(req.Header.Get("X-Access-Key"))
+	clients := r.messageStore.snapshotClients()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].connectedAt.Before(clients[j].connectedAt)
+	})
+	entries := make([]clientEntry, 0, len(clients))
+	for _, client := range clients {
+		entry := clientEntry{
+			ConnectedAt: client.connectedAt,
+			Areas:       client.subscribedAreas(),
+		}
+		if !redacted {
+			entry.RemoteAddr = client.remoteAddr
+		}
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"count":    len(entries),
+		"clients":  entries,
+		"redacted": redacted,
+	})
+}
@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/probemaster2/internal/config"
+)
+
+// wsClientsResponse decodes GET /api/ws/clients
+type wsClientsResponse struct {
+	Count   int `json:"count"`
+	Clients []struct {
+		RemoteAddr string   `json:"remoteAddr"`
+		Areas      []string `json:"areas"`
+	} `json:"clients"`
+	Redacted bool `json:"redacted"`
+}
+
+func getWSClients(t *testing.T, rt *Router, headers map[string]string) wsClientsResponse {
+	t.Helper()
+	rec := serve(rt, "GET", "/api/ws/clients", "", headers)
+	expectStatus(t, rec, http.StatusOK)
+	var body wsClientsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return body
+}
+
+func TestWSClientsListsConnections(t *testing.T) {
+	rt := newTestRouter(t, func(cfg *config.Config) {
+		cfg.AccessKey = "secret"
+	})
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	if got := getWSClients(t, rt, nil); got.Count != 0 || len(got.Clients) != 0 {
+		t.Fatalf("before connecting = %+v, want no clients", got)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws?access_key=secret"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+	if err := conn.WriteJSON(map[string]any{"subscribe": []string{"floor16"}}); err != nil {
+		t.Fatalf("write subscribe: %v", err)
+	}
+	readFrameOfType(t, conn, "subscribed")
+
+	// Without the key the address is withheld
+	got := getWSClients(t, rt, nil)
+	if got.Count != 1 || len(got.Clients) != 1 {
+		t.Fatalf("clients = %+v, want 1", got)
+	}
+	if !got.Redacted || got.Clients[0].RemoteAddr != "" {
+		t.Errorf("unauthenticated response = %+v, want the address redacted", got)
+	}
+	if areas := got.Clients[0].Areas; len(areas) != 1 || areas[0] != "FLOOR16" {
+		t.Errorf("areas = %v, want [FLOOR16]", areas)
+	}
+
+	got = getWSClients(t, rt, map[string]string{"X-Access-Key": "secret"})
+	if got.Redacted || got.Clients[0].RemoteAddr != conn.LocalAddr().String() {
+		t.Errorf("remoteAddr = %q, want %q", got.Clients[0].RemoteAddr, conn.LocalAddr().String())
+	}
+
+	// A wrong key is treated as no key
+	if got := getWSClients(t, rt, map[string]string{"X-Access-Key": "wrong"}); !got.Redacted {
+		t.Error("wrong key revealed the remote address")
+	}
+}
+
+func TestWSClientsRedactedWithoutAccessKey(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	readFrameOfType(t, conn, "snapshot")
+
+	got := getWSClients(t, rt, map[string]string{"X-Access-Key": "anything"})
+	if got.Count != 1 || !got.Redacted || got.Clients[0].RemoteAddr != "" {
+		t.Errorf("response = %+v, want one redacted client", got)
+	}
+	if got.Clients[0].Areas == nil || len(got.Clients[0].Areas) != 0 {
+		t.Errorf("areas = %v, want an empty list for the firehose", got.Clients[0].Areas)
+	}
+}
+
+func TestWSClientsMethodNotAllowed(t *testing.T) {
+	rt := newTestRouter(t, nil)
+	expectStatus(t, serve(rt, "POST", "/api/ws/clients", "", nil), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// New returns a logger that writes one JSON object per line with ts, level, and msg fields
+func New(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Use "ts" rather than slog's default "time" key
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				a.Key = "ts"
+			}
+			return a
+		},
+	}))
+}
+
+// Init installs a JSON logger on stderr as the default logger
+// The standard library log package is routed through it as well,
+// so existing log.Printf calls also emit structured lines
+func Init() *slog.Logger {
+	logger := New(os.Stderr)
+	slog.SetDefault(logger)
+	return logger
+}